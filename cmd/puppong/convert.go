@@ -0,0 +1,1387 @@
+// Copyright 2021 The go-orange Authors
+// This file is part of go-orange.
+//
+// go-orange is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-orange is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-orange. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ong2020/go-orange/common"
+	"github.com/ong2020/go-orange/common/hexutil"
+	"github.com/ong2020/go-orange/common/math"
+	"github.com/ong2020/go-orange/core"
+	"github.com/ong2020/go-orange/core/vm"
+	"github.com/ong2020/go-orange/crypto"
+	"github.com/ong2020/go-orange/log"
+	"github.com/ong2020/go-orange/p2p/enode"
+	"github.com/ong2020/go-orange/params"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	convertFormatFlag = cli.StringFlag{
+		Name:  "to",
+		Value: "parity",
+		Usage: "chain spec format to convert into (along, parity, nethermind, pyorange, besu, gong, toml)",
+	}
+	convertOutputFlag = cli.StringFlag{
+		Name:  "out",
+		Usage: "file to write the converted chain spec into (default = stdout)",
+	}
+	convertBootnodesFlag = cli.StringFlag{
+		Name:  "bootnodes",
+		Usage: "comma separated enode URLs to embed into the chain spec",
+	}
+	convertBootnodesFileFlag = cli.StringFlag{
+		Name:  "bootnodes-file",
+		Usage: "file with enode URLs (one per line, # comments) to embed into the chain spec",
+	}
+	convertDescriptorFlag = cli.StringFlag{
+		Name:  "descriptor",
+		Usage: "file to write a network descriptor (chain id, genesis hash, bootnodes) into",
+	}
+	convertChecksumFlag = cli.BoolFlag{
+		Name:  "checksum",
+		Usage: "write a .sha256 sidecar file with the checksum of the chain spec",
+	}
+	convertSignFlag = cli.StringFlag{
+		Name:  "sign",
+		Usage: "private key file to write a detached .sig signature of the chain spec with",
+	}
+	convertValidateCodeFlag = cli.BoolFlag{
+		Name:  "validate-code",
+		Usage: "reject genesis allocs containing truncated contract bytecode",
+	}
+	convertChainIDTransitionsFlag = cli.StringFlag{
+		Name:  "chainid-transitions",
+		Usage: "comma separated block=chainid pairs changing the replay protection chain id at forks",
+	}
+	convertParentHashFlag = cli.StringFlag{
+		Name:  "parent-hash",
+		Usage: "genesis parent hash to emit for networks continuing from an existing chain",
+	}
+	convertNoAllocFlag = cli.BoolFlag{
+		Name:  "no-alloc",
+		Usage: "omit the genesis alloc from the chain spec, emitting only its state root",
+	}
+	convertExpectedSupplyFlag = cli.StringFlag{
+		Name:  "expected-supply",
+		Usage: "total wei the genesis alloc balances must sum up to",
+	}
+	convertFileModeFlag = cli.StringFlag{
+		Name:  "file-mode",
+		Usage: "permission bits (octal) of the written chain spec files",
+		Value: "0644",
+	}
+	convertListPrecompilesFlag = cli.BoolFlag{
+		Name:  "list-precompiles",
+		Usage: "print the precompiled contracts active at genesis instead of converting",
+	}
+	convertCliqueDifficultyFlag = cli.StringFlag{
+		Name:  "clique-difficulty",
+		Usage: "genesis difficulty to emit for Clique networks (conventionally 1)",
+	}
+	convertBundleFlag = cli.StringFlag{
+		Name:  "bundle",
+		Usage: "tar archive to write the chain spec into, with the alloc and code as sidecars",
+	}
+	convertMinClientVersionFlag = cli.StringFlag{
+		Name:  "min-client-version",
+		Usage: "minimum client version (e.g. v1.10.2) to record in the chain spec metadata",
+	}
+	convertExpectGenesisHashFlag = cli.StringFlag{
+		Name:  "expect-genesis-hash",
+		Usage: "genesis hash the converted chain must have, failing otherwise",
+	}
+	convertEmbedGenesisHashFlag = cli.BoolFlag{
+		Name:  "embed-genesis-hash",
+		Usage: "record the genesis block hash in the chain spec metadata",
+	}
+	convertEmitReadmeFlag = cli.BoolFlag{
+		Name:  "emit-readme",
+		Usage: "write a README.md summarizing the network next to the chain spec",
+	}
+	convertStaticNodesFlag = cli.StringFlag{
+		Name:  "static-nodes",
+		Usage: "file containing static peer ENRs (one per line) to embed into the chain spec",
+	}
+	convertLabelsFlag = cli.StringFlag{
+		Name:  "labels",
+		Usage: "JSON file mapping alloc addresses to labels to record in the chain spec metadata",
+	}
+	convertCheckBootnodesFlag = cli.BoolFlag{
+		Name:  "check-bootnodes",
+		Usage: "dial each bootnode over TCP before emitting, warning on unreachable ones",
+	}
+	convertStrictBootnodesFlag = cli.BoolFlag{
+		Name:  "strict-bootnodes",
+		Usage: "fail the conversion on unreachable bootnodes (implies --check-bootnodes)",
+	}
+	convertFormatsFlag = cli.StringFlag{
+		Name:  "formats",
+		Usage: "comma separated chain spec formats to emit at once, named <out>.<format>.json",
+	}
+	convertChainIDFlag = cli.Uint64Flag{
+		Name:  "chain-id",
+		Usage: "chain id override to emit instead of the genesis one",
+	}
+	convertPrintSpecHashFlag = cli.BoolFlag{
+		Name:  "print-spec-hash",
+		Usage: "print the sha256 hash of the canonical chain spec (instead of the spec if no output is set)",
+	}
+	convertShadowForkFlag = cli.BoolFlag{
+		Name:  "shadow-fork",
+		Usage: "convert a shadow fork of the genesis, with a new chain id and shifted fork blocks",
+	}
+	convertNewChainIDFlag = cli.Uint64Flag{
+		Name:  "new-chainid",
+		Usage: "chain id of the shadow fork (required with --shadow-fork)",
+	}
+	convertForkOffsetFlag = cli.Uint64Flag{
+		Name:  "fork-offset",
+		Usage: "number of blocks to shift the fork blocks of the shadow fork by",
+	}
+	convertAllocRLPFlag = cli.StringFlag{
+		Name:  "alloc-rlp",
+		Usage: "file to write the alloc into as RLP (address, account) pairs sorted by hashed address",
+	}
+	convertDropEmptyFlag = cli.BoolFlag{
+		Name:  "drop-empty",
+		Usage: "drop the alloc accounts without balance, nonce, code and storage",
+	}
+	convertSignersFlag = cli.StringFlag{
+		Name:  "signers",
+		Usage: "comma separated Clique signer addresses to embed into the genesis extraData",
+	}
+	convertUseDefaultBootnodesFlag = cli.BoolFlag{
+		Name:  "use-default-bootnodes",
+		Usage: "use the built-in bootnodes of well-known networks if none are given",
+	}
+	convertYAMLFlag = cli.BoolFlag{
+		Name:  "yaml",
+		Usage: "emit the chain spec as YAML instead of JSON",
+	}
+	convertJSONCFlag = cli.BoolFlag{
+		Name:  "jsonc",
+		Usage: "emit the chain spec as JSON with comments explaining each fork field",
+	}
+	convertStrictPrecompilesFlag = cli.BoolFlag{
+		Name:  "strict-precompiles",
+		Usage: "reject genesis alloc accounts at builtin addresses instead of merging them (along only)",
+	}
+	convertDevFlag = cli.BoolFlag{
+		Name:  "dev",
+		Usage: "convert into a local development chain with instant sealing and a funded faucet",
+	}
+	convertDevFaucetFlag = cli.StringFlag{
+		Name:  "dev.faucet",
+		Usage: "faucet account to fund in dev mode (default = well-known development account)",
+	}
+	convertCanonicalFlag = cli.BoolFlag{
+		Name:  "canonical",
+		Usage: "emit a diff-friendly canonical chain spec (sorted keys, lowercase hex numbers)",
+	}
+)
+
+// defaultBootnodes is the registry of the bootnodes of well-known networks, used
+// if the conversion is requested without explicit bootnodes.
+var defaultBootnodes = map[string][]string{
+	"mainnet": params.MainnetBootnodes,
+	"ropsten": params.RopstenBootnodes,
+	"rinkeby": params.RinkebyBootnodes,
+	"goerli":  params.GoerliBootnodes,
+	"yolov3":  params.YoloV3Bootnodes,
+}
+
+// convertCommand converts a go-orange genesis into the chain specification of
+// another client without going through the interactive wizard.
+var convertCommand = cli.Command{
+	Name:      "convert",
+	Usage:     "Convert a go-orange genesis into another client's chain spec",
+	ArgsUsage: "<genesis.json>",
+	Flags: []cli.Flag{
+		convertFormatFlag,
+		convertOutputFlag,
+		convertBootnodesFlag,
+		convertBootnodesFileFlag,
+		convertDescriptorFlag,
+		convertChecksumFlag,
+		convertSignFlag,
+		convertValidateCodeFlag,
+		convertChainIDTransitionsFlag,
+		convertParentHashFlag,
+		convertNoAllocFlag,
+		convertExpectedSupplyFlag,
+		convertCanonicalFlag,
+		convertFileModeFlag,
+		convertListPrecompilesFlag,
+		convertCliqueDifficultyFlag,
+		convertBundleFlag,
+		convertMinClientVersionFlag,
+		convertExpectGenesisHashFlag,
+		convertEmbedGenesisHashFlag,
+		convertEmitReadmeFlag,
+		convertStaticNodesFlag,
+		convertLabelsFlag,
+		convertCheckBootnodesFlag,
+		convertStrictBootnodesFlag,
+		convertFormatsFlag,
+		convertChainIDFlag,
+		convertPrintSpecHashFlag,
+		convertShadowForkFlag,
+		convertNewChainIDFlag,
+		convertForkOffsetFlag,
+		convertAllocRLPFlag,
+		convertDropEmptyFlag,
+		convertSignersFlag,
+		convertUseDefaultBootnodesFlag,
+		convertYAMLFlag,
+		convertJSONCFlag,
+		convertStrictPrecompilesFlag,
+		convertDevFlag,
+		convertDevFaucetFlag,
+	},
+	Action: convertGenesis,
+	Description: `
+The network name, chain id and output format can also be supplied via the
+PUPPONG_NETWORK, PUPPONG_CHAIN_ID and PUPPONG_FORMAT environment variables.
+Explicitly set flags take precedence over the environment, which in turn takes
+precedence over the defaults and the values in the genesis.`,
+}
+
+// Environment variables used as fallbacks for unset conversion flags.
+const (
+	convertNetworkEnv = "PUPPONG_NETWORK"
+	convertChainIDEnv = "PUPPONG_CHAIN_ID"
+	convertFormatEnv  = "PUPPONG_FORMAT"
+)
+
+// convertConfig contains all the user supplied options of a single chain spec
+// conversion.
+type convertConfig struct {
+	network    string      // Name of the network to embed into the chain spec
+	chainID    *big.Int    // Chain id override to embed into the chain spec (nil = genesis)
+	format     string      // Chain spec format to convert into
+	output     string      // File to write the chain spec into (empty = stdout)
+	bootnodes  []string    // Bootnodes to embed into the chain spec
+	static     []string    // Static peer ENRs to embed into the chain spec
+	descriptor string      // File to write the network descriptor into (empty = skip)
+	checksum   bool        // Whether to write a sha256 sidecar of the chain spec
+	signer     string      // Private key file to sign the chain spec with (empty = skip)
+	canonical  bool        // Whether to emit the chain spec in canonical form
+	fileMode   os.FileMode // Permission of the written files (0 = 0644)
+	bundle     string      // Tar archive to bundle the spec and its sidecars into (empty = skip)
+	readme     bool        // Whether to write a README.md summarizing the network
+	printHash  bool        // Whether to print the hash of the canonical chain spec
+	allocRLP   string      // File to write the alloc into as sorted RLP pairs (empty = skip)
+	yaml       bool        // Whether to emit the chain spec as YAML instead of JSON
+	jsonc      bool        // Whether to annotate the JSON chain spec with fork comments
+
+	checkBootnodes  bool           // Whether to dial the bootnodes before emitting
+	strictBootnodes bool           // Whether unreachable bootnodes are an error instead of a warning
+	dialer          bootnodeDialer // Dialer used to check bootnode reachability (nil = net.DialTimeout)
+
+	validateCode       bool                      // Whether to reject truncated bytecode in the alloc
+	chainIDTransitions map[uint64]uint64         // Fork blocks changing the chain id (replay protection)
+	parentHash         *common.Hash              // Genesis parent hash override (nil = keep original)
+	noAlloc            bool                      // Whether to omit the alloc, emitting only the state root
+	expectedSupply     *big.Int                  // Total balance the alloc must sum up to (nil = skip)
+	cliqueDifficulty   *big.Int                  // Genesis difficulty override for Clique (nil = keep)
+	minClientVersion   string                    // Minimum client version to record in the metadata (empty = skip)
+	expectGenesisHash  *common.Hash              // Genesis hash the converted chain must have (nil = skip)
+	embedGenesisHash   bool                      // Whether to record the genesis hash in the metadata
+	labels             map[common.Address]string // Labels of alloc accounts to record in the metadata
+	shadowFork         bool                      // Whether to convert a shadow fork of the genesis
+	shadowChainID      uint64                    // Chain id of the shadow fork
+	shadowForkOffset   uint64                    // Number of blocks to shift the shadow fork's forks by
+	dropEmpty          bool                      // Whether to drop the empty accounts from the alloc
+	signers            []common.Address          // Clique signers to embed into the extraData (nil = keep)
+	strictPrecompiles  bool                      // Whether alloc accounts at builtin addresses are an error instead of merged
+	dev                bool                      // Whether to convert into a local development chain
+	devFaucet          *common.Address           // Faucet to fund in dev mode (nil = devFaucet)
+}
+
+// convertGenesis is the entry point of the convert command, assembling the
+// conversion options from the command line and running the conversion.
+func convertGenesis(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return errors.New("need the genesis file as the single argument")
+	}
+	genesis, err := loadGenesis(ctx.Args().First())
+	if err != nil {
+		return err
+	}
+	if ctx.Bool(convertListPrecompilesFlag.Name) {
+		for _, precompile := range genesisPrecompiles(genesis.Config) {
+			fmt.Printf("%s %s\n", precompile.address.Hex(), precompile.name)
+		}
+		return nil
+	}
+	bootnodes := splitAndTrim(ctx.String(convertBootnodesFlag.Name))
+	if path := ctx.String(convertBootnodesFileFlag.Name); path != "" {
+		nodes, err := loadBootnodes(path)
+		if err != nil {
+			return err
+		}
+		bootnodes = append(bootnodes, nodes...)
+	}
+	var static []string
+	if path := ctx.String(convertStaticNodesFlag.Name); path != "" {
+		if static, err = loadStaticNodes(path); err != nil {
+			return err
+		}
+	}
+	var labels map[common.Address]string
+	if path := ctx.String(convertLabelsFlag.Name); path != "" {
+		if labels, err = loadLabels(path); err != nil {
+			return err
+		}
+	}
+	signers, err := parseSigners(ctx.String(convertSignersFlag.Name))
+	if err != nil {
+		return err
+	}
+	var faucet *common.Address
+	if input := ctx.String(convertDevFaucetFlag.Name); input != "" {
+		if !common.IsHexAddress(input) {
+			return fmt.Errorf("invalid dev faucet %q", input)
+		}
+		addr := common.HexToAddress(input)
+		faucet = &addr
+	}
+	transitions, err := parseChainIDTransitions(ctx.String(convertChainIDTransitionsFlag.Name))
+	if err != nil {
+		return err
+	}
+	parentHash, err := parseHash(ctx.String(convertParentHashFlag.Name), "parent hash")
+	if err != nil {
+		return err
+	}
+	expectHash, err := parseHash(ctx.String(convertExpectGenesisHashFlag.Name), "expected genesis hash")
+	if err != nil {
+		return err
+	}
+	var supply *big.Int
+	if input := ctx.String(convertExpectedSupplyFlag.Name); input != "" {
+		var ok bool
+		if supply, ok = math.ParseBig256(input); !ok {
+			return fmt.Errorf("invalid expected supply %q", input)
+		}
+	}
+	var difficulty *big.Int
+	if input := ctx.String(convertCliqueDifficultyFlag.Name); input != "" {
+		var ok bool
+		if difficulty, ok = math.ParseBig256(input); !ok {
+			return fmt.Errorf("invalid clique difficulty %q", input)
+		}
+	}
+	mode, err := strconv.ParseUint(ctx.String(convertFileModeFlag.Name), 8, 32)
+	if err != nil || os.FileMode(mode)&^os.ModePerm != 0 {
+		return fmt.Errorf("invalid file mode %q", ctx.String(convertFileModeFlag.Name))
+	}
+	// Resolve the parameters which may be supplied via the environment too
+	network := ctx.GlobalString("network")
+	if env := os.Getenv(convertNetworkEnv); env != "" && !ctx.GlobalIsSet("network") {
+		network = env
+	}
+	if len(bootnodes) == 0 && ctx.Bool(convertUseDefaultBootnodesFlag.Name) {
+		defaults, ok := defaultBootnodes[network]
+		if !ok {
+			return fmt.Errorf("no default bootnodes known for network %q", network)
+		}
+		bootnodes = defaults
+	}
+	format := ctx.String(convertFormatFlag.Name)
+	if env := os.Getenv(convertFormatEnv); env != "" && !ctx.IsSet(convertFormatFlag.Name) {
+		format = env
+	}
+	var chainID *big.Int
+	if ctx.IsSet(convertChainIDFlag.Name) {
+		chainID = new(big.Int).SetUint64(ctx.Uint64(convertChainIDFlag.Name))
+	} else if env := os.Getenv(convertChainIDEnv); env != "" {
+		id, err := strconv.ParseUint(env, 0, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %v", convertChainIDEnv, env, err)
+		}
+		chainID = new(big.Int).SetUint64(id)
+	}
+	conf := &convertConfig{
+		network:    network,
+		chainID:    chainID,
+		format:     format,
+		output:     ctx.String(convertOutputFlag.Name),
+		bootnodes:  bootnodes,
+		static:     static,
+		descriptor: ctx.String(convertDescriptorFlag.Name),
+		checksum:   ctx.Bool(convertChecksumFlag.Name),
+		signer:     ctx.String(convertSignFlag.Name),
+		canonical:  ctx.Bool(convertCanonicalFlag.Name),
+		fileMode:   os.FileMode(mode),
+		bundle:     ctx.String(convertBundleFlag.Name),
+		readme:     ctx.Bool(convertEmitReadmeFlag.Name),
+		printHash:  ctx.Bool(convertPrintSpecHashFlag.Name),
+		allocRLP:   ctx.String(convertAllocRLPFlag.Name),
+		yaml:       ctx.Bool(convertYAMLFlag.Name),
+		jsonc:      ctx.Bool(convertJSONCFlag.Name),
+
+		checkBootnodes:  ctx.Bool(convertCheckBootnodesFlag.Name) || ctx.Bool(convertStrictBootnodesFlag.Name),
+		strictBootnodes: ctx.Bool(convertStrictBootnodesFlag.Name),
+
+		validateCode:       ctx.Bool(convertValidateCodeFlag.Name),
+		chainIDTransitions: transitions,
+		parentHash:         parentHash,
+		noAlloc:            ctx.Bool(convertNoAllocFlag.Name),
+		expectedSupply:     supply,
+		cliqueDifficulty:   difficulty,
+		minClientVersion:   ctx.String(convertMinClientVersionFlag.Name),
+		expectGenesisHash:  expectHash,
+		embedGenesisHash:   ctx.Bool(convertEmbedGenesisHashFlag.Name),
+		labels:             labels,
+		shadowFork:         ctx.Bool(convertShadowForkFlag.Name),
+		shadowChainID:      ctx.Uint64(convertNewChainIDFlag.Name),
+		shadowForkOffset:   ctx.Uint64(convertForkOffsetFlag.Name),
+		dropEmpty:          ctx.Bool(convertDropEmptyFlag.Name),
+		signers:            signers,
+		strictPrecompiles:  ctx.Bool(convertStrictPrecompilesFlag.Name),
+		dev:                ctx.Bool(convertDevFlag.Name),
+		devFaucet:          faucet,
+	}
+	if formats := splitAndTrim(ctx.String(convertFormatsFlag.Name)); len(formats) > 0 {
+		return runConvertFormats(genesis, conf, formats)
+	}
+	return runConvert(genesis, conf)
+}
+
+// runConvertFormats converts the genesis into multiple chain spec formats in one
+// go, writing each into a file sharing the output basename. Auxiliary outputs
+// not tied to a specific format are only written once.
+func runConvertFormats(genesis *chainGenesis, conf *convertConfig, formats []string) error {
+	if conf.output == "" {
+		return errors.New("multiple formats need an output basename")
+	}
+	ext := "json"
+	switch {
+	case conf.yaml:
+		ext = "yaml"
+	case conf.jsonc:
+		ext = "jsonc"
+	}
+	for i, format := range formats {
+		fconf := *conf
+		fconf.format = format
+		fconf.output = fmt.Sprintf("%s.%s.%s", conf.output, format, ext)
+		if i > 0 {
+			fconf.descriptor, fconf.readme, fconf.bundle, fconf.allocRLP = "", false, "", ""
+		}
+		if err := runConvert(genesis, &fconf); err != nil {
+			return fmt.Errorf("%s: %v", format, err)
+		}
+	}
+	return nil
+}
+
+// runConvert converts the genesis into the requested chain spec format and
+// writes it, along with any requested auxiliary outputs, to its destination.
+func runConvert(genesis *chainGenesis, conf *convertConfig) error {
+	if (conf.checksum || conf.signer != "") && conf.output == "" {
+		return errors.New("checksums and signatures need an output file")
+	}
+	if conf.readme && conf.output == "" {
+		return errors.New("readme needs an output file")
+	}
+	if (conf.yaml || conf.jsonc) && conf.format == "toml" {
+		return errors.New("yaml and jsonc output are not supported for the toml format")
+	}
+	if conf.yaml && conf.jsonc {
+		return errors.New("yaml and jsonc output are mutually exclusive")
+	}
+	if conf.checkBootnodes {
+		dialer := conf.dialer
+		if dialer == nil {
+			dialer = net.DialTimeout
+		}
+		if unreachable := checkBootnodes(conf.bootnodes, dialer, bootnodeDialTimeout); len(unreachable) > 0 {
+			for _, node := range unreachable {
+				log.Warn("Bootnode unreachable", "enode", node)
+			}
+			if conf.strictBootnodes {
+				return fmt.Errorf("%d of %d bootnodes unreachable", len(unreachable), len(conf.bootnodes))
+			}
+		}
+	}
+	// The spec and all auxiliary outputs must describe the overridden genesis
+	overridden, err := overrideGenesis(genesis, conf)
+	if err != nil {
+		return err
+	}
+	spec, err := convertChainSpec(overridden, conf)
+	if err != nil {
+		return err
+	}
+	mode := conf.fileMode
+	if mode == 0 {
+		mode = 0644
+	}
+	out, err := encodeChainSpec(spec, conf.canonical)
+	if err != nil {
+		return err
+	}
+	switch {
+	case conf.yaml:
+		if out, err = jsonToYAML(out); err != nil {
+			return err
+		}
+	case conf.jsonc:
+		out = annotateJSON(out)
+	}
+	if conf.output == "" {
+		// If the spec is only requested in a bundle or hash, don't dump it to stdout
+		if conf.bundle == "" && !conf.printHash {
+			fmt.Println(string(bytes.TrimSuffix(out, []byte("\n"))))
+		}
+	} else {
+		if err := writeConvertFile(conf.output, out, mode); err != nil {
+			return err
+		}
+		log.Info("Saved converted chain spec", "format", conf.format, "path", conf.output)
+	}
+	if conf.printHash {
+		hash, err := chainSpecHash(spec)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%x\n", hash)
+	}
+	if conf.checksum {
+		sum := sha256.Sum256(out)
+		line := fmt.Sprintf("%x  %s\n", sum, filepath.Base(conf.output))
+		if err := writeConvertFile(conf.output+".sha256", []byte(line), mode); err != nil {
+			return err
+		}
+		log.Info("Saved chain spec checksum", "path", conf.output+".sha256")
+	}
+	if conf.signer != "" {
+		key, err := crypto.LoadECDSA(conf.signer)
+		if err != nil {
+			return fmt.Errorf("failed to load signing key: %v", err)
+		}
+		sig, err := crypto.Sign(crypto.Keccak256(out), key)
+		if err != nil {
+			return err
+		}
+		if err := writeConvertFile(conf.output+".sig", []byte(hexutil.Encode(sig)+"\n"), mode); err != nil {
+			return err
+		}
+		log.Info("Saved chain spec signature", "path", conf.output+".sig", "signer", crypto.PubkeyToAddress(key.PublicKey))
+	}
+	if conf.descriptor != "" {
+		desc, err := newNetworkDescriptor(conf.network, overridden, conf.bootnodes)
+		if err != nil {
+			return err
+		}
+		blob, err := json.MarshalIndent(desc, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeConvertFile(conf.descriptor, blob, mode); err != nil {
+			return err
+		}
+		log.Info("Saved network descriptor", "path", conf.descriptor)
+	}
+	if conf.readme {
+		readme, err := generateReadme(conf.network, overridden, conf.bootnodes)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(filepath.Dir(conf.output), "README.md")
+		if err := writeConvertFile(path, readme, mode); err != nil {
+			return err
+		}
+		log.Info("Saved network readme", "path", path)
+	}
+	if conf.allocRLP != "" {
+		blob, err := encodeAllocRLP(overridden.Alloc)
+		if err != nil {
+			return err
+		}
+		if err := writeConvertFile(conf.allocRLP, blob, mode); err != nil {
+			return err
+		}
+		log.Info("Saved alloc RLP", "path", conf.allocRLP, "accounts", len(overridden.Alloc))
+	}
+	if conf.bundle != "" {
+		if err := writeConvertBundle(conf.bundle, overridden, conf, mode); err != nil {
+			return err
+		}
+		log.Info("Saved chain spec bundle", "path", conf.bundle)
+	}
+	return nil
+}
+
+// encodeChainSpec serializes a chain spec into JSON, either in its canonical
+// form or indented for human consumption. Bare chain configs are serialized
+// into TOML instead.
+func encodeChainSpec(spec interface{}, canonical bool) ([]byte, error) {
+	// The TOML format only carries the chain config for client config files
+	if config, ok := spec.(*params.ChainConfig); ok {
+		return encodeChainConfigTOML(config)
+	}
+	if canonical {
+		return canonicalJSON(spec)
+	}
+	var buf bytes.Buffer
+	switch spec := spec.(type) {
+	case *alongGenesisSpec:
+		if err := WriteAlongGenesisSpec(&buf, spec); err != nil {
+			return nil, err
+		}
+	case *parityChainSpec:
+		if err := WriteParityChainSpec(&buf, spec); err != nil {
+			return nil, err
+		}
+	case *nethermindChainSpec:
+		if err := writeChainSpecJSON(&buf, spec); err != nil {
+			return nil, err
+		}
+	default:
+		return json.MarshalIndent(spec, "", "  ")
+	}
+	return buf.Bytes(), nil
+}
+
+// bootnodeDialTimeout is the time allowed for a bootnode to accept a TCP
+// connection before it's deemed unreachable.
+const bootnodeDialTimeout = 3 * time.Second
+
+// bootnodeDialer dials a network address, failing after the timeout elapses.
+type bootnodeDialer func(network, address string, timeout time.Duration) (net.Conn, error)
+
+// checkBootnodes dials each of the bootnodes over TCP and returns the ones which
+// could not be parsed or connected to.
+func checkBootnodes(bootnodes []string, dial bootnodeDialer, timeout time.Duration) []string {
+	var unreachable []string
+	for _, url := range bootnodes {
+		node, err := enode.ParseV4(url)
+		if err != nil {
+			unreachable = append(unreachable, url)
+			continue
+		}
+		conn, err := dial("tcp", net.JoinHostPort(node.IP().String(), strconv.Itoa(node.TCP())), timeout)
+		if err != nil {
+			log.Debug("Failed to dial bootnode", "enode", url, "err", err)
+			unreachable = append(unreachable, url)
+			continue
+		}
+		conn.Close()
+	}
+	return unreachable
+}
+
+// precompileNames maps the addresses of the precompiled contracts to their
+// conventional names.
+var precompileNames = map[common.Address]string{
+	common.BytesToAddress([]byte{1}): "ecrecover",
+	common.BytesToAddress([]byte{2}): "sha256",
+	common.BytesToAddress([]byte{3}): "ripemd160",
+	common.BytesToAddress([]byte{4}): "identity",
+	common.BytesToAddress([]byte{5}): "modexp",
+	common.BytesToAddress([]byte{6}): "bn256Add",
+	common.BytesToAddress([]byte{7}): "bn256ScalarMul",
+	common.BytesToAddress([]byte{8}): "bn256Pairing",
+	common.BytesToAddress([]byte{9}): "blake2f",
+}
+
+// precompile is a named precompiled contract.
+type precompile struct {
+	address common.Address
+	name    string
+}
+
+// genesisPrecompiles returns the precompiled contracts active at block 0 with
+// the given chain config, ordered by address.
+func genesisPrecompiles(config *params.ChainConfig) []precompile {
+	rules := config.Rules(common.Big0)
+
+	var contracts map[common.Address]vm.PrecompiledContract
+	switch {
+	case rules.IsBerlin:
+		contracts = vm.PrecompiledContractsBerlin
+	case rules.IsIstanbul:
+		contracts = vm.PrecompiledContractsIstanbul
+	case rules.IsByzantium:
+		contracts = vm.PrecompiledContractsByzantium
+	default:
+		contracts = vm.PrecompiledContractsHomestead
+	}
+	precompiles := make([]precompile, 0, len(contracts))
+	for addr := range contracts {
+		precompiles = append(precompiles, precompile{address: addr, name: precompileNames[addr]})
+	}
+	sort.Slice(precompiles, func(i, j int) bool {
+		return bytes.Compare(precompiles[i].address[:], precompiles[j].address[:]) < 0
+	})
+	return precompiles
+}
+
+// writeConvertFile writes the data into the file, enforcing the requested
+// permission bits even if the file already existed or the umask is stricter.
+func writeConvertFile(path string, data []byte, mode os.FileMode) error {
+	if err := ioutil.WriteFile(path, data, mode); err != nil {
+		return err
+	}
+	return os.Chmod(path, mode)
+}
+
+// chainSpecHash computes the sha256 hash of the canonical encoding of a chain
+// spec, which is independent of formatting and only changes with the content.
+func chainSpecHash(spec interface{}) (common.Hash, error) {
+	blob, err := canonicalJSON(spec)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return sha256.Sum256(blob), nil
+}
+
+// canonicalJSON encodes a chain spec into a canonical JSON form, where object
+// keys are sorted, all numbers and quantities are rendered as minimal lowercase
+// hex strings and the indentation is fixed, so that semantically equal specs
+// are byte-equal.
+func canonicalJSON(spec interface{}) ([]byte, error) {
+	blob, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(blob))
+	dec.UseNumber()
+
+	var generic interface{}
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	normalized, err := canonicalizeJSON("", generic)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(normalized, "", "  ")
+}
+
+// canonicalQuantityKeys are the chain spec fields holding numeric quantities,
+// which may be encoded as hex with leading zeroes or as decimal strings and are
+// re-encoded as minimal hex. Objects under these fields map block numbers to
+// quantities, so their keys and values are normalized too. All other strings
+// are free text or byte data and are kept as they are, save lowercasing hex.
+var canonicalQuantityKeys = map[string]bool{
+	"accountStartNonce": true, "activate_at": true, "balance": true, "base": true,
+	"baseFeeChangeDenominator": true, "baseFeeMaxChangeDenominator": true,
+	"baseFeePerGas": true, "berlinBlock": true, "blockReward": true, "byzantiumBlock": true,
+	"byzantiumForkBlock": true, "cancunForkTime": true, "cancunTime": true, "chainId": true,
+	"chainID": true, "chainIDTransitions": true, "constantinopleBlock": true,
+	"constantinopleFixForkBlock": true, "constantinopleForkBlock": true,
+	"daoForkBlock": true, "daoHardforkBlock": true, "difficulty": true,
+	"difficultyBombDelays": true, "difficultyBoundDivisor": true, "divisor": true,
+	"durationLimit": true, "eip100bTransition": true, "eip1014Transition": true,
+	"eip1052Transition": true, "eip1153TransitionTimestamp": true,
+	"eip1283DisableTransition": true, "eip1283ReenableTransition": true,
+	"eip1283Transition": true, "eip1344Transition": true, "eip140Transition": true,
+	"eip145Transition": true, "eip150Block": true, "EIP150ForkBlock": true,
+	"eip150Transition": true, "eip1559BaseFeeInitialValue": true,
+	"eip1559BaseFeeMaxChangeDenominator": true, "eip1559ElasticityMultiplier": true,
+	"eip1559Transition": true, "eip155Block": true, "eip155Transition": true,
+	"eip158Block": true, "EIP158ForkBlock": true, "eip160Transition": true,
+	"eip161abcTransition": true, "eip161dTransition": true, "eip1884Transition": true,
+	"eip2028Transition": true, "eip211Transition": true, "eip214Transition": true,
+	"eip3198Transition": true, "eip3529Transition": true, "eip3541Transition": true,
+	"eip3651TransitionTimestamp": true, "eip3855TransitionTimestamp": true,
+	"eip3860TransitionTimestamp": true, "eip4788TransitionTimestamp": true,
+	"eip4844TransitionTimestamp": true, "eip4895TransitionTimestamp": true,
+	"eip5656TransitionTimestamp": true, "eip658Transition": true,
+	"eip6780TransitionTimestamp": true, "eip98Transition": true,
+	"elasticityMultiplier": true, "epoch": true, "ewasmBlock": true,
+	"fixeddifficulty": true, "gas_per_round": true, "gasLimit": true,
+	"gasLimitBoundDivisor": true, "gasUsed": true, "homesteadBlock": true,
+	"homesteadForkBlock": true, "homesteadTransition": true, "istanbulBlock": true,
+	"istanbulForkBlock": true, "londonBlock": true, "londonForkBlock": true,
+	"maxCodeSize": true, "maxCodeSizeTransition": true, "maxGasLimit": true,
+	"maximumExtraDataSize": true, "minGasLimit": true, "minimumDifficulty": true,
+	"muirGlacierBlock": true, "networkID": true, "networkId": true, "nonce": true,
+	"number": true, "pair": true, "period": true, "petersburgBlock": true, "price": true,
+	"shanghaiForkTime": true, "shanghaiTime": true, "specVersion": true,
+	"startingBlock": true, "timestamp": true, "word": true, "yoloV3Block": true,
+}
+
+// canonicalizeJSON recursively normalizes a generic JSON value, stored under the
+// given object key.
+func canonicalizeJSON(field string, value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		normalized := make(map[string]interface{}, len(value))
+		for key, child := range value {
+			childField := key
+			if canonicalQuantityKeys[field] {
+				childField, key = field, canonicalizeString(field, key)
+			} else if has0xPrefix(key) {
+				key = strings.ToLower(key)
+			}
+			child, err := canonicalizeJSON(childField, child)
+			if err != nil {
+				return nil, err
+			}
+			normalized[key] = child
+		}
+		return normalized, nil
+
+	case []interface{}:
+		normalized := make([]interface{}, len(value))
+		for i, child := range value {
+			child, err := canonicalizeJSON(field, child)
+			if err != nil {
+				return nil, err
+			}
+			normalized[i] = child
+		}
+		return normalized, nil
+
+	case json.Number:
+		number, ok := math.ParseBig256(value.String())
+		if !ok {
+			return nil, fmt.Errorf("non-integer number %v in chain spec", value)
+		}
+		return hexutil.EncodeBig(number), nil
+
+	case string:
+		return canonicalizeString(field, value), nil
+
+	default:
+		return value, nil
+	}
+}
+
+// canonicalizeString normalizes a JSON string stored under the given object key,
+// re-encoding quantities as minimal hex and lowercasing other hex strings.
+func canonicalizeString(field string, value string) string {
+	if canonicalQuantityKeys[field] {
+		if number, ok := math.ParseBig256(value); ok && value != "" {
+			return hexutil.EncodeBig(number)
+		}
+	}
+	if has0xPrefix(value) {
+		return strings.ToLower(value)
+	}
+	return value
+}
+
+// has0xPrefix reports whether the string is prefixed by 0x or 0X.
+func has0xPrefix(str string) bool {
+	return len(str) >= 2 && str[0] == '0' && (str[1] == 'x' || str[1] == 'X')
+}
+
+// overrideGenesis applies the user requested genesis overrides, returning a
+// modified copy of the genesis. The original genesis is never modified.
+func overrideGenesis(genesis *chainGenesis, conf *convertConfig) (*chainGenesis, error) {
+	for _, addr := range emptyAllocAccounts(genesis.Alloc) {
+		log.Warn("Empty account in genesis alloc", "address", addr, "dropped", conf.dropEmpty)
+	}
+	if conf.shadowFork {
+		if conf.shadowChainID == 0 {
+			return nil, errors.New("shadow fork needs a new chain id")
+		}
+		if genesis.Config.ChainID != nil && genesis.Config.ChainID.Cmp(new(big.Int).SetUint64(conf.shadowChainID)) == 0 {
+			return nil, fmt.Errorf("shadow fork chain id %d same as the original", conf.shadowChainID)
+		}
+		genesis = shadowForkGenesis(genesis, conf.shadowChainID, conf.shadowForkOffset)
+	}
+	if conf.chainID != nil {
+		// Don't modify the caller's config, override in a copy
+		config := *genesis.Config
+		config.ChainID = new(big.Int).Set(conf.chainID)
+
+		override := *genesis
+		override.Config = &config
+		genesis = &override
+	}
+	if conf.parentHash != nil {
+		override := *genesis
+		override.ParentHash = *conf.parentHash
+		genesis = &override
+	}
+	if conf.dropEmpty {
+		if empty := emptyAllocAccounts(genesis.Alloc); len(empty) > 0 {
+			override := *genesis
+			override.Alloc = make(core.GenesisAlloc, len(genesis.Alloc)-len(empty))
+			for addr, account := range genesis.Alloc {
+				override.Alloc[addr] = account
+			}
+			for _, addr := range empty {
+				delete(override.Alloc, addr)
+			}
+			genesis = &override
+		}
+	}
+	if len(conf.signers) > 0 {
+		override := *genesis
+		override.ExtraData = cliqueExtraData(conf.signers)
+		genesis = &override
+	}
+	if conf.dev {
+		faucet := devFaucet
+		if conf.devFaucet != nil {
+			faucet = *conf.devFaucet
+		}
+		genesis = devGenesis(genesis, faucet, conf.format)
+	}
+	if conf.cliqueDifficulty != nil {
+		if conf.cliqueDifficulty.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid clique difficulty %v, must be positive", conf.cliqueDifficulty)
+		}
+		override := *genesis
+		override.Difficulty = new(big.Int).Set(conf.cliqueDifficulty)
+		genesis = &override
+	}
+	return genesis, nil
+}
+
+// shadowForkGenesis creates a shadow fork of the genesis, retaining its alloc but
+// switching to a new chain id and delaying every scheduled fork block by the
+// given offset. Timestamp based forks are left untouched.
+func shadowForkGenesis(genesis *chainGenesis, chainID uint64, offset uint64) *chainGenesis {
+	config := *genesis.Config
+	config.ChainID = new(big.Int).SetUint64(chainID)
+
+	shift := func(block *big.Int) *big.Int {
+		if block == nil {
+			return nil
+		}
+		return new(big.Int).Add(block, new(big.Int).SetUint64(offset))
+	}
+	config.HomesteadBlock = shift(config.HomesteadBlock)
+	config.DAOForkBlock = shift(config.DAOForkBlock)
+	config.EIP150Block = shift(config.EIP150Block)
+	config.EIP155Block = shift(config.EIP155Block)
+	config.EIP158Block = shift(config.EIP158Block)
+	config.ByzantiumBlock = shift(config.ByzantiumBlock)
+	config.ConstantinopleBlock = shift(config.ConstantinopleBlock)
+	config.PetersburgBlock = shift(config.PetersburgBlock)
+	config.IstanbulBlock = shift(config.IstanbulBlock)
+	config.MuirGlacierBlock = shift(config.MuirGlacierBlock)
+	config.BerlinBlock = shift(config.BerlinBlock)
+	config.YoloV3Block = shift(config.YoloV3Block)
+	config.EWASMBlock = shift(config.EWASMBlock)
+
+	shadow := *genesis
+	shadow.Config = &config
+	shadow.Forks.LondonBlock = shift(genesis.Forks.LondonBlock)
+	return &shadow
+}
+
+// buildChainSpec applies the requested genesis overrides and validations, and
+// converts the result into the requested chain spec format.
+func buildChainSpec(genesis *chainGenesis, conf *convertConfig) (interface{}, error) {
+	genesis, err := overrideGenesis(genesis, conf)
+	if err != nil {
+		return nil, err
+	}
+	return convertChainSpec(genesis, conf)
+}
+
+// convertChainSpec validates a genesis with the requested overrides already
+// applied, and converts it into the requested chain spec format.
+func convertChainSpec(genesis *chainGenesis, conf *convertConfig) (interface{}, error) {
+	if conf.cliqueDifficulty != nil && genesis.Config.Clique == nil {
+		log.Warn("Overriding difficulty of non-Clique genesis", "difficulty", conf.cliqueDifficulty)
+	}
+	if len(conf.signers) > 0 && genesis.Config.Clique == nil {
+		log.Warn("Embedding signers into non-Clique genesis", "signers", len(conf.signers))
+	}
+	// Compute the genesis hash before the alloc is potentially stripped below
+	hash, err := GenesisHash(genesis)
+	if err != nil {
+		return nil, err
+	}
+	if conf.expectGenesisHash != nil && hash != *conf.expectGenesisHash {
+		return nil, fmt.Errorf("genesis hash mismatch: have %x, want %x", hash, *conf.expectGenesisHash)
+	}
+	if conf.validateCode {
+		if invalid := validateAllocCode(genesis.Alloc); len(invalid) > 0 {
+			for _, addr := range invalid {
+				log.Error("Truncated bytecode in genesis alloc", "address", addr)
+			}
+			return nil, fmt.Errorf("truncated bytecode in %d genesis alloc accounts", len(invalid))
+		}
+	}
+	if conf.expectedSupply != nil {
+		if err := validateAllocSupply(genesis.Alloc, conf.expectedSupply); err != nil {
+			return nil, err
+		}
+	}
+	// If the alloc is to be omitted, compute the state root with it and strip
+	// it afterwards, so the genesis header remains correct
+	var stateRoot common.Hash
+	if conf.noAlloc {
+		log.Warn("Omitting genesis alloc, chain spec is not self-contained")
+		stateRoot = genesis.ToBlock(nil).Root()
+
+		stripped := *genesis
+		stripped.Alloc = nil
+		genesis = &stripped
+	}
+	spec, err := newChainSpec(conf.format, conf.network, genesis, conf.bootnodes)
+	if err != nil {
+		return nil, err
+	}
+	if conf.noAlloc {
+		switch spec := spec.(type) {
+		case *alongGenesisSpec:
+			spec.Genesis.StateRoot = &stateRoot
+		case *parityChainSpec:
+			spec.Genesis.StateRoot = &stateRoot
+		case *nethermindChainSpec:
+			spec.Genesis.StateRoot = &stateRoot
+		default:
+			return nil, fmt.Errorf("omitting the alloc not supported by %s chain specs", conf.format)
+		}
+	}
+	if conf.dev {
+		if err := setInstantSeal(spec, conf.format); err != nil {
+			return nil, err
+		}
+	}
+	if conf.strictPrecompiles {
+		along, ok := spec.(*alongGenesisSpec)
+		if !ok {
+			return nil, fmt.Errorf("strict precompiles not supported by %s chain specs", conf.format)
+		}
+		if collisions := along.precompileCollisions(genesis.Alloc); len(collisions) > 0 {
+			builtin := along.Accounts[common.UnprefixedAddress(collisions[0])].Precompiled.Name
+			return nil, fmt.Errorf("genesis alloc account %s collides with the %s builtin", collisions[0].Hex(), builtin)
+		}
+	}
+	if len(conf.chainIDTransitions) > 0 {
+		parity, ok := spec.(*parityChainSpec)
+		if !ok {
+			return nil, fmt.Errorf("chain id transitions not supported by %s chain specs", conf.format)
+		}
+		parity.setChainIDTransitions(conf.chainIDTransitions)
+	}
+	if len(conf.static) > 0 {
+		parity, ok := spec.(*parityChainSpec)
+		if !ok {
+			return nil, fmt.Errorf("static nodes not supported by %s chain specs", conf.format)
+		}
+		parity.StaticNodes = conf.static
+	}
+	if len(conf.labels) > 0 {
+		for addr := range conf.labels {
+			if _, ok := genesis.Alloc[addr]; !ok {
+				log.Warn("Labelled account not in genesis alloc", "address", addr, "label", conf.labels[addr])
+			}
+		}
+		meta, err := chainSpecMetadata(spec, conf.format)
+		if err != nil {
+			return nil, err
+		}
+		meta.Labels = conf.labels
+	}
+	if conf.minClientVersion != "" {
+		if !clientVersionRegexp.MatchString(conf.minClientVersion) {
+			return nil, fmt.Errorf("invalid minimum client version %q", conf.minClientVersion)
+		}
+		meta, err := chainSpecMetadata(spec, conf.format)
+		if err != nil {
+			return nil, err
+		}
+		meta.MinClientVersion = conf.minClientVersion
+	}
+	if conf.embedGenesisHash {
+		meta, err := chainSpecMetadata(spec, conf.format)
+		if err != nil {
+			return nil, err
+		}
+		meta.GenesisHash = &hash
+	}
+	return spec, nil
+}
+
+// clientVersionRegexp matches semantic client versions, e.g. v1.10.2-stable.
+var clientVersionRegexp = regexp.MustCompile(`^v?[0-9]+\.[0-9]+\.[0-9]+(-[0-9A-Za-z.-]+)?$`)
+
+// chainSpecMetadata returns the non-consensus metadata section of a chain spec,
+// creating it if it doesn't exist yet.
+func chainSpecMetadata(spec interface{}, format string) (*chainSpecMeta, error) {
+	switch spec := spec.(type) {
+	case *alongGenesisSpec:
+		if spec.Meta == nil {
+			spec.Meta = new(chainSpecMeta)
+		}
+		return spec.Meta, nil
+	case *parityChainSpec:
+		if spec.Meta == nil {
+			spec.Meta = new(chainSpecMeta)
+		}
+		return spec.Meta, nil
+	default:
+		return nil, fmt.Errorf("metadata not supported by %s chain specs", format)
+	}
+}
+
+// newChainSpec converts a go-orange genesis into the chain spec of the named
+// format.
+func newChainSpec(format string, network string, genesis *chainGenesis, bootnodes []string) (interface{}, error) {
+	switch format {
+	case "along":
+		return newAlongGenesisSpec(network, genesis, bootnodes)
+	case "parity":
+		return newParityChainSpec(network, genesis, bootnodes)
+	case "nethermind":
+		return newNethermindChainSpec(network, genesis, bootnodes)
+	case "pyorange":
+		return newPyOrangeGenesisSpec(network, genesis)
+	case "besu":
+		return newBesuGenesisSpec(network, genesis)
+	case "gong":
+		return genesis, nil
+	case "toml":
+		return genesis.Config, nil
+	default:
+		return nil, fmt.Errorf("unknown chain spec format %q", format)
+	}
+}
+
+// networkDescriptor is a small service discovery document summarizing how to
+// connect to a network, emitted alongside the converted chain spec.
+type networkDescriptor struct {
+	Name        string      `json:"name"`
+	ChainID     uint64      `json:"chainId"`
+	NetworkID   uint64      `json:"networkId"`
+	GenesisHash common.Hash `json:"genesisHash"`
+	Bootnodes   []string    `json:"bootnodes"`
+}
+
+// newNetworkDescriptor assembles the network descriptor of a go-orange genesis.
+func newNetworkDescriptor(network string, genesis *chainGenesis, bootnodes []string) (*networkDescriptor, error) {
+	hash, err := GenesisHash(genesis)
+	if err != nil {
+		return nil, err
+	}
+	desc := &networkDescriptor{
+		Name:        network,
+		GenesisHash: hash,
+		Bootnodes:   bootnodes,
+	}
+	if desc.Bootnodes == nil {
+		desc.Bootnodes = []string{}
+	}
+	// The converters use the chain id as the network id too, mirror that
+	if genesis.Config.ChainID != nil {
+		desc.ChainID = genesis.Config.ChainID.Uint64()
+		desc.NetworkID = desc.ChainID
+	}
+	return desc, nil
+}
+
+// loadBootnodes reads a list of enode URLs from a file, one per line. Empty lines
+// and everything following a # are ignored. Every enode URL is validated.
+func loadBootnodes(path string) ([]string, error) {
+	return loadNodeList(path, "bootnode", func(node string) error {
+		_, err := enode.ParseV4(node)
+		return err
+	})
+}
+
+// loadStaticNodes reads a list of ENRs from a file, one per line. Empty lines
+// and everything following a # are ignored. Every ENR is validated.
+func loadStaticNodes(path string) ([]string, error) {
+	return loadNodeList(path, "static node", func(node string) error {
+		if !strings.HasPrefix(node, "enr:") {
+			return errors.New("not an ENR")
+		}
+		_, err := enode.Parse(enode.ValidSchemes, node)
+		return err
+	})
+}
+
+// loadNodeList reads a list of nodes from a file, one per line, validating each
+// with the given function. Empty lines and everything following a # are ignored.
+func loadNodeList(path string, kind string, validate func(node string) error) ([]string, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var nodes []string
+	for i, line := range strings.Split(string(blob), "\n") {
+		if idx := strings.Index(line, "#"); idx >= 0 {
+			line = line[:idx]
+		}
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if err := validate(line); err != nil {
+			return nil, fmt.Errorf("invalid %s on line %d: %v", kind, i+1, err)
+		}
+		nodes = append(nodes, line)
+	}
+	return nodes, nil
+}
+
+// parseChainIDTransitions parses a comma separated list of block=chainid pairs.
+func parseChainIDTransitions(input string) (map[uint64]uint64, error) {
+	transitions := make(map[uint64]uint64)
+	for _, pair := range splitAndTrim(input) {
+		parts := strings.Split(pair, "=")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid chain id transition %q, want block=chainid", pair)
+		}
+		block, err := strconv.ParseUint(strings.TrimSpace(parts[0]), 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chain id transition block %q: %v", parts[0], err)
+		}
+		id, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid chain id transition id %q: %v", parts[1], err)
+		}
+		transitions[block] = id
+	}
+	return transitions, nil
+}
+
+// loadLabels reads a JSON object mapping account addresses to labels.
+func loadLabels(path string) (map[common.Address]string, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var labels map[common.Address]string
+	if err := json.Unmarshal(blob, &labels); err != nil {
+		return nil, fmt.Errorf("invalid labels file: %v", err)
+	}
+	return labels, nil
+}
+
+// parseHash parses an optional hex encoded 32 byte hash from the command line.
+func parseHash(input string, what string) (*common.Hash, error) {
+	if input == "" {
+		return nil, nil
+	}
+	blob, err := hexutil.Decode(input)
+	if err != nil || len(blob) != common.HashLength {
+		return nil, fmt.Errorf("invalid %s %q", what, input)
+	}
+	hash := common.BytesToHash(blob)
+	return &hash, nil
+}
+
+// parseSigners parses a comma separated list of Clique signer addresses,
+// rejecting duplicates. Clique requires the signers to be sorted, so an
+// unsorted list is sorted with a warning.
+func parseSigners(input string) ([]common.Address, error) {
+	var (
+		signers []common.Address
+		seen    = make(map[common.Address]bool)
+	)
+	for _, field := range splitAndTrim(input) {
+		if !common.IsHexAddress(field) {
+			return nil, fmt.Errorf("invalid signer address %q", field)
+		}
+		signer := common.HexToAddress(field)
+		if seen[signer] {
+			return nil, fmt.Errorf("duplicate signer %s", signer.Hex())
+		}
+		seen[signer] = true
+		signers = append(signers, signer)
+	}
+	sorted := func(i, j int) bool { return bytes.Compare(signers[i][:], signers[j][:]) < 0 }
+	if !sort.SliceIsSorted(signers, sorted) {
+		log.Warn("Clique signers not sorted, sorting them", "signers", len(signers))
+		sort.Slice(signers, sorted)
+	}
+	return signers, nil
+}
+
+// cliqueExtraData assembles the genesis extraData of a Clique network from the
+// list of initial signers: a 32 byte zero vanity, the sorted signer addresses
+// and a 65 byte zero seal.
+func cliqueExtraData(signers []common.Address) []byte {
+	sorted := make([]common.Address, len(signers))
+	copy(sorted, signers)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i][:], sorted[j][:]) < 0 })
+
+	extra := make([]byte, 32+len(sorted)*common.AddressLength+65)
+	for i, signer := range sorted {
+		copy(extra[32+i*common.AddressLength:], signer[:])
+	}
+	return extra
+}
+
+// cliqueSigners parses the initial signer set out of a Clique genesis extra-data,
+// which must consist of the 32 byte vanity, the signers and the 65 byte seal.
+func cliqueSigners(extra []byte) ([]common.Address, error) {
+	if len(extra) < 32+65 {
+		return nil, fmt.Errorf("invalid clique extra-data: %d bytes, need at least %d for the vanity and seal", len(extra), 32+65)
+	}
+	signers := extra[32 : len(extra)-65]
+	if len(signers)%common.AddressLength != 0 {
+		return nil, fmt.Errorf("invalid clique extra-data: signer section of %d bytes is not a multiple of %d", len(signers), common.AddressLength)
+	}
+	if len(signers) == 0 {
+		return nil, errors.New("invalid clique extra-data: no signers")
+	}
+	addrs := make([]common.Address, len(signers)/common.AddressLength)
+	for i := range addrs {
+		copy(addrs[i][:], signers[i*common.AddressLength:])
+	}
+	return addrs, nil
+}
+
+// loadGenesis reads and parses a go-orange genesis spec from a local file.
+func loadGenesis(path string) (*chainGenesis, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateAllocJSON(blob); err != nil {
+		return nil, err
+	}
+	genesis := new(chainGenesis)
+	if err := json.Unmarshal(blob, genesis); err != nil {
+		return nil, fmt.Errorf("invalid genesis spec: %v", err)
+	}
+	return genesis, nil
+}
+
+// splitAndTrim splits a comma separated list and trims the whitespace around
+// the individual entries, dropping any empty ones.
+func splitAndTrim(input string) []string {
+	var result []string
+	for _, r := range strings.Split(input, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			result = append(result, r)
+		}
+	}
+	return result
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 The go-orange Authors
+// This file is part of go-orange.
+//
+// go-orange is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-orange is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-orange. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+
+	"github.com/ong2020/go-orange/common"
+	"github.com/ong2020/go-orange/core"
+	"github.com/ong2020/go-orange/crypto"
+	"github.com/ong2020/go-orange/rlp"
+)
+
+// allocRLPEntry is a single genesis account in the RLP alloc export.
+type allocRLPEntry struct {
+	Address common.Address
+	Account allocRLPAccount
+}
+
+// allocRLPAccount is the RLP representation of a genesis account, with the
+// storage flattened into a list of slots sorted by key.
+type allocRLPAccount struct {
+	Nonce   uint64
+	Balance *big.Int
+	Code    []byte
+	Storage []allocRLPSlot
+}
+
+// allocRLPSlot is a single storage slot of a genesis account.
+type allocRLPSlot struct {
+	Key   common.Hash
+	Value common.Hash
+}
+
+// encodeAllocRLP serializes a genesis alloc into an RLP list of (address, account)
+// pairs sorted by hashed address, i.e. in the order they appear in the state trie.
+func encodeAllocRLP(alloc core.GenesisAlloc) ([]byte, error) {
+	type hashedEntry struct {
+		hash  common.Hash
+		entry allocRLPEntry
+	}
+	hashed := make([]hashedEntry, 0, len(alloc))
+	for addr, account := range alloc {
+		balance := account.Balance
+		if balance == nil {
+			balance = new(big.Int)
+		}
+		slots := make([]allocRLPSlot, 0, len(account.Storage))
+		for key, val := range account.Storage {
+			slots = append(slots, allocRLPSlot{Key: key, Value: val})
+		}
+		sort.Slice(slots, func(i, j int) bool {
+			return bytes.Compare(slots[i].Key[:], slots[j].Key[:]) < 0
+		})
+		hashed = append(hashed, hashedEntry{
+			hash: crypto.Keccak256Hash(addr[:]),
+			entry: allocRLPEntry{
+				Address: addr,
+				Account: allocRLPAccount{Nonce: account.Nonce, Balance: balance, Code: account.Code, Storage: slots},
+			},
+		})
+	}
+	sort.Slice(hashed, func(i, j int) bool {
+		return bytes.Compare(hashed[i].hash[:], hashed[j].hash[:]) < 0
+	})
+	entries := make([]allocRLPEntry, len(hashed))
+	for i, h := range hashed {
+		entries[i] = h.entry
+	}
+	return rlp.EncodeToBytes(entries)
+}
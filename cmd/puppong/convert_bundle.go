@@ -0,0 +1,138 @@
+// Copyright 2021 The go-orange Authors
+// This file is part of go-orange.
+//
+// go-orange is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-orange is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-orange. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/ong2020/go-orange/core"
+)
+
+// Names of the files within a chain spec bundle.
+const (
+	bundleManifestFile = "manifest.json"
+	bundleSpecFile     = "chainspec.json"
+	bundleAllocFile    = "alloc.json"
+	bundleCodeDir      = "code/"
+)
+
+// bundleManifest is the table of contents of a chain spec bundle.
+type bundleManifest struct {
+	Format  string       `json:"format"`
+	Network string       `json:"network"`
+	Files   []bundleFile `json:"files"`
+}
+
+// bundleFile is a single file entry in a chain spec bundle manifest.
+type bundleFile struct {
+	Name   string `json:"name"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// writeConvertBundle writes a tar archive containing the chain spec without its
+// alloc, the alloc without the contract code, a raw bytecode file for each of
+// the contracts and a manifest listing the checksums of all of them. The genesis
+// must have the overrides of the conversion already applied, so the sidecars
+// match the state root of the spec.
+func writeConvertBundle(path string, genesis *chainGenesis, conf *convertConfig, mode os.FileMode) error {
+	// Build the spec without the alloc, it's shipped as a sidecar
+	stripped := *conf
+	stripped.noAlloc = true
+
+	spec, err := convertChainSpec(genesis, &stripped)
+	if err != nil {
+		return err
+	}
+	specBlob, err := encodeChainSpec(spec, conf.canonical)
+	if err != nil {
+		return err
+	}
+	// Split the contract code off of the alloc
+	var (
+		alloc = make(core.GenesisAlloc, len(genesis.Alloc))
+		codes = make(map[string][]byte)
+	)
+	for addr, account := range genesis.Alloc {
+		if len(account.Code) > 0 {
+			codes[fmt.Sprintf("%s%x.bin", bundleCodeDir, addr)] = account.Code
+			account.Code = nil
+		}
+		alloc[addr] = account
+	}
+	allocBlob, err := json.MarshalIndent(alloc, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Assemble the file list and the manifest describing it
+	names := []string{bundleSpecFile, bundleAllocFile}
+	files := map[string][]byte{
+		bundleSpecFile:  specBlob,
+		bundleAllocFile: allocBlob,
+	}
+	var codeNames []string
+	for name, code := range codes {
+		codeNames = append(codeNames, name)
+		files[name] = code
+	}
+	sort.Strings(codeNames)
+	names = append(names, codeNames...)
+
+	manifest := bundleManifest{Format: conf.format, Network: conf.network}
+	for _, name := range names {
+		sum := sha256.Sum256(files[name])
+		manifest.Files = append(manifest.Files, bundleFile{
+			Name:   name,
+			Size:   len(files[name]),
+			SHA256: hex.EncodeToString(sum[:]),
+		})
+	}
+	manifestBlob, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	names = append([]string{bundleManifestFile}, names...)
+	files[bundleManifestFile] = manifestBlob
+
+	// Pack everything into a tar archive, manifest first
+	buf := new(bytes.Buffer)
+	tw := tar.NewWriter(buf)
+	for _, name := range names {
+		header := &tar.Header{
+			Name: name,
+			Mode: int64(mode),
+			Size: int64(len(files[name])),
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write(files[name]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return writeConvertFile(path, buf.Bytes(), mode)
+}
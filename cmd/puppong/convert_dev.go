@@ -0,0 +1,83 @@
+// Copyright 2021 The go-orange Authors
+// This file is part of go-orange.
+//
+// go-orange is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-orange is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-orange. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/ong2020/go-orange/common"
+	"github.com/ong2020/go-orange/core"
+	"github.com/ong2020/go-orange/params"
+)
+
+// devFaucet is the default faucet of dev chains, the well-known development
+// account of Parity (derived from the empty brain wallet phrase).
+var devFaucet = common.HexToAddress("0x00a329c0648769A73afAc7F9381E08FB43dBEA72")
+
+// devFaucetBalance is the balance the faucet of dev chains is funded with.
+var devFaucetBalance = new(big.Int).Mul(big.NewInt(1000000000), big.NewInt(params.Oranger))
+
+// devGasLimit is the relaxed genesis gas limit of dev chains.
+const devGasLimit = 100000000
+
+// devGenesis turns a genesis into one suitable for a local development chain,
+// funding the faucet, relaxing the gas limit and dropping the difficulty to the
+// minimum. As go-orange has no instant sealing proof-of-work mode, the genesis
+// is switched to Clique with a zero period and the faucet as the single signer
+// for the formats describing go-orange chains. The caller's genesis is left
+// unmodified.
+func devGenesis(genesis *chainGenesis, faucet common.Address, format string) *chainGenesis {
+	override := *genesis
+	override.GasLimit = devGasLimit
+	override.Difficulty = big.NewInt(1)
+
+	override.Alloc = make(core.GenesisAlloc, len(genesis.Alloc)+1)
+	for addr, account := range genesis.Alloc {
+		override.Alloc[addr] = account
+	}
+	override.Alloc[faucet] = core.GenesisAccount{Balance: new(big.Int).Set(devFaucetBalance)}
+
+	if format == "gong" || format == "toml" {
+		config := *genesis.Config
+		config.Ongash = nil
+		config.Clique = &params.CliqueConfig{Period: 0, Epoch: 30000}
+		override.Config = &config
+		override.ExtraData = cliqueExtraData([]common.Address{faucet})
+	}
+	return &override
+}
+
+// setInstantSeal switches the consensus engine of a chain spec converted from a
+// dev genesis to the instant (or fake proof-of-work) sealing of its client.
+func setInstantSeal(spec interface{}, format string) error {
+	switch spec := spec.(type) {
+	case *alongGenesisSpec:
+		spec.SealEngine = "NoProof"
+	case *parityChainSpec:
+		spec.Engine.Ongash = nil
+		spec.Engine.InstantSeal = new(parityChainSpecInstantSeal)
+	case *besuGenesisSpec:
+		difficulty := uint64(1)
+		spec.Config.Ongash.FixedDifficulty = &difficulty
+	case *chainGenesis, *params.ChainConfig:
+		// Instant sealing is already configured via Clique
+	default:
+		return fmt.Errorf("dev mode not supported by %s chain specs", format)
+	}
+	return nil
+}
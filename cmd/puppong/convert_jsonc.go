@@ -0,0 +1,113 @@
+// Copyright 2021 The go-orange Authors
+// This file is part of go-orange.
+//
+// go-orange is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-orange is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-orange. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// forkFieldComments are the explanations of the fork related fields of all the
+// supported chain spec formats, emitted as comments into annotated specs.
+var forkFieldComments = map[string]string{
+	// go-orange and Besu
+	"homesteadBlock":      "Homestead: gas cost changes and contract creation fixes (EIP-2, EIP-7)",
+	"daoForkBlock":        "DAO fork: irregular state change refunding the DAO accounts",
+	"eip150Block":         "Tangerine Whistle: IO heavy operation gas repricing (EIP-150)",
+	"eip155Block":         "Spurious Dragon: simple replay attack protection (EIP-155)",
+	"eip158Block":         "Spurious Dragon: state clearing of empty accounts (EIP-158)",
+	"byzantiumBlock":      "Byzantium: REVERT, STATICCALL, receipt status and new precompiles",
+	"constantinopleBlock": "Constantinople: CREATE2, EXTCODEHASH and bitwise shifting",
+	"petersburgBlock":     "Petersburg: Constantinople without the EIP-1283 net gas metering",
+	"istanbulBlock":       "Istanbul: gas repricings, CHAINID and SELFBALANCE opcodes",
+	"muirGlacierBlock":    "Muir Glacier: difficulty bomb delay",
+	"berlinBlock":         "Berlin: typed transactions and access lists (EIP-2718, EIP-2929, EIP-2930)",
+	"londonBlock":         "London: EIP-1559 fee market and BASEFEE opcode",
+	"shanghaiTime":        "Shanghai: withdrawals, PUSH0 and warm coinbase (timestamp)",
+	"cancunTime":          "Cancun: blob transactions, transient storage and MCOPY (timestamp)",
+
+	// Aleth
+	"homesteadForkBlock":         "Homestead: gas cost changes and contract creation fixes (EIP-2, EIP-7)",
+	"daoHardforkBlock":           "DAO fork: irregular state change refunding the DAO accounts",
+	"EIP150ForkBlock":            "Tangerine Whistle: IO heavy operation gas repricing (EIP-150)",
+	"EIP158ForkBlock":            "Spurious Dragon: replay protection and state clearing (EIP-155, EIP-158)",
+	"byzantiumForkBlock":         "Byzantium: REVERT, STATICCALL, receipt status and new precompiles",
+	"constantinopleForkBlock":    "Constantinople: CREATE2, EXTCODEHASH and bitwise shifting",
+	"constantinopleFixForkBlock": "Petersburg: Constantinople without the EIP-1283 net gas metering",
+	"istanbulForkBlock":          "Istanbul: gas repricings, CHAINID and SELFBALANCE opcodes",
+	"shanghaiForkTime":           "Shanghai: withdrawals, PUSH0 and warm coinbase (timestamp)",
+	"cancunForkTime":             "Cancun: blob transactions, transient storage and MCOPY (timestamp)",
+
+	// Parity
+	"homesteadTransition":        "Homestead: gas cost changes and contract creation fixes (EIP-2, EIP-7)",
+	"eip100bTransition":          "Byzantium: difficulty adjustment including uncles (EIP-100)",
+	"eip150Transition":           "Tangerine Whistle: IO heavy operation gas repricing (EIP-150)",
+	"eip160Transition":           "Spurious Dragon: EXP cost increase (EIP-160)",
+	"eip161abcTransition":        "Spurious Dragon: state clearing of empty accounts (EIP-161)",
+	"eip161dTransition":          "Spurious Dragon: state clearing of empty accounts (EIP-161)",
+	"eip155Transition":           "Spurious Dragon: simple replay attack protection (EIP-155)",
+	"maxCodeSizeTransition":      "Spurious Dragon: contract code size limit (EIP-170)",
+	"eip140Transition":           "Byzantium: REVERT opcode (EIP-140)",
+	"eip211Transition":           "Byzantium: RETURNDATASIZE and RETURNDATACOPY (EIP-211)",
+	"eip214Transition":           "Byzantium: STATICCALL opcode (EIP-214)",
+	"eip658Transition":           "Byzantium: receipt status code (EIP-658)",
+	"eip145Transition":           "Constantinople: bitwise shifting (EIP-145)",
+	"eip1014Transition":          "Constantinople: CREATE2 opcode (EIP-1014)",
+	"eip1052Transition":          "Constantinople: EXTCODEHASH opcode (EIP-1052)",
+	"eip1283Transition":          "Constantinople: net gas metering for SSTORE (EIP-1283)",
+	"eip1283DisableTransition":   "Petersburg: net gas metering for SSTORE removed",
+	"eip1283ReenableTransition":  "Istanbul: net gas metering for SSTORE reenabled (EIP-2200)",
+	"eip1344Transition":          "Istanbul: CHAINID opcode (EIP-1344)",
+	"eip1884Transition":          "Istanbul: trie size dependent opcode repricing (EIP-1884)",
+	"eip2028Transition":          "Istanbul: calldata gas cost reduction (EIP-2028)",
+	"eip1559Transition":          "London: fee market change (EIP-1559)",
+	"eip3198Transition":          "London: BASEFEE opcode (EIP-3198)",
+	"eip3529Transition":          "London: reduction in refunds (EIP-3529)",
+	"eip3541Transition":          "London: reject contracts starting with 0xEF (EIP-3541)",
+	"eip3651TransitionTimestamp": "Shanghai: warm coinbase (EIP-3651)",
+	"eip3855TransitionTimestamp": "Shanghai: PUSH0 opcode (EIP-3855)",
+	"eip3860TransitionTimestamp": "Shanghai: initcode size limit and metering (EIP-3860)",
+	"eip4895TransitionTimestamp": "Shanghai: beacon chain withdrawals (EIP-4895)",
+	"eip1153TransitionTimestamp": "Cancun: transient storage opcodes (EIP-1153)",
+	"eip4788TransitionTimestamp": "Cancun: beacon block root in the EVM (EIP-4788)",
+	"eip4844TransitionTimestamp": "Cancun: shard blob transactions (EIP-4844)",
+	"eip5656TransitionTimestamp": "Cancun: MCOPY opcode (EIP-5656)",
+	"eip6780TransitionTimestamp": "Cancun: SELFDESTRUCT only in same transaction (EIP-6780)",
+}
+
+// jsoncFieldRegexp matches a line of indented JSON starting with an object key.
+var jsoncFieldRegexp = regexp.MustCompile(`^(\s*)"([^"]+)":`)
+
+// annotateJSON inserts a // comment line above each of the fork fields of an
+// indented JSON chain spec, explaining what the fork enables. The result is
+// JSONC, which any JSON parser can read after stripping the comments.
+func annotateJSON(blob []byte) []byte {
+	var out bytes.Buffer
+	for i, line := range bytes.Split(blob, []byte("\n")) {
+		if i > 0 {
+			out.WriteByte('\n')
+		}
+		if match := jsoncFieldRegexp.FindSubmatch(line); match != nil {
+			if comment, ok := forkFieldComments[string(match[2])]; ok {
+				out.Write(match[1])
+				out.WriteString("// " + comment + "\n")
+			}
+		}
+		out.Write(line)
+	}
+	return out.Bytes()
+}
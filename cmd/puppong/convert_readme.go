@@ -0,0 +1,141 @@
+// Copyright 2021 The go-orange Authors
+// This file is part of go-orange.
+//
+// go-orange is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-orange is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-orange. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+	"text/template"
+
+	"github.com/ong2020/go-orange/common"
+)
+
+// readmeContent is the markdown template used to summarize a converted network
+// for operators joining it.
+var readmeContent = `# {{.Network}}
+
+This file was generated from the genesis of the network, do not edit it manually.
+
+## Chain
+
+| Property     | Value |
+|--------------|-------|
+| Chain ID     | {{.ChainID}} |
+| Genesis hash | ` + "`{{.GenesisHash}}`" + ` |
+| Gas limit    | {{.GasLimit}} |
+
+## Forks
+
+{{if .Forks}}| Fork | Activation |
+|------|------------|
+{{range .Forks}}| {{.Name}} | {{.Activation}} |
+{{end}}{{else}}No forks are scheduled.
+{{end}}
+## Bootnodes
+
+{{if .Bootnodes}}{{range .Bootnodes}}- ` + "`{{.}}`" + `
+{{end}}{{else}}No bootnodes are configured.
+{{end}}
+## Funded accounts
+
+{{if .Accounts}}| Address | Balance (wei) |
+|---------|---------------|
+{{range .Accounts}}| ` + "`{{.Address}}`" + ` | {{.Balance}} |
+{{end}}{{else}}No accounts are funded at genesis.
+{{end}}`
+
+// readmeFork is a single fork activation listed in the generated README.
+type readmeFork struct {
+	Name       string
+	Activation string
+}
+
+// readmeAccount is a single funded account listed in the generated README.
+type readmeAccount struct {
+	Address common.Address
+	Balance *big.Int
+}
+
+// generateReadme creates a markdown document summarizing the network defined
+// by the genesis: its chain id, fork schedule, bootnodes and funded accounts.
+func generateReadme(network string, genesis *chainGenesis, bootnodes []string) ([]byte, error) {
+	config := genesis.Config
+
+	// Collect the scheduled forks, block based ones first
+	var forks []readmeFork
+	for _, fork := range []struct {
+		name  string
+		block *big.Int
+	}{
+		{"Homestead", config.HomesteadBlock},
+		{"DAO", config.DAOForkBlock},
+		{"EIP150", config.EIP150Block},
+		{"EIP155", config.EIP155Block},
+		{"EIP158", config.EIP158Block},
+		{"Byzantium", config.ByzantiumBlock},
+		{"Constantinople", config.ConstantinopleBlock},
+		{"Petersburg", config.PetersburgBlock},
+		{"Istanbul", config.IstanbulBlock},
+		{"Muir Glacier", config.MuirGlacierBlock},
+		{"Berlin", config.BerlinBlock},
+	} {
+		if fork.block != nil {
+			forks = append(forks, readmeFork{Name: fork.name, Activation: fmt.Sprintf("block %v", fork.block)})
+		}
+	}
+	for _, fork := range []struct {
+		name string
+		time *uint64
+	}{
+		{"Shanghai", genesis.Forks.ShanghaiTime},
+		{"Cancun", genesis.Forks.CancunTime},
+	} {
+		if fork.time != nil {
+			forks = append(forks, readmeFork{Name: fork.name, Activation: fmt.Sprintf("timestamp %d", *fork.time)})
+		}
+	}
+	// Collect the funded accounts, ordered by address
+	var accounts []readmeAccount
+	for addr, account := range genesis.Alloc {
+		if account.Balance != nil && account.Balance.Sign() > 0 {
+			accounts = append(accounts, readmeAccount{Address: addr, Balance: account.Balance})
+		}
+	}
+	sort.Slice(accounts, func(i, j int) bool {
+		return bytes.Compare(accounts[i].Address[:], accounts[j].Address[:]) < 0
+	})
+	hash, err := GenesisHash(genesis)
+	if err != nil {
+		return nil, err
+	}
+	readme := new(bytes.Buffer)
+	err = template.Must(template.New("").Parse(readmeContent)).Execute(readme, map[string]interface{}{
+		"Network":     network,
+		"ChainID":     config.ChainID,
+		"GenesisHash": hash.Hex(),
+		"GasLimit":    genesis.GasLimit,
+		"Forks":       forks,
+		"Bootnodes":   bootnodes,
+		"Accounts":    accounts,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return readme.Bytes(), nil
+}
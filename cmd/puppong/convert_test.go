@@ -0,0 +1,1660 @@
+// Copyright 2021 The go-orange Authors
+// This file is part of go-orange.
+//
+// go-orange is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-orange is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-orange. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/naoina/toml"
+	"github.com/ong2020/go-orange/common"
+	"github.com/ong2020/go-orange/common/hexutil"
+	"github.com/ong2020/go-orange/core"
+	"github.com/ong2020/go-orange/crypto"
+	"github.com/ong2020/go-orange/log"
+	"github.com/ong2020/go-orange/p2p/enode"
+	"github.com/ong2020/go-orange/p2p/enr"
+	"github.com/ong2020/go-orange/params"
+	"github.com/ong2020/go-orange/rlp"
+	"gopkg.in/urfave/cli.v1"
+	"gopkg.in/yaml.v3"
+)
+
+// makeConvertDir creates a temporary folder for conversion outputs.
+func makeConvertDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "puppong-convert-")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+// Tests that the network descriptor is emitted alongside the chain spec.
+func TestConvertDescriptor(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	dir := makeConvertDir(t)
+	bootnodes := []string{"enode://a979fb575495b8d6db44f750317d0f4622bf4c2aa3365d6af7c284339968eef29b69ad0dce72a4d8db5ebb4968de0e3bec910127f134779fbcb0cb6d3331163c@52.16.188.185:30303"}
+	conf := &convertConfig{
+		network:    "stureby",
+		format:     "parity",
+		output:     filepath.Join(dir, "stureby-parity.json"),
+		bootnodes:  bootnodes,
+		descriptor: filepath.Join(dir, "stureby-descriptor.json"),
+	}
+	if err := runConvert(genesis, conf); err != nil {
+		t.Fatalf("conversion failed: %v", err)
+	}
+	blob, err := ioutil.ReadFile(conf.descriptor)
+	if err != nil {
+		t.Fatalf("failed to read descriptor: %v", err)
+	}
+	var desc networkDescriptor
+	if err := json.Unmarshal(blob, &desc); err != nil {
+		t.Fatalf("failed to parse descriptor: %v", err)
+	}
+	if desc.Name != "stureby" {
+		t.Errorf("name mismatch: have %s, want %s", desc.Name, "stureby")
+	}
+	if desc.ChainID != 314158 {
+		t.Errorf("chain id mismatch: have %d, want %d", desc.ChainID, 314158)
+	}
+	if desc.NetworkID != 314158 {
+		t.Errorf("network id mismatch: have %d, want %d", desc.NetworkID, 314158)
+	}
+	if want := genesis.ToBlock(nil).Hash(); desc.GenesisHash != want {
+		t.Errorf("genesis hash mismatch: have %x, want %x", desc.GenesisHash, want)
+	}
+	if !reflect.DeepEqual(desc.Bootnodes, bootnodes) {
+		t.Errorf("bootnodes mismatch: have %v, want %v", desc.Bootnodes, bootnodes)
+	}
+}
+
+// Tests that the checksum sidecar matches the emitted chain spec and that the
+// detached signature recovers to the signing key.
+func TestConvertChecksum(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	dir := makeConvertDir(t)
+
+	key, _ := crypto.GenerateKey()
+	keyfile := filepath.Join(dir, "signer.key")
+	if err := crypto.SaveECDSA(keyfile, key); err != nil {
+		t.Fatalf("failed to save signing key: %v", err)
+	}
+	conf := &convertConfig{
+		network:  "stureby",
+		format:   "parity",
+		output:   filepath.Join(dir, "stureby-parity.json"),
+		checksum: true,
+		signer:   keyfile,
+	}
+	if err := runConvert(genesis, conf); err != nil {
+		t.Fatalf("conversion failed: %v", err)
+	}
+	spec, err := ioutil.ReadFile(conf.output)
+	if err != nil {
+		t.Fatalf("failed to read chain spec: %v", err)
+	}
+	sidecar, err := ioutil.ReadFile(conf.output + ".sha256")
+	if err != nil {
+		t.Fatalf("failed to read checksum: %v", err)
+	}
+	if want := fmt.Sprintf("%x  stureby-parity.json\n", sha256.Sum256(spec)); string(sidecar) != want {
+		t.Errorf("checksum mismatch: have %q, want %q", sidecar, want)
+	}
+	blob, err := ioutil.ReadFile(conf.output + ".sig")
+	if err != nil {
+		t.Fatalf("failed to read signature: %v", err)
+	}
+	sig, err := hexutil.Decode(strings.TrimSpace(string(blob)))
+	if err != nil {
+		t.Fatalf("failed to decode signature: %v", err)
+	}
+	pub, err := crypto.SigToPub(crypto.Keccak256(spec), sig)
+	if err != nil {
+		t.Fatalf("failed to recover signer: %v", err)
+	}
+	if have, want := crypto.PubkeyToAddress(*pub), crypto.PubkeyToAddress(key.PublicKey); have != want {
+		t.Errorf("signer mismatch: have %x, want %x", have, want)
+	}
+}
+
+// Tests that chain id transitions are emitted into Parity chain specs and are
+// rejected for formats not supporting them.
+func TestConvertChainIDTransitions(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	transitions, err := parseChainIDTransitions("60000=314159, 0x11170=314160")
+	if err != nil {
+		t.Fatalf("failed to parse transitions: %v", err)
+	}
+	dir := makeConvertDir(t)
+	conf := &convertConfig{
+		network:            "stureby",
+		format:             "parity",
+		output:             filepath.Join(dir, "stureby-parity.json"),
+		chainIDTransitions: transitions,
+	}
+	if err := runConvert(genesis, conf); err != nil {
+		t.Fatalf("conversion failed: %v", err)
+	}
+	blob, err := ioutil.ReadFile(conf.output)
+	if err != nil {
+		t.Fatalf("failed to read chain spec: %v", err)
+	}
+	var spec parityChainSpec
+	if err := json.Unmarshal(blob, &spec); err != nil {
+		t.Fatalf("failed to parse chain spec: %v", err)
+	}
+	want := map[string]hexutil.Uint64{"0xea60": 314159, "0x11170": 314160}
+	if !reflect.DeepEqual(spec.Params.ChainIDTransitions, want) {
+		t.Errorf("chain id transitions mismatch: have %v, want %v", spec.Params.ChainIDTransitions, want)
+	}
+	if uint64(spec.Params.ChainID) != 314158 {
+		t.Errorf("genesis chain id mismatch: have %d, want %d", spec.Params.ChainID, 314158)
+	}
+	conf.format = "along"
+	if err := runConvert(genesis, conf); err == nil {
+		t.Errorf("along conversion succeeded with chain id transitions")
+	}
+	if _, err := parseChainIDTransitions("60000"); err == nil {
+		t.Errorf("malformed transition accepted")
+	}
+}
+
+// Tests that bootnodes are loaded from a file, skipping comments and empty
+// lines and rejecting malformed entries.
+func TestLoadBootnodes(t *testing.T) {
+	dir := makeConvertDir(t)
+
+	var (
+		node1 = "enode://a979fb575495b8d6db44f750317d0f4622bf4c2aa3365d6af7c284339968eef29b69ad0dce72a4d8db5ebb4968de0e3bec910127f134779fbcb0cb6d3331163c@52.16.188.185:30303"
+		node2 = "enode://3f1d12044546b76342d59d4a05532c14b85aa669704bfe1f864fe079415aa2c02d743e03218e57a33fb94523adb54032871a6c51b2cc5514cb7c7e35b3ed0a99@13.93.211.84:30303"
+	)
+	path := filepath.Join(dir, "bootnodes.txt")
+	content := "# Stureby bootnodes\n" + node1 + "\n\n  " + node2 + "  # secondary\n# " + node1 + "\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write bootnodes: %v", err)
+	}
+	nodes, err := loadBootnodes(path)
+	if err != nil {
+		t.Fatalf("failed to load bootnodes: %v", err)
+	}
+	if want := []string{node1, node2}; !reflect.DeepEqual(nodes, want) {
+		t.Fatalf("bootnodes mismatch: have %v, want %v", nodes, want)
+	}
+	if err := ioutil.WriteFile(path, []byte(node1+"\nenode://invalid\n"), 0644); err != nil {
+		t.Fatalf("failed to write bootnodes: %v", err)
+	}
+	if _, err := loadBootnodes(path); err == nil {
+		t.Fatalf("invalid bootnode accepted")
+	}
+}
+
+// Tests that the genesis parent hash can be overridden in both chain specs.
+func TestConvertParentHash(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	dir := makeConvertDir(t)
+	parent := common.HexToHash("0xd4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3")
+
+	for _, format := range []string{"along", "parity"} {
+		conf := &convertConfig{
+			network:    "stureby",
+			format:     format,
+			output:     filepath.Join(dir, "stureby-"+format+".json"),
+			parentHash: &parent,
+		}
+		if err := runConvert(genesis, conf); err != nil {
+			t.Fatalf("%s: conversion failed: %v", format, err)
+		}
+		blob, err := ioutil.ReadFile(conf.output)
+		if err != nil {
+			t.Fatalf("%s: failed to read chain spec: %v", format, err)
+		}
+		var spec struct {
+			Genesis struct {
+				ParentHash common.Hash `json:"parentHash"`
+			} `json:"genesis"`
+		}
+		if err := json.Unmarshal(blob, &spec); err != nil {
+			t.Fatalf("%s: failed to parse chain spec: %v", format, err)
+		}
+		if spec.Genesis.ParentHash != parent {
+			t.Errorf("%s: parent hash mismatch: have %x, want %x", format, spec.Genesis.ParentHash, parent)
+		}
+	}
+	if genesis.ParentHash != (common.Hash{}) {
+		t.Errorf("source genesis modified: parent hash %x", genesis.ParentHash)
+	}
+}
+
+// Tests that the alloc can be omitted from the chain specs while keeping the
+// genesis state root of the full alloc.
+func TestConvertNoAlloc(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	genesis.Alloc[common.HexToAddress("0xdead")] = core.GenesisAccount{Balance: big.NewInt(1000)}
+	root := genesis.ToBlock(nil).Root()
+
+	conf := &convertConfig{network: "stureby", format: "along", noAlloc: true}
+	spec, err := buildChainSpec(genesis, conf)
+	if err != nil {
+		t.Fatalf("along conversion failed: %v", err)
+	}
+	along := spec.(*alongGenesisSpec)
+	if along.Genesis.StateRoot == nil || *along.Genesis.StateRoot != root {
+		t.Errorf("along state root mismatch: have %v, want %x", along.Genesis.StateRoot, root)
+	}
+	for addr, account := range along.Accounts {
+		if account.Balance != nil {
+			t.Errorf("along alloc account %x emitted", addr)
+		}
+	}
+	conf.format = "parity"
+	if spec, err = buildChainSpec(genesis, conf); err != nil {
+		t.Fatalf("parity conversion failed: %v", err)
+	}
+	parity := spec.(*parityChainSpec)
+	if parity.Genesis.StateRoot == nil || *parity.Genesis.StateRoot != root {
+		t.Errorf("parity state root mismatch: have %v, want %x", parity.Genesis.StateRoot, root)
+	}
+	if _, ok := parity.Accounts[common.UnprefixedAddress(common.HexToAddress("0xdead"))]; ok {
+		t.Errorf("parity alloc account emitted")
+	}
+	if len(genesis.Alloc) == 0 {
+		t.Errorf("source genesis alloc stripped")
+	}
+}
+
+// Tests that semantically equal chain specs produce byte-identical canonical
+// output, independent of key order and number representation.
+func TestCanonicalJSON(t *testing.T) {
+	var a, b interface{}
+	if err := json.Unmarshal([]byte(`{"params":{"chainID":314158,"durationLimit":"0xD","gasLimitBoundDivisor":"0x0400"},"accounts":{"0xAbC1":{"balance":"1000","code":"0x0060"}},"genesis":{"difficulty":"0x00a","extraData":"0x00","mixHash":"0x0000000000000000000000000000000000000000000000000000000000000001"},"name":"Stureby"}`), &a); err != nil {
+		t.Fatalf("failed to parse spec: %v", err)
+	}
+	if err := json.Unmarshal([]byte(`{"name":"Stureby","genesis":{"mixHash":"0x0000000000000000000000000000000000000000000000000000000000000001","extraData":"0x00","difficulty":"10"},"accounts":{"0xabc1":{"code":"0x0060","balance":"0x3E8"}},"params":{"gasLimitBoundDivisor":1024,"durationLimit":13,"chainID":"0x4cb2e"}}`), &b); err != nil {
+		t.Fatalf("failed to parse spec: %v", err)
+	}
+	encA, err := canonicalJSON(a)
+	if err != nil {
+		t.Fatalf("failed to canonicalize spec: %v", err)
+	}
+	encB, err := canonicalJSON(b)
+	if err != nil {
+		t.Fatalf("failed to canonicalize spec: %v", err)
+	}
+	if !bytes.Equal(encA, encB) {
+		t.Fatalf("canonical specs differ:\n%s\n%s", encA, encB)
+	}
+	want := `{
+  "accounts": {
+    "0xabc1": {
+      "balance": "0x3e8",
+      "code": "0x0060"
+    }
+  },
+  "genesis": {
+    "difficulty": "0xa",
+    "extraData": "0x00",
+    "mixHash": "0x0000000000000000000000000000000000000000000000000000000000000001"
+  },
+  "name": "Stureby",
+  "params": {
+    "chainID": "0x4cb2e",
+    "durationLimit": "0xd",
+    "gasLimitBoundDivisor": "0x400"
+  }
+}`
+	if string(encA) != want {
+		t.Fatalf("canonical spec mismatch:\nhave %s\nwant %s", encA, want)
+	}
+	// Byte data differing only in leading zeroes and free text looking like
+	// numbers must not be conflated
+	for _, pair := range [][2]string{
+		{`{"code":"0x60"}`, `{"code":"0x0060"}`},
+		{`{"extraData":"0x"}`, `{"extraData":"0x00"}`},
+		{`{"name":"10"}`, `{"name":"0xa"}`},
+		{`{"dataDir":"1337"}`, `{"dataDir":"0x539"}`},
+	} {
+		var x, y interface{}
+		json.Unmarshal([]byte(pair[0]), &x)
+		json.Unmarshal([]byte(pair[1]), &y)
+
+		encX, err := canonicalJSON(x)
+		if err != nil {
+			t.Fatalf("failed to canonicalize spec: %v", err)
+		}
+		encY, err := canonicalJSON(y)
+		if err != nil {
+			t.Fatalf("failed to canonicalize spec: %v", err)
+		}
+		if bytes.Equal(encX, encY) {
+			t.Errorf("distinct values conflated: %s and %s", pair[0], pair[1])
+		}
+	}
+	// Numeric looking network names must be kept as they are, while block keyed
+	// quantities are normalized
+	var c interface{}
+	json.Unmarshal([]byte(`{"name":"1337","blockReward":{"0x00":"1000","0xA":"0x0"}}`), &c)
+	encC, err := canonicalJSON(c)
+	if err != nil {
+		t.Fatalf("failed to canonicalize spec: %v", err)
+	}
+	want = `{
+  "blockReward": {
+    "0x0": "0x3e8",
+    "0xa": "0x0"
+  },
+  "name": "1337"
+}`
+	if string(encC) != want {
+		t.Fatalf("canonical spec mismatch:\nhave %s\nwant %s", encC, want)
+	}
+}
+
+// Tests that the written chain spec files carry the requested permissions.
+func TestConvertFileMode(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	dir := makeConvertDir(t)
+
+	for _, mode := range []os.FileMode{0, 0600} {
+		conf := &convertConfig{
+			network:  "stureby",
+			format:   "parity",
+			output:   filepath.Join(dir, "stureby.json"),
+			checksum: true,
+			fileMode: mode,
+		}
+		if err := runConvert(genesis, conf); err != nil {
+			t.Fatalf("mode %o: conversion failed: %v", mode, err)
+		}
+		want := mode
+		if want == 0 {
+			want = 0644
+		}
+		for _, path := range []string{conf.output, conf.output + ".sha256"} {
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("mode %o: failed to stat %s: %v", mode, path, err)
+			}
+			if have := info.Mode().Perm(); have != want {
+				t.Errorf("mode %o: %s permission mismatch: have %o, want %o", mode, path, have, want)
+			}
+		}
+	}
+}
+
+// Tests that the precompiles active at genesis follow the configured forks.
+func TestGenesisPrecompiles(t *testing.T) {
+	names := func(precompiles []precompile) []string {
+		var names []string
+		for _, precompile := range precompiles {
+			names = append(names, precompile.name)
+		}
+		return names
+	}
+	// Stureby activates Byzantium later, so only the Homestead set is active
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	want := []string{"ecrecover", "sha256", "ripemd160", "identity"}
+	if have := names(genesisPrecompiles(genesis.Config)); !reflect.DeepEqual(have, want) {
+		t.Errorf("homestead precompiles mismatch: have %v, want %v", have, want)
+	}
+	// Activating Byzantium at genesis must list modexp and the bn256 curve ops
+	config := *genesis.Config
+	config.HomesteadBlock = big.NewInt(0)
+	config.EIP150Block = big.NewInt(0)
+	config.EIP155Block = big.NewInt(0)
+	config.EIP158Block = big.NewInt(0)
+	config.ByzantiumBlock = big.NewInt(0)
+
+	precompiles := genesisPrecompiles(&config)
+	want = []string{"ecrecover", "sha256", "ripemd160", "identity", "modexp", "bn256Add", "bn256ScalarMul", "bn256Pairing"}
+	if have := names(precompiles); !reflect.DeepEqual(have, want) {
+		t.Errorf("byzantium precompiles mismatch: have %v, want %v", have, want)
+	}
+	for i, precompile := range precompiles {
+		if want := common.BytesToAddress([]byte{byte(i + 1)}); precompile.address != want {
+			t.Errorf("precompile %d: address mismatch: have %x, want %x", i, precompile.address, want)
+		}
+	}
+}
+
+// Tests that the Clique difficulty override is emitted in both chain specs and
+// that non-positive difficulties are rejected.
+func TestConvertCliqueDifficulty(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	conf := &convertConfig{network: "stureby", format: "along", cliqueDifficulty: big.NewInt(2)}
+	spec, err := buildChainSpec(genesis, conf)
+	if err != nil {
+		t.Fatalf("along conversion failed: %v", err)
+	}
+	if have := spec.(*alongGenesisSpec).Genesis.Difficulty.ToInt(); have.Cmp(big.NewInt(2)) != 0 {
+		t.Errorf("along difficulty mismatch: have %v, want %v", have, 2)
+	}
+	conf.format = "parity"
+	if spec, err = buildChainSpec(genesis, conf); err != nil {
+		t.Fatalf("parity conversion failed: %v", err)
+	}
+	if have := spec.(*parityChainSpec).Genesis.Difficulty.ToInt(); have.Cmp(big.NewInt(2)) != 0 {
+		t.Errorf("parity difficulty mismatch: have %v, want %v", have, 2)
+	}
+	if genesis.Difficulty.Cmp(big.NewInt(2)) == 0 {
+		t.Errorf("source genesis difficulty modified")
+	}
+	for _, difficulty := range []*big.Int{big.NewInt(0), big.NewInt(-1)} {
+		conf.cliqueDifficulty = difficulty
+		if _, err := buildChainSpec(genesis, conf); err == nil {
+			t.Errorf("difficulty %v accepted", difficulty)
+		}
+	}
+}
+
+// Tests that the chain spec bundle contains the alloc-less spec, the alloc and
+// code sidecars, and a manifest matching all of them.
+func TestConvertBundle(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	contract := common.HexToAddress("0xc0de")
+	genesis.Alloc[contract] = core.GenesisAccount{Balance: big.NewInt(1), Code: []byte{0x60, 0x00}}
+
+	dir := makeConvertDir(t)
+	conf := &convertConfig{
+		network: "stureby",
+		format:  "parity",
+		bundle:  filepath.Join(dir, "stureby.tar"),
+	}
+	if err := runConvert(genesis, conf); err != nil {
+		t.Fatalf("conversion failed: %v", err)
+	}
+	// Unpack the bundle and check the manifest against the contents
+	archive, err := os.Open(conf.bundle)
+	if err != nil {
+		t.Fatalf("failed to open bundle: %v", err)
+	}
+	defer archive.Close()
+
+	var (
+		names []string
+		files = make(map[string][]byte)
+		tr    = tar.NewReader(archive)
+	)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read bundle: %v", err)
+		}
+		blob, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", header.Name, err)
+		}
+		names = append(names, header.Name)
+		files[header.Name] = blob
+	}
+	codeFile := fmt.Sprintf("code/%x.bin", contract)
+	if want := []string{"manifest.json", "chainspec.json", "alloc.json", codeFile}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("bundle contents mismatch: have %v, want %v", names, want)
+	}
+	var manifest bundleManifest
+	if err := json.Unmarshal(files["manifest.json"], &manifest); err != nil {
+		t.Fatalf("failed to parse manifest: %v", err)
+	}
+	if manifest.Format != "parity" || manifest.Network != "stureby" || len(manifest.Files) != 3 {
+		t.Fatalf("manifest mismatch: %+v", manifest)
+	}
+	for _, file := range manifest.Files {
+		sum := sha256.Sum256(files[file.Name])
+		if file.SHA256 != fmt.Sprintf("%x", sum) || file.Size != len(files[file.Name]) {
+			t.Errorf("manifest entry %s mismatch", file.Name)
+		}
+	}
+	// The spec must be alloc-less but retain the state root
+	var spec parityChainSpec
+	if err := json.Unmarshal(files["chainspec.json"], &spec); err != nil {
+		t.Fatalf("failed to parse chain spec: %v", err)
+	}
+	if root := genesis.ToBlock(nil).Root(); spec.Genesis.StateRoot == nil || *spec.Genesis.StateRoot != root {
+		t.Errorf("state root mismatch: have %v, want %x", spec.Genesis.StateRoot, root)
+	}
+	if _, ok := spec.Accounts[common.UnprefixedAddress(contract)]; ok {
+		t.Errorf("alloc account embedded in the bundled chain spec")
+	}
+	// The sidecars must reassemble the original alloc
+	var alloc core.GenesisAlloc
+	if err := json.Unmarshal(files["alloc.json"], &alloc); err != nil {
+		t.Fatalf("failed to parse alloc: %v", err)
+	}
+	if len(alloc[contract].Code) != 0 {
+		t.Errorf("code embedded in the bundled alloc")
+	}
+	account := alloc[contract]
+	account.Code = files[codeFile]
+	alloc[contract] = account
+	if !reflect.DeepEqual(alloc, genesis.Alloc) {
+		t.Errorf("reassembled alloc mismatch")
+	}
+}
+
+// Tests that bundles ship the alloc with the genesis overrides applied, matching
+// the state root of the bundled chain spec.
+func TestConvertBundleOverrides(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	empty := common.HexToAddress("0xdead")
+	genesis.Alloc[empty] = core.GenesisAccount{Balance: new(big.Int)}
+
+	dir := makeConvertDir(t)
+	conf := &convertConfig{
+		network:   "stureby",
+		format:    "parity",
+		bundle:    filepath.Join(dir, "stureby.tar"),
+		dropEmpty: true,
+		dev:       true,
+	}
+	if err := runConvert(genesis, conf); err != nil {
+		t.Fatalf("conversion failed: %v", err)
+	}
+	archive, err := os.Open(conf.bundle)
+	if err != nil {
+		t.Fatalf("failed to open bundle: %v", err)
+	}
+	defer archive.Close()
+
+	files := make(map[string][]byte)
+	for tr := tar.NewReader(archive); ; {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read bundle: %v", err)
+		}
+		if files[header.Name], err = ioutil.ReadAll(tr); err != nil {
+			t.Fatalf("failed to read %s: %v", header.Name, err)
+		}
+	}
+	var alloc core.GenesisAlloc
+	if err := json.Unmarshal(files["alloc.json"], &alloc); err != nil {
+		t.Fatalf("failed to parse alloc: %v", err)
+	}
+	if _, ok := alloc[empty]; ok {
+		t.Errorf("dropped empty account shipped in the bundled alloc")
+	}
+	if account, ok := alloc[devFaucet]; !ok || account.Balance.Cmp(devFaucetBalance) != 0 {
+		t.Errorf("dev faucet missing from the bundled alloc")
+	}
+	var spec parityChainSpec
+	if err := json.Unmarshal(files["chainspec.json"], &spec); err != nil {
+		t.Fatalf("failed to parse chain spec: %v", err)
+	}
+	shipped := genesis.Genesis
+	shipped.Alloc = alloc
+	if root := shipped.ToBlock(nil).Root(); spec.Genesis.StateRoot == nil || *spec.Genesis.StateRoot != root {
+		t.Errorf("state root mismatch: have %v, want %x", spec.Genesis.StateRoot, root)
+	}
+}
+
+// Tests that the minimum client version is recorded in the chain spec metadata
+// without affecting the genesis.
+func TestConvertMinClientVersion(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	for _, format := range []string{"along", "parity"} {
+		conf := &convertConfig{network: "stureby", format: format, minClientVersion: "v1.10.2"}
+		spec, err := buildChainSpec(genesis, conf)
+		if err != nil {
+			t.Fatalf("%s: conversion failed: %v", format, err)
+		}
+		blob, _ := json.Marshal(spec)
+
+		var meta struct {
+			Meta struct {
+				MinClientVersion string `json:"minClientVersion"`
+			} `json:"meta"`
+		}
+		if err := json.Unmarshal(blob, &meta); err != nil {
+			t.Fatalf("%s: failed to parse chain spec: %v", format, err)
+		}
+		if meta.Meta.MinClientVersion != "v1.10.2" {
+			t.Errorf("%s: min client version mismatch: have %q, want %q", format, meta.Meta.MinClientVersion, "v1.10.2")
+		}
+	}
+	conf := &convertConfig{network: "stureby", format: "parity", minClientVersion: "latest"}
+	if _, err := buildChainSpec(genesis, conf); err == nil {
+		t.Errorf("invalid client version accepted")
+	}
+	conf = &convertConfig{network: "stureby", format: "pyorange", minClientVersion: "v1.10.2"}
+	if _, err := buildChainSpec(genesis, conf); err == nil {
+		t.Errorf("metadata accepted for pyorange spec")
+	}
+}
+
+// Tests that conversion fails if the genesis hash doesn't match the expected one.
+func TestConvertExpectGenesisHash(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	hash := genesis.ToBlock(nil).Hash()
+
+	conf := &convertConfig{network: "stureby", format: "parity", expectGenesisHash: &hash}
+	if _, err := buildChainSpec(genesis, conf); err != nil {
+		t.Fatalf("matching genesis hash rejected: %v", err)
+	}
+	wrong := common.Hash{0xde, 0xad}
+	conf.expectGenesisHash = &wrong
+	if _, err := buildChainSpec(genesis, conf); err == nil {
+		t.Fatalf("mismatching genesis hash accepted")
+	}
+	// Overrides must be taken into account when computing the hash
+	conf.expectGenesisHash, conf.parentHash = &hash, &common.Hash{0x01}
+	if _, err := buildChainSpec(genesis, conf); err == nil {
+		t.Fatalf("pre-override genesis hash accepted")
+	}
+}
+
+// Tests that the genesis hash is computed correctly and embedded into the chain
+// spec metadata, even if the alloc is omitted.
+func TestConvertEmbedGenesisHash(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	want := common.HexToHash("0x4b0ec8be30644165a6448416c207bca29ec8a5030a6682b9d23263296a9c853e")
+	if hash, err := GenesisHash(genesis); err != nil || hash != want {
+		t.Fatalf("stureby genesis hash mismatch: have %x, want %x", hash, want)
+	}
+	for _, format := range []string{"along", "parity"} {
+		for _, noAlloc := range []bool{false, true} {
+			conf := &convertConfig{network: "stureby", format: format, embedGenesisHash: true, noAlloc: noAlloc}
+			spec, err := buildChainSpec(genesis, conf)
+			if err != nil {
+				t.Fatalf("%s: conversion failed: %v", format, err)
+			}
+			meta, err := chainSpecMetadata(spec, format)
+			if err != nil {
+				t.Fatalf("%s: failed to retrieve metadata: %v", format, err)
+			}
+			if meta.GenesisHash == nil || *meta.GenesisHash != want {
+				t.Errorf("%s (no alloc %v): embedded genesis hash mismatch: have %v, want %x", format, noAlloc, meta.GenesisHash, want)
+			}
+		}
+	}
+	conf := &convertConfig{network: "stureby", format: "pyorange", embedGenesisHash: true}
+	if _, err := buildChainSpec(genesis, conf); err == nil {
+		t.Fatalf("genesis hash embedded into pyorange spec")
+	}
+}
+
+// Tests that the generated README summarizes the network.
+func TestConvertReadme(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	dir := makeConvertDir(t)
+
+	bootnode := "enode://a979fb575495b8d6db44f750317d0f4622bf4c2aa3365d6af7c284339968eef29b69ad0dce72a4d8db5ebb4968de0e3bec910127f134779fbcb0cb6d3331163c@52.16.188.185:30303"
+	conf := &convertConfig{
+		network:   "stureby",
+		format:    "parity",
+		output:    filepath.Join(dir, "stureby.json"),
+		bootnodes: []string{bootnode},
+		readme:    true,
+	}
+	if err := runConvert(genesis, conf); err != nil {
+		t.Fatalf("conversion failed: %v", err)
+	}
+	blob, err := ioutil.ReadFile(filepath.Join(dir, "README.md"))
+	if err != nil {
+		t.Fatalf("failed to read readme: %v", err)
+	}
+	readme := string(blob)
+	for _, want := range []string{
+		"# stureby",
+		"| Chain ID     | 314158 |",
+		genesis.ToBlock(nil).Hash().Hex(),
+		"| Byzantium | block 30000 |",
+		"| Istanbul | block 50000 |",
+		"- `" + bootnode + "`",
+		"| `0x0000000000000000000000000000000000000001` | 1 |",
+	} {
+		if !strings.Contains(readme, want) {
+			t.Errorf("readme missing %q:\n%s", want, readme)
+		}
+	}
+	// Forks not scheduled in the genesis must not be listed
+	if strings.Contains(readme, "Berlin") {
+		t.Errorf("readme lists unscheduled fork:\n%s", readme)
+	}
+}
+
+// Tests that static peer ENRs are validated and embedded into the Parity spec.
+func TestConvertStaticNodes(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+
+	var record enr.Record
+	record.Set(enr.IP(net.IP{127, 0, 0, 1}))
+	record.Set(enr.TCP(30303))
+	if err := enode.SignV4(&record, key); err != nil {
+		t.Fatalf("failed to sign record: %v", err)
+	}
+	node, err := enode.New(enode.ValidSchemes, &record)
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	dir := makeConvertDir(t)
+
+	path := filepath.Join(dir, "static.txt")
+	if err := ioutil.WriteFile(path, []byte("# Static peers\n"+node.String()+"\n"), 0644); err != nil {
+		t.Fatalf("failed to write static nodes: %v", err)
+	}
+	static, err := loadStaticNodes(path)
+	if err != nil {
+		t.Fatalf("failed to load static nodes: %v", err)
+	}
+	if want := []string{node.String()}; !reflect.DeepEqual(static, want) {
+		t.Fatalf("static nodes mismatch: have %v, want %v", static, want)
+	}
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	conf := &convertConfig{network: "stureby", format: "parity", static: static}
+	spec, err := buildChainSpec(genesis, conf)
+	if err != nil {
+		t.Fatalf("conversion failed: %v", err)
+	}
+	if have := spec.(*parityChainSpec).StaticNodes; !reflect.DeepEqual(have, static) {
+		t.Errorf("emitted static nodes mismatch: have %v, want %v", have, static)
+	}
+	conf.format = "along"
+	if _, err := buildChainSpec(genesis, conf); err == nil {
+		t.Errorf("static nodes accepted for along spec")
+	}
+	// Enode URLs and malformed records must be rejected
+	for _, invalid := range []string{node.URLv4(), "enr:invalid"} {
+		if err := ioutil.WriteFile(path, []byte(invalid+"\n"), 0644); err != nil {
+			t.Fatalf("failed to write static nodes: %v", err)
+		}
+		if _, err := loadStaticNodes(path); err == nil {
+			t.Errorf("invalid static node %q accepted", invalid)
+		}
+	}
+}
+
+// Tests that account labels loaded from a sidecar survive into the emitted
+// chain spec metadata.
+func TestConvertLabels(t *testing.T) {
+	dir := makeConvertDir(t)
+
+	path := filepath.Join(dir, "labels.json")
+	content := `{"0x0000000000000000000000000000000000000001": "treasury", "0x0000000000000000000000000000000000000002": "team"}`
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write labels: %v", err)
+	}
+	labels, err := loadLabels(path)
+	if err != nil {
+		t.Fatalf("failed to load labels: %v", err)
+	}
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	for _, format := range []string{"along", "parity"} {
+		conf := &convertConfig{
+			network: "stureby",
+			format:  format,
+			output:  filepath.Join(dir, format+".json"),
+			labels:  labels,
+		}
+		if err := runConvert(genesis, conf); err != nil {
+			t.Fatalf("%s: conversion failed: %v", format, err)
+		}
+		blob, err := ioutil.ReadFile(conf.output)
+		if err != nil {
+			t.Fatalf("%s: failed to read chain spec: %v", format, err)
+		}
+		var spec struct {
+			Meta chainSpecMeta `json:"meta"`
+		}
+		if err := json.Unmarshal(blob, &spec); err != nil {
+			t.Fatalf("%s: failed to parse chain spec: %v", format, err)
+		}
+		want := map[common.Address]string{
+			common.HexToAddress("0x01"): "treasury",
+			common.HexToAddress("0x02"): "team",
+		}
+		if !reflect.DeepEqual(spec.Meta.Labels, want) {
+			t.Errorf("%s: labels mismatch: have %v, want %v", format, spec.Meta.Labels, want)
+		}
+	}
+	if err := ioutil.WriteFile(path, []byte(`{"treasury": "0x01"}`), 0644); err != nil {
+		t.Fatalf("failed to write labels: %v", err)
+	}
+	if _, err := loadLabels(path); err == nil {
+		t.Errorf("malformed labels accepted")
+	}
+}
+
+// Tests that unreachable bootnodes are detected, warned about by default and
+// rejected in strict mode.
+func TestConvertCheckBootnodes(t *testing.T) {
+	var (
+		reachable   = "enode://a979fb575495b8d6db44f750317d0f4622bf4c2aa3365d6af7c284339968eef29b69ad0dce72a4d8db5ebb4968de0e3bec910127f134779fbcb0cb6d3331163c@52.16.188.185:30303"
+		unreachable = "enode://3f1d12044546b76342d59d4a05532c14b85aa669704bfe1f864fe079415aa2c02d743e03218e57a33fb94523adb54032871a6c51b2cc5514cb7c7e35b3ed0a99@13.93.211.84:30304"
+	)
+	var dialed []string
+	dialer := func(network, address string, timeout time.Duration) (net.Conn, error) {
+		dialed = append(dialed, address)
+		if address != "52.16.188.185:30303" {
+			return nil, errors.New("connection refused")
+		}
+		local, remote := net.Pipe()
+		remote.Close()
+		return local, nil
+	}
+	have := checkBootnodes([]string{reachable, unreachable}, dialer, time.Second)
+	if want := []string{unreachable}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("unreachable bootnodes mismatch: have %v, want %v", have, want)
+	}
+	if want := []string{"52.16.188.185:30303", "13.93.211.84:30304"}; !reflect.DeepEqual(dialed, want) {
+		t.Fatalf("dialed addresses mismatch: have %v, want %v", dialed, want)
+	}
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	dir := makeConvertDir(t)
+
+	conf := &convertConfig{
+		network:        "stureby",
+		format:         "parity",
+		output:         filepath.Join(dir, "stureby.json"),
+		bootnodes:      []string{reachable, unreachable},
+		checkBootnodes: true,
+		dialer:         dialer,
+	}
+	if err := runConvert(genesis, conf); err != nil {
+		t.Fatalf("non-strict check failed conversion: %v", err)
+	}
+	os.Remove(conf.output)
+
+	conf.strictBootnodes = true
+	if err := runConvert(genesis, conf); err == nil {
+		t.Fatalf("strict check accepted unreachable bootnode")
+	}
+	if _, err := os.Stat(conf.output); !os.IsNotExist(err) {
+		t.Fatalf("chain spec written despite failed check")
+	}
+	conf.bootnodes = []string{reachable}
+	if err := runConvert(genesis, conf); err != nil {
+		t.Fatalf("strict check rejected reachable bootnode: %v", err)
+	}
+}
+
+// Tests that multiple chain spec formats can be emitted in one go.
+func TestConvertFormats(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	dir := makeConvertDir(t)
+
+	conf := &convertConfig{network: "stureby", output: filepath.Join(dir, "stureby")}
+	if err := runConvertFormats(genesis, conf, []string{"parity", "along", "gong"}); err != nil {
+		t.Fatalf("conversion failed: %v", err)
+	}
+	for format, spec := range map[string]interface{}{
+		"parity": new(parityChainSpec),
+		"along":  new(alongGenesisSpec),
+		"gong":   new(core.Genesis),
+	} {
+		blob, err := ioutil.ReadFile(filepath.Join(dir, "stureby."+format+".json"))
+		if err != nil {
+			t.Fatalf("%s: failed to read chain spec: %v", format, err)
+		}
+		if err := json.Unmarshal(blob, spec); err != nil {
+			t.Fatalf("%s: failed to parse chain spec: %v", format, err)
+		}
+	}
+	// Failures must name the offending format
+	err = runConvertFormats(genesis, conf, []string{"parity", "bogus"})
+	if err == nil || !strings.HasPrefix(err.Error(), "bogus:") {
+		t.Fatalf("failure not attributed to format: %v", err)
+	}
+}
+
+// Tests that the network name, chain id and format are picked up from the
+// environment if not set via flags, and that flags take precedence.
+func TestConvertEnvironment(t *testing.T) {
+	dir := makeConvertDir(t)
+
+	for env, value := range map[string]string{
+		convertNetworkEnv: "envnet",
+		convertChainIDEnv: "1337",
+		convertFormatEnv:  "along",
+	} {
+		os.Setenv(env, value)
+		defer os.Unsetenv(env)
+	}
+	run := func(args ...string) {
+		app := cli.NewApp()
+		app.Flags = []cli.Flag{cli.StringFlag{Name: "network"}}
+		app.Commands = []cli.Command{convertCommand}
+		if err := app.Run(append([]string{"puppong"}, args...)); err != nil {
+			t.Fatalf("conversion failed: %v", err)
+		}
+	}
+	// Without flags, all parameters must come from the environment
+	output := filepath.Join(dir, "env.json")
+	run("convert", "--out", output, "--descriptor", output+".desc", "testdata/stureby_gong.json")
+
+	blob, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatalf("failed to read chain spec: %v", err)
+	}
+	var along alongGenesisSpec
+	if err := json.Unmarshal(blob, &along); err != nil {
+		t.Fatalf("environment format not applied: %v", err)
+	}
+	if along.SealEngine != "Ongash" || along.Params.ChainID != 1337 {
+		t.Errorf("environment chain id not applied: have %d, want %d", along.Params.ChainID, 1337)
+	}
+	blob, err = ioutil.ReadFile(output + ".desc")
+	if err != nil {
+		t.Fatalf("failed to read descriptor: %v", err)
+	}
+	var desc networkDescriptor
+	if err := json.Unmarshal(blob, &desc); err != nil {
+		t.Fatalf("failed to parse descriptor: %v", err)
+	}
+	if desc.Name != "envnet" || desc.ChainID != 1337 {
+		t.Errorf("environment not applied to descriptor: have %s/%d, want %s/%d", desc.Name, desc.ChainID, "envnet", 1337)
+	}
+	// Explicit flags must override the environment
+	output = filepath.Join(dir, "flags.json")
+	run("--network", "flagnet", "convert", "--to", "parity", "--chain-id", "42", "--out", output, "testdata/stureby_gong.json")
+
+	blob, err = ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatalf("failed to read chain spec: %v", err)
+	}
+	var parity parityChainSpec
+	if err := json.Unmarshal(blob, &parity); err != nil {
+		t.Fatalf("failed to parse chain spec: %v", err)
+	}
+	if parity.Name != "flagnet" || parity.Params.ChainID != 42 {
+		t.Errorf("flags not applied: have %s/%d, want %s/%d", parity.Name, parity.Params.ChainID, "flagnet", 42)
+	}
+}
+
+// Tests that the chain spec hash is stable across conversions and changes when
+// a fork block changes.
+func TestChainSpecHash(t *testing.T) {
+	hash := func(genesis *chainGenesis) common.Hash {
+		spec, err := buildChainSpec(genesis, &convertConfig{network: "stureby", format: "parity"})
+		if err != nil {
+			t.Fatalf("conversion failed: %v", err)
+		}
+		hash, err := chainSpecHash(spec)
+		if err != nil {
+			t.Fatalf("failed to hash chain spec: %v", err)
+		}
+		return hash
+	}
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	reloaded, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	base := hash(genesis)
+	if have := hash(reloaded); have != base {
+		t.Fatalf("spec hash unstable: have %x, want %x", have, base)
+	}
+	reloaded.Config.IstanbulBlock = big.NewInt(50001)
+	if have := hash(reloaded); have == base {
+		t.Fatalf("spec hash unchanged after fork block change")
+	}
+}
+
+// Tests that shadow forks switch the chain id and shift the fork blocks while
+// retaining the alloc.
+func TestConvertShadowFork(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	conf := &convertConfig{shadowFork: true, shadowChainID: 1337, shadowForkOffset: 1000}
+	shadow, err := overrideGenesis(genesis, conf)
+	if err != nil {
+		t.Fatalf("failed to create shadow fork: %v", err)
+	}
+	if shadow.Config.ChainID.Uint64() != 1337 {
+		t.Errorf("chain id mismatch: have %v, want %d", shadow.Config.ChainID, 1337)
+	}
+	for _, fork := range []struct {
+		name string
+		have *big.Int
+		want int64
+	}{
+		{"homestead", shadow.Config.HomesteadBlock, 11000},
+		{"byzantium", shadow.Config.ByzantiumBlock, 31000},
+		{"istanbul", shadow.Config.IstanbulBlock, 51000},
+	} {
+		if fork.have.Cmp(big.NewInt(fork.want)) != 0 {
+			t.Errorf("%s block mismatch: have %v, want %v", fork.name, fork.have, fork.want)
+		}
+	}
+	if shadow.Config.BerlinBlock != nil {
+		t.Errorf("unscheduled fork scheduled: %v", shadow.Config.BerlinBlock)
+	}
+	if !reflect.DeepEqual(shadow.Alloc, genesis.Alloc) {
+		t.Errorf("shadow fork alloc mismatch")
+	}
+	if genesis.Config.ChainID.Uint64() != 314158 || genesis.Config.HomesteadBlock.Uint64() != 10000 {
+		t.Errorf("original genesis modified")
+	}
+	// The shadow fork must be converted with the new parameters
+	conf.network, conf.format = "stureby", "parity"
+	spec, err := buildChainSpec(genesis, conf)
+	if err != nil {
+		t.Fatalf("conversion failed: %v", err)
+	}
+	if parity := spec.(*parityChainSpec); parity.Params.ChainID != 1337 {
+		t.Errorf("converted chain id mismatch: have %d, want %d", parity.Params.ChainID, 1337)
+	}
+	// Missing or unchanged chain ids must be rejected
+	for _, id := range []uint64{0, 314158} {
+		if _, err := overrideGenesis(genesis, &convertConfig{shadowFork: true, shadowChainID: id}); err == nil {
+			t.Errorf("shadow fork with chain id %d accepted", id)
+		}
+	}
+}
+
+// Tests that the alloc can be exported as RLP sorted by hashed address and that
+// decoding it back yields the original alloc.
+func TestConvertAllocRLP(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	contract := common.HexToAddress("0xc0de")
+	genesis.Alloc[contract] = core.GenesisAccount{
+		Balance: big.NewInt(1),
+		Nonce:   2,
+		Code:    []byte{0x60, 0x00},
+		Storage: map[common.Hash]common.Hash{{0x02}: {0x03}, {0x01}: {0x04}},
+	}
+	dir := makeConvertDir(t)
+	conf := &convertConfig{
+		network:  "stureby",
+		format:   "parity",
+		output:   filepath.Join(dir, "stureby.json"),
+		allocRLP: filepath.Join(dir, "alloc.rlp"),
+	}
+	if err := runConvert(genesis, conf); err != nil {
+		t.Fatalf("conversion failed: %v", err)
+	}
+	blob, err := ioutil.ReadFile(conf.allocRLP)
+	if err != nil {
+		t.Fatalf("failed to read alloc rlp: %v", err)
+	}
+	var entries []allocRLPEntry
+	if err := rlp.DecodeBytes(blob, &entries); err != nil {
+		t.Fatalf("failed to decode alloc rlp: %v", err)
+	}
+	if len(entries) != len(genesis.Alloc) {
+		t.Fatalf("account count mismatch: have %d, want %d", len(entries), len(genesis.Alloc))
+	}
+	for i, entry := range entries {
+		if i > 0 {
+			prev, cur := crypto.Keccak256(entries[i-1].Address[:]), crypto.Keccak256(entry.Address[:])
+			if bytes.Compare(prev, cur) >= 0 {
+				t.Errorf("entry %d: not sorted by hashed address", i)
+			}
+		}
+		want, ok := genesis.Alloc[entry.Address]
+		if !ok {
+			t.Errorf("entry %d: unknown account %x", i, entry.Address)
+			continue
+		}
+		if entry.Account.Balance.Cmp(want.Balance) != 0 || entry.Account.Nonce != want.Nonce || !bytes.Equal(entry.Account.Code, want.Code) {
+			t.Errorf("account %x mismatch: have %+v, want %+v", entry.Address, entry.Account, want)
+		}
+		storage := make(map[common.Hash]common.Hash)
+		for _, slot := range entry.Account.Storage {
+			storage[slot.Key] = slot.Value
+		}
+		if len(storage) != len(want.Storage) || (len(storage) > 0 && !reflect.DeepEqual(storage, want.Storage)) {
+			t.Errorf("account %x storage mismatch: have %v, want %v", entry.Address, storage, want.Storage)
+		}
+	}
+}
+
+// Tests that empty alloc accounts are warned about and optionally dropped from
+// the converted chain spec.
+func TestConvertDropEmpty(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	empty := common.HexToAddress("0xdead")
+	genesis.Alloc[empty] = core.GenesisAccount{Balance: new(big.Int)}
+
+	// Capture the warnings emitted by the conversion
+	var warned []interface{}
+	handler := log.Root().GetHandler()
+	defer log.Root().SetHandler(handler)
+	log.Root().SetHandler(log.FuncHandler(func(r *log.Record) error {
+		if r.Lvl == log.LvlWarn && r.Msg == "Empty account in genesis alloc" {
+			warned = append(warned, r.Ctx[1])
+		}
+		return nil
+	}))
+	for _, drop := range []bool{false, true} {
+		warned = nil
+
+		spec, err := buildChainSpec(genesis, &convertConfig{network: "stureby", format: "parity", dropEmpty: drop})
+		if err != nil {
+			t.Fatalf("drop %v: conversion failed: %v", drop, err)
+		}
+		if !reflect.DeepEqual(warned, []interface{}{empty}) {
+			t.Errorf("drop %v: warned accounts mismatch: have %v, want %v", drop, warned, []common.Address{empty})
+		}
+		_, kept := spec.(*parityChainSpec).Accounts[common.UnprefixedAddress(empty)]
+		if kept == drop {
+			t.Errorf("drop %v: empty account kept: %v", drop, kept)
+		}
+	}
+	if _, ok := genesis.Alloc[empty]; !ok {
+		t.Errorf("original genesis modified")
+	}
+}
+
+// Tests that the chain config can be emitted as TOML and parsed back.
+func TestConvertTOML(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	spec, err := buildChainSpec(genesis, &convertConfig{network: "stureby", format: "toml"})
+	if err != nil {
+		t.Fatalf("conversion failed: %v", err)
+	}
+	out, err := encodeChainSpec(spec, false)
+	if err != nil {
+		t.Fatalf("failed to encode chain config: %v", err)
+	}
+	var config map[string]interface{}
+	if err := toml.Unmarshal(out, &config); err != nil {
+		t.Fatalf("failed to parse chain config: %v\n%s", err, out)
+	}
+	if id, _ := config["chainId"].(int64); id != genesis.Config.ChainID.Int64() {
+		t.Errorf("chain id mismatch: have %v, want %v", config["chainId"], genesis.Config.ChainID)
+	}
+	if block, _ := config["byzantiumBlock"].(int64); block != genesis.Config.ByzantiumBlock.Int64() {
+		t.Errorf("byzantium block mismatch: have %v, want %v", config["byzantiumBlock"], genesis.Config.ByzantiumBlock)
+	}
+	if block, ok := config["berlinBlock"]; ok {
+		t.Errorf("unscheduled fork emitted: %v", block)
+	}
+}
+
+// Tests that genesis alloc accounts at builtin addresses are merged into the
+// Along builtin definitions with a warning from the converter itself, or
+// rejected in strict mode.
+func TestConvertPrecompileCollisions(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	var (
+		identity = common.BytesToAddress([]byte{4})
+		funded   = common.HexToAddress("0xdeadbeef")
+	)
+	genesis.Alloc = core.GenesisAlloc{
+		identity: {Balance: big.NewInt(1000), Nonce: 1},
+		funded:   {Balance: big.NewInt(2000)},
+	}
+	// Capture the collisions reported by the converter
+	var warned []interface{}
+	handler := log.Root().GetHandler()
+	defer log.Root().SetHandler(handler)
+	log.Root().SetHandler(log.FuncHandler(func(r *log.Record) error {
+		if r.Lvl == log.LvlWarn && r.Msg == "Merging genesis alloc account into builtin" {
+			warned = append(warned, r.Ctx[1])
+		}
+		return nil
+	}))
+	if _, err := newAlongGenesisSpec("stureby", genesis, nil); err != nil {
+		t.Fatalf("along conversion failed: %v", err)
+	}
+	if !reflect.DeepEqual(warned, []interface{}{identity}) {
+		t.Errorf("reported collisions mismatch: have %v, want %v", warned, []common.Address{identity})
+	}
+	// Non-strict conversions merge the account into the builtin
+	spec, err := buildChainSpec(genesis, &convertConfig{network: "stureby", format: "along"})
+	if err != nil {
+		t.Fatalf("conversion failed: %v", err)
+	}
+	account := spec.(*alongGenesisSpec).Accounts[common.UnprefixedAddress(identity)]
+	if account.Precompiled == nil || account.Precompiled.Name != "identity" {
+		t.Errorf("builtin definition mismatch: have %+v, want identity", account.Precompiled)
+	}
+	if account.Balance == nil || (*big.Int)(account.Balance).Cmp(big.NewInt(1000)) != 0 || account.Nonce != 1 {
+		t.Errorf("merged account mismatch: balance %v, nonce %d", account.Balance, account.Nonce)
+	}
+	if have := spec.(*alongGenesisSpec).precompileCollisions(genesis.Alloc); !reflect.DeepEqual(have, []common.Address{identity}) {
+		t.Errorf("collisions mismatch: have %v, want %v", have, []common.Address{identity})
+	}
+	// Strict conversions reject the account, identifying the collision
+	_, err = buildChainSpec(genesis, &convertConfig{network: "stureby", format: "along", strictPrecompiles: true})
+	if err == nil {
+		t.Fatalf("strict conversion succeeded with colliding account")
+	}
+	if !strings.Contains(err.Error(), identity.Hex()) || !strings.Contains(err.Error(), "identity") {
+		t.Errorf("collision error not identifying the account: %v", err)
+	}
+	// Strict conversions without collisions succeed
+	delete(genesis.Alloc, identity)
+	if _, err := buildChainSpec(genesis, &convertConfig{network: "stureby", format: "along", strictPrecompiles: true}); err != nil {
+		t.Errorf("strict conversion failed without collisions: %v", err)
+	}
+}
+
+// Tests that the EIP-1559 fee market parameters are carried over into all the
+// chain spec formats, defaulting to the mainnet values if not configured.
+func TestConvertFeeMarketParams(t *testing.T) {
+	tests := []struct {
+		elasticity  *uint64
+		denominator *uint64
+		want        [2]uint64 // denominator, elasticity
+	}{
+		{nil, nil, [2]uint64{defaultBaseFeeChangeDenominator, defaultElasticityMultiplier}},
+		{newUint64(6), nil, [2]uint64{defaultBaseFeeChangeDenominator, 6}},
+		{newUint64(6), newUint64(50), [2]uint64{50, 6}},
+	}
+	for i, tt := range tests {
+		genesis, err := loadGenesis("testdata/london_gong.json")
+		if err != nil {
+			t.Fatalf("failed to load genesis: %v", err)
+		}
+		genesis.Forks.ElasticityMultiplier = tt.elasticity
+		genesis.Forks.BaseFeeChangeDenominator = tt.denominator
+
+		for _, format := range []string{"along", "parity", "besu"} {
+			spec, err := newChainSpec(format, "stureby", genesis, nil)
+			if err != nil {
+				t.Fatalf("test %d, %s: conversion failed: %v", i, format, err)
+			}
+			var denominator, elasticity uint64
+			switch spec := spec.(type) {
+			case *alongGenesisSpec:
+				denominator, elasticity = uint64(*spec.Params.BaseFeeChangeDenominator), uint64(*spec.Params.ElasticityMultiplier)
+			case *parityChainSpec:
+				denominator, elasticity = uint64(*spec.Params.EIP1559BaseFeeMaxChangeDenominator), uint64(*spec.Params.EIP1559ElasticityMultiplier)
+			case *besuGenesisSpec:
+				denominator, elasticity = *spec.Config.BaseFeeChangeDenominator, *spec.Config.ElasticityMultiplier
+			}
+			if have := [2]uint64{denominator, elasticity}; have != tt.want {
+				t.Errorf("test %d, %s: fee market params mismatch: have %v, want %v", i, format, have, tt.want)
+			}
+		}
+	}
+}
+
+// newUint64 returns a pointer to a copy of the given number.
+func newUint64(n uint64) *uint64 { return &n }
+
+// Tests that dev mode conversions fund the faucet, relax the gas limit and enable
+// instant sealing in every supported format.
+func TestConvertDev(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	faucet := common.HexToAddress("0x00000000000000000000000000000000000fa0ce")
+	for _, format := range []string{"along", "parity", "besu", "gong"} {
+		spec, err := buildChainSpec(genesis, &convertConfig{network: "stureby", format: format, dev: true, devFaucet: &faucet})
+		if err != nil {
+			t.Fatalf("%s: conversion failed: %v", format, err)
+		}
+		var balance *big.Int
+		switch spec := spec.(type) {
+		case *alongGenesisSpec:
+			if spec.SealEngine != "NoProof" {
+				t.Errorf("%s: seal engine mismatch: have %s, want NoProof", format, spec.SealEngine)
+			}
+			if account := spec.Accounts[common.UnprefixedAddress(faucet)]; account != nil {
+				balance = (*big.Int)(account.Balance)
+			}
+		case *parityChainSpec:
+			if spec.Engine.InstantSeal == nil || spec.Engine.Ongash != nil {
+				t.Errorf("%s: instant sealing not enabled: %+v", format, spec.Engine)
+			}
+			if account := spec.Accounts[common.UnprefixedAddress(faucet)]; account != nil {
+				balance = (*big.Int)(&account.Balance)
+			}
+		case *besuGenesisSpec:
+			if spec.Config.Ongash.FixedDifficulty == nil || *spec.Config.Ongash.FixedDifficulty != 1 {
+				t.Errorf("%s: fixed difficulty not enabled: %+v", format, spec.Config.Ongash)
+			}
+			if account := spec.Alloc[common.UnprefixedAddress(faucet)]; account != nil {
+				balance = (*big.Int)(account.Balance)
+			}
+			if uint64(spec.GasLimit) != devGasLimit {
+				t.Errorf("%s: gas limit mismatch: have %d, want %d", format, spec.GasLimit, devGasLimit)
+			}
+		case *chainGenesis:
+			if spec.Config.Clique == nil || spec.Config.Clique.Period != 0 || spec.Config.Ongash != nil {
+				t.Errorf("%s: instant sealing not enabled: clique %+v", format, spec.Config.Clique)
+			}
+			if want := cliqueExtraData([]common.Address{faucet}); !bytes.Equal(spec.ExtraData, want) {
+				t.Errorf("%s: signers mismatch: have %x, want %x", format, spec.ExtraData, want)
+			}
+			balance = spec.Alloc[faucet].Balance
+		}
+		if balance == nil || balance.Cmp(devFaucetBalance) != 0 {
+			t.Errorf("%s: faucet balance mismatch: have %v, want %v", format, balance, devFaucetBalance)
+		}
+	}
+	// The original genesis must be left untouched
+	if _, ok := genesis.Alloc[faucet]; ok || genesis.Config.Clique != nil {
+		t.Errorf("dev conversion modified the original genesis")
+	}
+	// Formats without instant sealing must be rejected
+	if _, err := buildChainSpec(genesis, &convertConfig{network: "stureby", format: "pyorange", dev: true}); err == nil {
+		t.Errorf("dev conversion into pyorange succeeded")
+	}
+}
+
+// Tests that the YAML chain specs carry the same fields in the same order as the
+// JSON golden files, decoding back into identical spec structs.
+func TestConvertYAML(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	for _, format := range []string{"along", "parity", "besu"} {
+		// The Along golden file carries the Stureby bootnodes
+		bootnodes := []string{}
+		if format == "along" {
+			bootnodes = sturebyBootnodes
+		}
+		spec, err := newChainSpec(format, "stureby", genesis, bootnodes)
+		if err != nil {
+			t.Fatalf("%s: conversion failed: %v", format, err)
+		}
+		out, err := encodeChainSpecYAML(spec)
+		if err != nil {
+			t.Fatalf("%s: failed to encode spec: %v", format, err)
+		}
+		golden, err := ioutil.ReadFile(fmt.Sprintf("testdata/stureby_%s.json", format))
+		if err != nil {
+			t.Fatalf("%s: could not read file: %v", format, err)
+		}
+		// Decode both the YAML and the golden JSON back into spec structs
+		var fields interface{}
+		if err := yaml.Unmarshal(out, &fields); err != nil {
+			t.Fatalf("%s: failed to parse YAML: %v\n%s", format, err, out)
+		}
+		blob, err := json.Marshal(fields)
+		if err != nil {
+			t.Fatalf("%s: failed to re-encode YAML fields: %v", format, err)
+		}
+		have := reflect.New(reflect.TypeOf(spec).Elem()).Interface()
+		if err := json.Unmarshal(blob, have); err != nil {
+			t.Fatalf("%s: failed to decode YAML spec: %v", format, err)
+		}
+		want := reflect.New(reflect.TypeOf(spec).Elem()).Interface()
+		if err := json.Unmarshal(golden, want); err != nil {
+			t.Fatalf("%s: failed to decode golden spec: %v", format, err)
+		}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("%s: spec mismatch:\nhave %+v\nwant %+v", format, have, want)
+		}
+		// Ensure the top level fields retained the JSON ordering
+		if have, want := yamlKeys(t, out), yamlKeys(t, golden); !reflect.DeepEqual(have, want) {
+			t.Errorf("%s: field order mismatch: have %v, want %v", format, have, want)
+		}
+	}
+}
+
+// Tests that the JSONC chain specs annotate the fork fields and still parse into
+// the plain JSON specs once the comments are stripped.
+func TestConvertJSONC(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	dir := makeConvertDir(t)
+	for _, format := range []string{"gong", "along", "parity", "besu"} {
+		var (
+			plain  = filepath.Join(dir, format+".json")
+			jsonc  = filepath.Join(dir, format+".jsonc")
+			blobs  = make(map[string][]byte)
+			values = make(map[string]interface{})
+		)
+		for _, path := range []string{plain, jsonc} {
+			conf := &convertConfig{network: "stureby", format: format, output: path, jsonc: path == jsonc}
+			if err := runConvert(genesis, conf); err != nil {
+				t.Fatalf("%s: conversion failed: %v", format, err)
+			}
+			blob, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%s: failed to read spec: %v", format, err)
+			}
+			var value interface{}
+			if err := json.Unmarshal(stripJSONComments(blob), &value); err != nil {
+				t.Fatalf("%s: failed to parse spec: %v\n%s", format, err, blob)
+			}
+			blobs[path], values[path] = blob, value
+		}
+		if !bytes.Contains(blobs[jsonc], []byte("// Byzantium:")) {
+			t.Errorf("%s: byzantium fork not annotated:\n%s", format, blobs[jsonc])
+		}
+		if err := json.Unmarshal(blobs[jsonc], new(interface{})); err == nil {
+			t.Errorf("%s: annotated spec parsed without stripping comments", format)
+		}
+		if !reflect.DeepEqual(values[plain], values[jsonc]) {
+			t.Errorf("%s: annotated spec content mismatch", format)
+		}
+	}
+}
+
+// stripJSONComments removes the // line comments from a JSONC document, leaving
+// any comment markers within strings intact.
+func stripJSONComments(blob []byte) []byte {
+	var (
+		out     []byte
+		inStr   bool
+		escaped bool
+	)
+	for i := 0; i < len(blob); i++ {
+		c := blob[i]
+		switch {
+		case inStr:
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inStr = false
+			}
+		case c == '"':
+			inStr = true
+		case c == '/' && i+1 < len(blob) && blob[i+1] == '/':
+			for i < len(blob) && blob[i] != '\n' {
+				i++
+			}
+			if i < len(blob) {
+				out = append(out, '\n')
+			}
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// yamlKeys returns the keys of the top level mapping of a YAML (or JSON) document.
+func yamlKeys(t *testing.T, blob []byte) []string {
+	var node yaml.Node
+	if err := yaml.Unmarshal(blob, &node); err != nil {
+		t.Fatalf("failed to parse document: %v", err)
+	}
+	var keys []string
+	for i, child := range node.Content[0].Content {
+		if i%2 == 0 {
+			keys = append(keys, child.Value)
+		}
+	}
+	return keys
+}
+
+// Tests that the Clique extraData is assembled from the signer list, with the
+// signers sorted regardless of the order they were given in.
+func TestConvertSigners(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	signers, err := parseSigners("0x00000000000000000000000000000000000000cc, 0x00000000000000000000000000000000000000aa,0x00000000000000000000000000000000000000bb")
+	if err != nil {
+		t.Fatalf("failed to parse signers: %v", err)
+	}
+	spec, err := buildChainSpec(genesis, &convertConfig{network: "stureby", format: "parity", signers: signers})
+	if err != nil {
+		t.Fatalf("conversion failed: %v", err)
+	}
+	extra := spec.(*parityChainSpec).Genesis.ExtraData
+	if len(extra) != 32+3*common.AddressLength+65 {
+		t.Fatalf("extraData length mismatch: have %d, want %d", len(extra), 32+3*common.AddressLength+65)
+	}
+	if !bytes.Equal(extra[:32], make([]byte, 32)) || !bytes.Equal(extra[len(extra)-65:], make([]byte, 65)) {
+		t.Errorf("extraData vanity or seal not zero: %x", extra)
+	}
+	for i, want := range []common.Address{common.HexToAddress("0xaa"), common.HexToAddress("0xbb"), common.HexToAddress("0xcc")} {
+		if have := common.BytesToAddress(extra[32+i*common.AddressLength : 32+(i+1)*common.AddressLength]); have != want {
+			t.Errorf("signer %d mismatch: have %x, want %x", i, have, want)
+		}
+	}
+	// Unsorted signers set directly must be sorted too
+	unsorted := []common.Address{common.HexToAddress("0x02"), common.HexToAddress("0x01")}
+	if extra := cliqueExtraData(unsorted); extra[32+common.AddressLength-1] != 0x01 {
+		t.Errorf("unsorted signers not sorted: %x", extra)
+	}
+	// Invalid and duplicate signers must be rejected
+	for _, input := range []string{"0x01", "0x00000000000000000000000000000000000000aa,0x00000000000000000000000000000000000000AA"} {
+		if _, err := parseSigners(input); err == nil {
+			t.Errorf("invalid signers %q accepted", input)
+		}
+	}
+}
+
+// Tests that the built-in bootnodes of well-known networks are used if requested
+// and no explicit bootnodes are given.
+func TestConvertDefaultBootnodes(t *testing.T) {
+	dir := makeConvertDir(t)
+
+	run := func(args ...string) (*networkDescriptor, error) {
+		output := filepath.Join(dir, "spec.json")
+
+		app := cli.NewApp()
+		app.Flags = []cli.Flag{cli.StringFlag{Name: "network"}}
+		app.Commands = []cli.Command{convertCommand}
+		args = append(append([]string{"puppong"}, args...), "--out", output, "--descriptor", output+".desc", "testdata/stureby_gong.json")
+		if err := app.Run(args); err != nil {
+			return nil, err
+		}
+		blob, err := ioutil.ReadFile(output + ".desc")
+		if err != nil {
+			return nil, err
+		}
+		desc := new(networkDescriptor)
+		return desc, json.Unmarshal(blob, desc)
+	}
+	desc, err := run("--network", "rinkeby", "convert", "--use-default-bootnodes")
+	if err != nil {
+		t.Fatalf("conversion failed: %v", err)
+	}
+	if !reflect.DeepEqual(desc.Bootnodes, params.RinkebyBootnodes) {
+		t.Errorf("default bootnodes mismatch: have %v, want %v", desc.Bootnodes, params.RinkebyBootnodes)
+	}
+	// Explicit bootnodes must take precedence over the defaults
+	explicit := "enode://" + strings.Repeat("ab", 64) + "@127.0.0.1:30303"
+	if desc, err = run("--network", "rinkeby", "convert", "--use-default-bootnodes", "--bootnodes", explicit); err != nil {
+		t.Fatalf("conversion failed: %v", err)
+	}
+	if !reflect.DeepEqual(desc.Bootnodes, []string{explicit}) {
+		t.Errorf("explicit bootnodes mismatch: have %v, want %v", desc.Bootnodes, []string{explicit})
+	}
+	// Unknown networks must be rejected
+	if _, err := run("--network", "stureby", "convert", "--use-default-bootnodes"); err == nil {
+		t.Errorf("default bootnodes of unknown network accepted")
+	}
+}
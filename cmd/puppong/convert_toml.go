@@ -0,0 +1,69 @@
+// Copyright 2021 The go-orange Authors
+// This file is part of go-orange.
+//
+// go-orange is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-orange is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-orange. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	"github.com/naoina/toml"
+	"github.com/ong2020/go-orange/params"
+)
+
+// encodeChainConfigTOML serializes a chain config into TOML, using the same
+// field names as its JSON form. Unset forks are omitted and numbers too large
+// for a TOML integer are emitted as decimal strings.
+func encodeChainConfigTOML(config *params.ChainConfig) ([]byte, error) {
+	// Round trip through JSON to reuse the field names and omit unset forks
+	blob, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(blob))
+	dec.UseNumber()
+
+	var fields map[string]interface{}
+	if err := dec.Decode(&fields); err != nil {
+		return nil, err
+	}
+	return toml.Marshal(tomlValue(fields))
+}
+
+// tomlValue converts a generically decoded JSON value into one marshallable by
+// the TOML encoder.
+func tomlValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			v[key] = tomlValue(val)
+		}
+		return v
+	case []interface{}:
+		for i, val := range v {
+			v[i] = tomlValue(val)
+		}
+		return v
+	case json.Number:
+		if n, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return n
+		}
+		return string(v)
+	default:
+		return v
+	}
+}
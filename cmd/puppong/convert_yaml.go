@@ -0,0 +1,59 @@
+// Copyright 2021 The go-orange Authors
+// This file is part of go-orange.
+//
+// go-orange is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-orange is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-orange. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// encodeChainSpecYAML serializes a chain spec into YAML, using the same field
+// names and ordering as its JSON form.
+func encodeChainSpecYAML(spec interface{}) ([]byte, error) {
+	blob, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+	return jsonToYAML(blob)
+}
+
+// jsonToYAML converts a JSON document into block style YAML. JSON is a subset of
+// YAML, so the document is parsed as is into a node tree to retain the order of
+// the fields, after which the JSON specific flow and quoting styles are dropped.
+func jsonToYAML(blob []byte) ([]byte, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(blob, &node); err != nil {
+		return nil, err
+	}
+	resetYAMLStyle(&node)
+	return yaml.Marshal(&node)
+}
+
+// resetYAMLStyle recursively clears the styles of a node tree. Strings looking
+// like numbers (e.g. hex quantities too large for the YAML resolver) stay quoted
+// so no YAML parser reads them back as something else.
+func resetYAMLStyle(node *yaml.Node) {
+	node.Style = 0
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" && node.Value != "" && strings.ContainsRune("0123456789+-.", rune(node.Value[0])) {
+		node.Style = yaml.DoubleQuotedStyle
+	}
+	for _, child := range node.Content {
+		resetYAMLStyle(child)
+	}
+}
@@ -17,9 +17,14 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"math"
 	"math/big"
+	"sort"
 	"strings"
 
 	"github.com/ong2020/go-orange/common"
@@ -28,14 +33,139 @@ import (
 	"github.com/ong2020/go-orange/consensus/ongash"
 	"github.com/ong2020/go-orange/core"
 	"github.com/ong2020/go-orange/core/types"
+	"github.com/ong2020/go-orange/crypto"
+	"github.com/ong2020/go-orange/log"
 	"github.com/ong2020/go-orange/params"
+	"github.com/ong2020/go-orange/rlp"
 )
 
+// chainSpecVersion is the version of the chain spec layout emitted by the
+// converters. It must be bumped whenever the output layout changes.
+const chainSpecVersion = 1
+
+// Fee market defaults of the EIP-1559 networks, emitted for London chains not
+// overriding them. Go-orange doesn't implement EIP-1559, so they are not part
+// of the protocol params.
+const (
+	defaultBaseFeeChangeDenominator = 8          // Bounds the amount the base fee can change between blocks
+	defaultElasticityMultiplier     = 2          // Bounds the maximum gas limit an EIP-1559 block may have
+	defaultInitialBaseFee           = 1000000000 // Base fee of the first EIP-1559 block
+)
+
+// chainForks contains the forks of a chain which go-orange doesn't implement.
+// Other clients do, so the converters carry them over into their chain specs,
+// but they are never part of the go-orange chain config.
+type chainForks struct {
+	LondonBlock  *big.Int `json:"londonBlock,omitempty"`  // London switch block (nil = no fork, 0 = already on london)
+	ShanghaiTime *uint64  `json:"shanghaiTime,omitempty"` // Shanghai switch time (nil = no fork, 0 = already on shanghai)
+	CancunTime   *uint64  `json:"cancunTime,omitempty"`   // Cancun switch time (nil = no fork, 0 = already on cancun)
+
+	// EIP-1559 fee market parameters, active from London on
+	BaseFeeChangeDenominator *uint64 `json:"baseFeeChangeDenominator,omitempty"` // Bound divisor of the base fee change (nil = default)
+	ElasticityMultiplier     *uint64 `json:"elasticityMultiplier,omitempty"`     // Bound multiplier of the gas target (nil = default)
+}
+
+// chainGenesis is the genesis specification the converters operate on, i.e. a
+// go-orange genesis along with the forks scheduled beyond the ones go-orange
+// implements. The latter are read from the chain config section of the same
+// JSON document.
+type chainGenesis struct {
+	core.Genesis
+	Forks   chainForks
+	BaseFee *big.Int // Base fee of London genesis blocks (nil = default)
+}
+
+// newChainGenesis wraps a go-orange genesis, scheduling no further forks.
+func newChainGenesis(genesis *core.Genesis) *chainGenesis {
+	return &chainGenesis{Genesis: *genesis}
+}
+
+// UnmarshalJSON parses a go-orange genesis, along with the forks scheduled in its
+// chain config which go-orange doesn't implement and the London base fee.
+func (g *chainGenesis) UnmarshalJSON(input []byte) error {
+	var forks struct {
+		Config  *chainForks            `json:"config"`
+		BaseFee *math2.HexOrDecimal256 `json:"baseFeePerGas"`
+	}
+	if err := json.Unmarshal(input, &forks); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(input, &g.Genesis); err != nil {
+		return err
+	}
+	g.Forks, g.BaseFee = chainForks{}, (*big.Int)(forks.BaseFee)
+	if forks.Config != nil {
+		g.Forks = *forks.Config
+	}
+	return nil
+}
+
+// MarshalJSON encodes the genesis in the go-orange format, merging the forks
+// go-orange doesn't implement into the chain config.
+func (g chainGenesis) MarshalJSON() ([]byte, error) {
+	blob, err := json.Marshal(&g.Genesis)
+	if err != nil || (g.Forks == (chainForks{}) && g.BaseFee == nil) {
+		return blob, err
+	}
+	var fields, config map[string]json.RawMessage
+	if err := json.Unmarshal(blob, &fields); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(fields["config"], &config); err != nil {
+		return nil, err
+	}
+	forks, err := json.Marshal(&g.Forks)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(forks, &config); err != nil {
+		return nil, err
+	}
+	if fields["config"], err = json.Marshal(config); err != nil {
+		return nil, err
+	}
+	if g.BaseFee != nil {
+		if fields["baseFeePerGas"], err = json.Marshal((*hexutil.Big)(g.BaseFee)); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// isLondon returns whether the genesis block itself is a London block.
+func (g *chainGenesis) isLondon() bool {
+	return g.Forks.LondonBlock != nil && g.Forks.LondonBlock.Sign() == 0
+}
+
+// baseFee returns the base fee of the first London block of the chain.
+func (g *chainGenesis) baseFee() *big.Int {
+	if g.BaseFee != nil {
+		return g.BaseFee
+	}
+	return new(big.Int).SetUint64(defaultInitialBaseFee)
+}
+
+// feeMarketParams returns the EIP-1559 base fee change denominator and gas target
+// elasticity multiplier of a chain, falling back to the mainnet values for the
+// ones not configured.
+func feeMarketParams(forks *chainForks) (denominator uint64, elasticity uint64) {
+	denominator, elasticity = defaultBaseFeeChangeDenominator, defaultElasticityMultiplier
+	if forks.BaseFeeChangeDenominator != nil {
+		denominator = *forks.BaseFeeChangeDenominator
+	}
+	if forks.ElasticityMultiplier != nil {
+		elasticity = *forks.ElasticityMultiplier
+	}
+	return denominator, elasticity
+}
+
 // alongGenesisSpec represents the genesis specification format used by the
 // C++ Orange implementation.
 type alongGenesisSpec struct {
-	SealEngine string `json:"sealEngine"`
-	Params     struct {
+	SpecVersion int              `json:"specVersion"`
+	SealEngine  string           `json:"sealEngine"`
+	Clique      *chainSpecClique `json:"clique,omitempty"`
+	Params      struct {
 		AccountStartNonce          math2.HexOrDecimal64   `json:"accountStartNonce"`
 		MaximumExtraDataSize       hexutil.Uint64         `json:"maximumExtraDataSize"`
 		HomesteadForkBlock         *hexutil.Big           `json:"homesteadForkBlock,omitempty"`
@@ -46,6 +176,11 @@ type alongGenesisSpec struct {
 		ConstantinopleForkBlock    *hexutil.Big           `json:"constantinopleForkBlock,omitempty"`
 		ConstantinopleFixForkBlock *hexutil.Big           `json:"constantinopleFixForkBlock,omitempty"`
 		IstanbulForkBlock          *hexutil.Big           `json:"istanbulForkBlock,omitempty"`
+		LondonForkBlock            *hexutil.Big           `json:"londonForkBlock,omitempty"`
+		BaseFeeChangeDenominator   *hexutil.Uint64        `json:"baseFeeMaxChangeDenominator,omitempty"`
+		ElasticityMultiplier       *hexutil.Uint64        `json:"elasticityMultiplier,omitempty"`
+		ShanghaiForkTime           *hexutil.Uint64        `json:"shanghaiForkTime,omitempty"`
+		CancunForkTime             *hexutil.Uint64        `json:"cancunForkTime,omitempty"`
 		MinGasLimit                hexutil.Uint64         `json:"minGasLimit"`
 		MaxGasLimit                hexutil.Uint64         `json:"maxGasLimit"`
 		TieBreakingGas             bool                   `json:"tieBreakingGas"`
@@ -68,9 +203,82 @@ type alongGenesisSpec struct {
 		ParentHash common.Hash      `json:"parentHash"`
 		ExtraData  hexutil.Bytes    `json:"extraData"`
 		GasLimit   hexutil.Uint64   `json:"gasLimit"`
+		StateRoot  *common.Hash     `json:"stateRoot,omitempty"`
 	} `json:"genesis"`
 
+	Nodes    []string                                              `json:"nodes,omitempty"`
 	Accounts map[common.UnprefixedAddress]*alongGenesisSpecAccount `json:"accounts"`
+	Meta     *chainSpecMeta                                        `json:"meta,omitempty"`
+}
+
+// chainSpecMeta is the non-consensus metadata embedded into chain specs, not
+// affecting the genesis block in any way.
+type chainSpecMeta struct {
+	MinClientVersion string                    `json:"minClientVersion,omitempty"` // Minimum client version supporting the network
+	GenesisHash      *common.Hash              `json:"genesisHash,omitempty"`      // Hash of the genesis block, for cross-checking clients
+	Labels           map[common.Address]string `json:"labels,omitempty"`           // Human readable labels of the alloc accounts
+}
+
+// chainSpecClique is the proof-of-authority consensus engine definition, shared
+// by the chain spec formats supporting Clique.
+type chainSpecClique struct {
+	Period  uint64           `json:"period"`  // Number of seconds between blocks to enforce
+	Epoch   uint64           `json:"epoch"`   // Epoch length to reset votes and checkpoint
+	Signers []common.Address `json:"signers"` // Initial signers, parsed out of the genesis extra-data
+}
+
+// cliqueMaxExtraDataSize is the maximum header extra-data size of Clique networks.
+// The protocol limit would reject the signer seals, so lift it like the public
+// Clique networks do.
+const cliqueMaxExtraDataSize = 0xffff
+
+// newChainSpecClique assembles the Clique engine definition of a genesis, with
+// the initial signer set parsed out of its extra-data.
+func newChainSpecClique(config *params.CliqueConfig, extra []byte) (*chainSpecClique, error) {
+	signers, err := cliqueSigners(extra)
+	if err != nil {
+		return nil, err
+	}
+	return &chainSpecClique{Period: config.Period, Epoch: config.Epoch, Signers: signers}, nil
+}
+
+// GenesisHash computes the hash of the genesis block, i.e. the keccak hash of
+// its RLP encoded header, which all clients of the network must agree on. An
+// error is returned if the forks active at genesis can't be represented.
+func GenesisHash(genesis *chainGenesis) (common.Hash, error) {
+	var (
+		header   = genesis.ToBlock(nil).Header()
+		shanghai = genesis.Forks.ShanghaiTime != nil && *genesis.Forks.ShanghaiTime <= genesis.Timestamp
+		cancun   = genesis.Forks.CancunTime != nil && *genesis.Forks.CancunTime <= genesis.Timestamp
+	)
+	switch {
+	case cancun && !shanghai:
+		return common.Hash{}, errors.New("cancun active at genesis without shanghai")
+	case shanghai && !genesis.isLondon():
+		return common.Hash{}, errors.New("shanghai active at genesis without london")
+	case !genesis.isLondon():
+		return header.Hash(), nil
+	}
+	// London genesis headers carry the base fee as a trailing field, Shanghai and
+	// Cancun ones further fields, which the go-orange header can't represent, so
+	// encode them explicitly
+	fields := []interface{}{
+		header.ParentHash, header.UncleHash, header.Coinbase, header.Root,
+		header.TxHash, header.ReceiptHash, header.Bloom, header.Difficulty,
+		header.Number, header.GasLimit, header.GasUsed, header.Time,
+		header.Extra, header.MixDigest, header.Nonce, genesis.baseFee(),
+	}
+	if shanghai {
+		fields = append(fields, types.EmptyRootHash) // Withdrawals root
+	}
+	if cancun {
+		fields = append(fields, uint64(0), uint64(0), common.Hash{}) // Blob gas used, excess blob gas, parent beacon root
+	}
+	blob, err := rlp.EncodeToBytes(fields)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(blob), nil
 }
 
 // alongGenesisSpecAccount is the prefunded genesis account and/or precompiled
@@ -95,14 +303,32 @@ type alongGenesisSpecLinearPricing struct {
 
 // newAlongGenesisSpec converts a go-orange genesis block into a Along-specific
 // chain specification format.
-func newAlongGenesisSpec(network string, genesis *core.Genesis) (*alongGenesisSpec, error) {
-	// Only ongash is currently supported between go-orange and along
-	if genesis.Config.Ongash == nil {
+func newAlongGenesisSpec(network string, genesis *chainGenesis, bootnodes []string) (*alongGenesisSpec, error) {
+	// Only ongash and clique are currently supported between go-orange and along
+	var clique *chainSpecClique
+	switch {
+	case genesis.Config.Clique != nil:
+		var err error
+		if clique, err = newChainSpecClique(genesis.Config.Clique, genesis.ExtraData); err != nil {
+			return nil, err
+		}
+	case genesis.Config.Ongash == nil:
 		return nil, errors.New("unsupported consensus engine")
 	}
+	if err := validateForkOrder(genesis); err != nil {
+		return nil, err
+	}
+	if err := validateAllocBalances(genesis.Alloc); err != nil {
+		return nil, err
+	}
+	if err := validateBootnodes(bootnodes); err != nil {
+		return nil, err
+	}
 	// Reconstruct the chain spec in Along format
 	spec := &alongGenesisSpec{
-		SealEngine: "Ongash",
+		SpecVersion: chainSpecVersion,
+		SealEngine:  "Ongash",
+		Nodes:       bootnodes,
 	}
 	// Some defaults
 	spec.Params.AccountStartNonce = 0
@@ -135,6 +361,18 @@ func newAlongGenesisSpec(network string, genesis *core.Genesis) (*alongGenesisSp
 	if num := genesis.Config.IstanbulBlock; num != nil {
 		spec.Params.IstanbulForkBlock = (*hexutil.Big)(num)
 	}
+	if num := genesis.Forks.LondonBlock; num != nil {
+		denominator, elasticity := feeMarketParams(&genesis.Forks)
+		spec.Params.LondonForkBlock = (*hexutil.Big)(num)
+		spec.Params.BaseFeeChangeDenominator = (*hexutil.Uint64)(&denominator)
+		spec.Params.ElasticityMultiplier = (*hexutil.Uint64)(&elasticity)
+	}
+	if time := genesis.Forks.ShanghaiTime; time != nil {
+		spec.Params.ShanghaiForkTime = (*hexutil.Uint64)(time)
+	}
+	if time := genesis.Forks.CancunTime; time != nil {
+		spec.Params.CancunForkTime = (*hexutil.Uint64)(time)
+	}
 	spec.Params.NetworkID = (hexutil.Uint64)(genesis.Config.ChainID.Uint64())
 	spec.Params.ChainID = (hexutil.Uint64)(genesis.Config.ChainID.Uint64())
 	spec.Params.MaximumExtraDataSize = (hexutil.Uint64)(params.MaximumExtraDataSize)
@@ -145,6 +383,12 @@ func newAlongGenesisSpec(network string, genesis *core.Genesis) (*alongGenesisSp
 	spec.Params.GasLimitBoundDivisor = (math2.HexOrDecimal64)(params.GasLimitBoundDivisor)
 	spec.Params.DurationLimit = (*math2.HexOrDecimal256)(params.DurationLimit)
 	spec.Params.BlockReward = (*hexutil.Big)(ongash.FrontierBlockReward)
+	if clique != nil {
+		// Clique doesn't reward the signers, but needs room for the seal
+		spec.SealEngine, spec.Clique = "Clique", clique
+		spec.Params.BlockReward = (*hexutil.Big)(new(big.Int))
+		spec.Params.MaximumExtraDataSize = cliqueMaxExtraDataSize
+	}
 
 	spec.Genesis.Nonce = types.EncodeNonce(genesis.Nonce)
 	spec.Genesis.MixHash = genesis.Mixhash
@@ -196,6 +440,12 @@ func newAlongGenesisSpec(network string, genesis *core.Genesis) (*alongGenesisSp
 			StartingBlock: (*hexutil.Big)(genesis.Config.IstanbulBlock),
 		})
 	}
+	// Alloc accounts at builtin addresses are merged into the builtin definition,
+	// which is probably not what the genesis author intended
+	for _, addr := range spec.precompileCollisions(genesis.Alloc) {
+		builtin := spec.Accounts[common.UnprefixedAddress(addr)].Precompiled.Name
+		log.Warn("Merging genesis alloc account into builtin", "address", addr, "builtin", builtin)
+	}
 	return spec, nil
 }
 
@@ -210,6 +460,22 @@ func (spec *alongGenesisSpec) setPrecompile(address byte, data *alongGenesisSpec
 	spec.Accounts[addr].Precompiled = data
 }
 
+// precompileCollisions returns the genesis alloc accounts, sorted by address,
+// which reside at the address of one of the builtins of the spec. The balance
+// and nonce of such accounts are merged into the builtin definition.
+func (spec *alongGenesisSpec) precompileCollisions(alloc core.GenesisAlloc) []common.Address {
+	var collisions []common.Address
+	for address := range alloc {
+		if account, ok := spec.Accounts[common.UnprefixedAddress(address)]; ok && account.Precompiled != nil {
+			collisions = append(collisions, address)
+		}
+	}
+	sort.Slice(collisions, func(i, j int) bool {
+		return bytes.Compare(collisions[i][:], collisions[j][:]) < 0
+	})
+	return collisions
+}
+
 func (spec *alongGenesisSpec) setAccount(address common.Address, account core.GenesisAccount) {
 	if spec.Accounts == nil {
 		spec.Accounts = make(map[common.UnprefixedAddress]*alongGenesisSpecAccount)
@@ -225,72 +491,135 @@ func (spec *alongGenesisSpec) setAccount(address common.Address, account core.Ge
 
 }
 
+// WriteAlongGenesisSpec serializes an Along genesis spec into the writer as
+// indented JSON, terminated by a newline.
+func WriteAlongGenesisSpec(w io.Writer, spec *alongGenesisSpec) error {
+	return writeChainSpecJSON(w, spec)
+}
+
+// writeChainSpecJSON serializes a chain spec into the writer as indented JSON,
+// terminated by a newline. All chain spec writers must go through it to keep the
+// output byte-identical to the golden files.
+func writeChainSpecJSON(w io.Writer, spec interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(spec)
+}
+
 // parityChainSpec is the chain specification format used by Parity.
 type parityChainSpec struct {
-	Name    string `json:"name"`
-	Datadir string `json:"dataDir"`
-	Engine  struct {
-		Ongash struct {
-			Params struct {
-				MinimumDifficulty      *hexutil.Big      `json:"minimumDifficulty"`
-				DifficultyBoundDivisor *hexutil.Big      `json:"difficultyBoundDivisor"`
-				DurationLimit          *hexutil.Big      `json:"durationLimit"`
-				BlockReward            map[string]string `json:"blockReward"`
-				DifficultyBombDelays   map[string]string `json:"difficultyBombDelays"`
-				HomesteadTransition    hexutil.Uint64    `json:"homesteadTransition"`
-				EIP100bTransition      hexutil.Uint64    `json:"eip100bTransition"`
-			} `json:"params"`
-		} `json:"Ongash"`
+	SpecVersion int    `json:"specVersion"`
+	Name        string `json:"name"`
+	Datadir     string `json:"dataDir"`
+	Engine      struct {
+		Ongash      *parityChainSpecOngash      `json:"Ongash,omitempty"`
+		Clique      *parityChainSpecClique      `json:"clique,omitempty"`
+		InstantSeal *parityChainSpecInstantSeal `json:"instantSeal,omitempty"`
 	} `json:"engine"`
 
+	Params  parityChainSpecParams  `json:"params"`
+	Genesis parityChainSpecGenesis `json:"genesis"`
+
+	Nodes       []string                                             `json:"nodes"`
+	StaticNodes []string                                             `json:"staticNodes,omitempty"`
+	Accounts    map[common.UnprefixedAddress]*parityChainSpecAccount `json:"accounts"`
+	Meta        *chainSpecMeta                                       `json:"meta,omitempty"`
+}
+
+// parityChainSpecParams is the fork and protocol parameter definition.
+type parityChainSpecParams struct {
+	AccountStartNonce         hexutil.Uint64       `json:"accountStartNonce"`
+	MaximumExtraDataSize      hexutil.Uint64       `json:"maximumExtraDataSize"`
+	MinGasLimit               hexutil.Uint64       `json:"minGasLimit"`
+	GasLimitBoundDivisor      math2.HexOrDecimal64 `json:"gasLimitBoundDivisor"`
+	NetworkID                 hexutil.Uint64       `json:"networkID"`
+	ChainID                   hexutil.Uint64       `json:"chainID"`
+	MaxCodeSize               hexutil.Uint64       `json:"maxCodeSize"`
+	MaxCodeSizeTransition     hexutil.Uint64       `json:"maxCodeSizeTransition"`
+	EIP98Transition           hexutil.Uint64       `json:"eip98Transition"`
+	EIP150Transition          hexutil.Uint64       `json:"eip150Transition"`
+	EIP160Transition          hexutil.Uint64       `json:"eip160Transition"`
+	EIP161abcTransition       hexutil.Uint64       `json:"eip161abcTransition"`
+	EIP161dTransition         hexutil.Uint64       `json:"eip161dTransition"`
+	EIP155Transition          hexutil.Uint64       `json:"eip155Transition"`
+	EIP140Transition          hexutil.Uint64       `json:"eip140Transition"`
+	EIP211Transition          hexutil.Uint64       `json:"eip211Transition"`
+	EIP214Transition          hexutil.Uint64       `json:"eip214Transition"`
+	EIP658Transition          hexutil.Uint64       `json:"eip658Transition"`
+	EIP145Transition          hexutil.Uint64       `json:"eip145Transition"`
+	EIP1014Transition         hexutil.Uint64       `json:"eip1014Transition"`
+	EIP1052Transition         hexutil.Uint64       `json:"eip1052Transition"`
+	EIP1283Transition         hexutil.Uint64       `json:"eip1283Transition"`
+	EIP1283DisableTransition  hexutil.Uint64       `json:"eip1283DisableTransition"`
+	EIP1283ReenableTransition hexutil.Uint64       `json:"eip1283ReenableTransition"`
+	EIP1344Transition         hexutil.Uint64       `json:"eip1344Transition"`
+	EIP1884Transition         hexutil.Uint64       `json:"eip1884Transition"`
+	EIP2028Transition         hexutil.Uint64       `json:"eip2028Transition"`
+
+	// London fee market fields are only emitted if the fork is scheduled
+	EIP1559Transition                  *hexutil.Uint64 `json:"eip1559Transition,omitempty"`
+	EIP3198Transition                  *hexutil.Uint64 `json:"eip3198Transition,omitempty"`
+	EIP3529Transition                  *hexutil.Uint64 `json:"eip3529Transition,omitempty"`
+	EIP3541Transition                  *hexutil.Uint64 `json:"eip3541Transition,omitempty"`
+	EIP1559BaseFeeMaxChangeDenominator *hexutil.Uint64 `json:"eip1559BaseFeeMaxChangeDenominator,omitempty"`
+	EIP1559ElasticityMultiplier        *hexutil.Uint64 `json:"eip1559ElasticityMultiplier,omitempty"`
+	EIP1559BaseFeeInitialValue         *hexutil.Big    `json:"eip1559BaseFeeInitialValue,omitempty"`
+
+	// Post-merge forks are activated by timestamp instead of block number
+	EIP3651TransitionTimestamp *hexutil.Uint64 `json:"eip3651TransitionTimestamp,omitempty"`
+	EIP3855TransitionTimestamp *hexutil.Uint64 `json:"eip3855TransitionTimestamp,omitempty"`
+	EIP3860TransitionTimestamp *hexutil.Uint64 `json:"eip3860TransitionTimestamp,omitempty"`
+	EIP4895TransitionTimestamp *hexutil.Uint64 `json:"eip4895TransitionTimestamp,omitempty"`
+	EIP1153TransitionTimestamp *hexutil.Uint64 `json:"eip1153TransitionTimestamp,omitempty"`
+	EIP4788TransitionTimestamp *hexutil.Uint64 `json:"eip4788TransitionTimestamp,omitempty"`
+	EIP4844TransitionTimestamp *hexutil.Uint64 `json:"eip4844TransitionTimestamp,omitempty"`
+	EIP5656TransitionTimestamp *hexutil.Uint64 `json:"eip5656TransitionTimestamp,omitempty"`
+	EIP6780TransitionTimestamp *hexutil.Uint64 `json:"eip6780TransitionTimestamp,omitempty"`
+
+	// Replay protection changes, mapping fork blocks to their new chain ids
+	ChainIDTransitions map[string]hexutil.Uint64 `json:"chainIDTransitions,omitempty"`
+}
+
+// parityChainSpecGenesis is the genesis block definition.
+type parityChainSpecGenesis struct {
+	Seal struct {
+		Orange struct {
+			Nonce   types.BlockNonce `json:"nonce"`
+			MixHash hexutil.Bytes    `json:"mixHash"`
+		} `json:"orange"`
+	} `json:"seal"`
+
+	Difficulty *hexutil.Big   `json:"difficulty"`
+	Author     common.Address `json:"author"`
+	Timestamp  hexutil.Uint64 `json:"timestamp"`
+	ParentHash common.Hash    `json:"parentHash"`
+	ExtraData  hexutil.Bytes  `json:"extraData"`
+	GasLimit   hexutil.Uint64 `json:"gasLimit"`
+	StateRoot  *common.Hash   `json:"stateRoot,omitempty"`
+}
+
+// parityChainSpecOngash is the proof-of-work consensus engine definition.
+type parityChainSpecOngash struct {
 	Params struct {
-		AccountStartNonce         hexutil.Uint64       `json:"accountStartNonce"`
-		MaximumExtraDataSize      hexutil.Uint64       `json:"maximumExtraDataSize"`
-		MinGasLimit               hexutil.Uint64       `json:"minGasLimit"`
-		GasLimitBoundDivisor      math2.HexOrDecimal64 `json:"gasLimitBoundDivisor"`
-		NetworkID                 hexutil.Uint64       `json:"networkID"`
-		ChainID                   hexutil.Uint64       `json:"chainID"`
-		MaxCodeSize               hexutil.Uint64       `json:"maxCodeSize"`
-		MaxCodeSizeTransition     hexutil.Uint64       `json:"maxCodeSizeTransition"`
-		EIP98Transition           hexutil.Uint64       `json:"eip98Transition"`
-		EIP150Transition          hexutil.Uint64       `json:"eip150Transition"`
-		EIP160Transition          hexutil.Uint64       `json:"eip160Transition"`
-		EIP161abcTransition       hexutil.Uint64       `json:"eip161abcTransition"`
-		EIP161dTransition         hexutil.Uint64       `json:"eip161dTransition"`
-		EIP155Transition          hexutil.Uint64       `json:"eip155Transition"`
-		EIP140Transition          hexutil.Uint64       `json:"eip140Transition"`
-		EIP211Transition          hexutil.Uint64       `json:"eip211Transition"`
-		EIP214Transition          hexutil.Uint64       `json:"eip214Transition"`
-		EIP658Transition          hexutil.Uint64       `json:"eip658Transition"`
-		EIP145Transition          hexutil.Uint64       `json:"eip145Transition"`
-		EIP1014Transition         hexutil.Uint64       `json:"eip1014Transition"`
-		EIP1052Transition         hexutil.Uint64       `json:"eip1052Transition"`
-		EIP1283Transition         hexutil.Uint64       `json:"eip1283Transition"`
-		EIP1283DisableTransition  hexutil.Uint64       `json:"eip1283DisableTransition"`
-		EIP1283ReenableTransition hexutil.Uint64       `json:"eip1283ReenableTransition"`
-		EIP1344Transition         hexutil.Uint64       `json:"eip1344Transition"`
-		EIP1884Transition         hexutil.Uint64       `json:"eip1884Transition"`
-		EIP2028Transition         hexutil.Uint64       `json:"eip2028Transition"`
+		MinimumDifficulty      *hexutil.Big      `json:"minimumDifficulty"`
+		DifficultyBoundDivisor *hexutil.Big      `json:"difficultyBoundDivisor"`
+		DurationLimit          *hexutil.Big      `json:"durationLimit"`
+		BlockReward            map[string]string `json:"blockReward"`
+		DifficultyBombDelays   map[string]string `json:"difficultyBombDelays"`
+		HomesteadTransition    hexutil.Uint64    `json:"homesteadTransition"`
+		EIP100bTransition      hexutil.Uint64    `json:"eip100bTransition"`
 	} `json:"params"`
+}
 
-	Genesis struct {
-		Seal struct {
-			Orange struct {
-				Nonce   types.BlockNonce `json:"nonce"`
-				MixHash hexutil.Bytes    `json:"mixHash"`
-			} `json:"orange"`
-		} `json:"seal"`
-
-		Difficulty *hexutil.Big   `json:"difficulty"`
-		Author     common.Address `json:"author"`
-		Timestamp  hexutil.Uint64 `json:"timestamp"`
-		ParentHash common.Hash    `json:"parentHash"`
-		ExtraData  hexutil.Bytes  `json:"extraData"`
-		GasLimit   hexutil.Uint64 `json:"gasLimit"`
-	} `json:"genesis"`
+// parityChainSpecClique is the proof-of-authority consensus engine definition.
+type parityChainSpecClique struct {
+	Params chainSpecClique `json:"params"`
+}
 
-	Nodes    []string                                             `json:"nodes"`
-	Accounts map[common.UnprefixedAddress]*parityChainSpecAccount `json:"accounts"`
+// parityChainSpecInstantSeal is the development consensus engine definition,
+// sealing a block for every transaction without any proof of work.
+type parityChainSpecInstantSeal struct {
+	Params struct{} `json:"params"`
 }
 
 // parityChainSpecAccount is the prefunded genesis account and/or precompiled
@@ -363,27 +692,54 @@ type parityChainSpecVersionedPricing struct {
 
 // newParityChainSpec converts a go-orange genesis block into a Parity specific
 // chain specification format.
-func newParityChainSpec(network string, genesis *core.Genesis, bootnodes []string) (*parityChainSpec, error) {
-	// Only ongash is currently supported between go-orange and Parity
-	if genesis.Config.Ongash == nil {
-		return nil, errors.New("unsupported consensus engine")
+func newParityChainSpec(network string, genesis *chainGenesis, bootnodes []string) (*parityChainSpec, error) {
+	spec, _, err := newParityChainSpecWithReport(network, genesis, bootnodes)
+	return spec, err
+}
+
+// newParityChainSpecWithReport converts a go-orange genesis block into a Parity
+// specific chain specification format, additionally reporting the genesis fields
+// which were set, but dropped since the Parity format can't represent them.
+func newParityChainSpecWithReport(network string, genesis *chainGenesis, bootnodes []string) (*parityChainSpec, []string, error) {
+	// Only ongash and clique are currently supported between go-orange and Parity
+	var clique *chainSpecClique
+	switch {
+	case genesis.Config.Clique != nil:
+		var err error
+		if clique, err = newChainSpecClique(genesis.Config.Clique, genesis.ExtraData); err != nil {
+			return nil, nil, err
+		}
+	case genesis.Config.Ongash == nil:
+		return nil, nil, errors.New("unsupported consensus engine")
+	}
+	if err := validateForkOrder(genesis); err != nil {
+		return nil, nil, err
+	}
+	if err := validateAllocBalances(genesis.Alloc); err != nil {
+		return nil, nil, err
 	}
 	// Reconstruct the chain spec in Parity's format
 	spec := &parityChainSpec{
-		Name:    network,
-		Nodes:   bootnodes,
-		Datadir: strings.ToLower(network),
+		SpecVersion: chainSpecVersion,
+		Name:        network,
+		Nodes:       bootnodes,
+		Datadir:     strings.ToLower(network),
 	}
-	spec.Engine.Ongash.Params.BlockReward = make(map[string]string)
-	spec.Engine.Ongash.Params.DifficultyBombDelays = make(map[string]string)
-	// Frontier
-	spec.Engine.Ongash.Params.MinimumDifficulty = (*hexutil.Big)(params.MinimumDifficulty)
-	spec.Engine.Ongash.Params.DifficultyBoundDivisor = (*hexutil.Big)(params.DifficultyBoundDivisor)
-	spec.Engine.Ongash.Params.DurationLimit = (*hexutil.Big)(params.DurationLimit)
-	spec.Engine.Ongash.Params.BlockReward["0x0"] = hexutil.EncodeBig(ongash.FrontierBlockReward)
+	if clique != nil {
+		spec.Engine.Clique = &parityChainSpecClique{Params: *clique}
+	} else {
+		spec.Engine.Ongash = new(parityChainSpecOngash)
+		spec.Engine.Ongash.Params.BlockReward = make(map[string]string)
+		spec.Engine.Ongash.Params.DifficultyBombDelays = make(map[string]string)
+		// Frontier
+		spec.Engine.Ongash.Params.MinimumDifficulty = (*hexutil.Big)(params.MinimumDifficulty)
+		spec.Engine.Ongash.Params.DifficultyBoundDivisor = (*hexutil.Big)(params.DifficultyBoundDivisor)
+		spec.Engine.Ongash.Params.DurationLimit = (*hexutil.Big)(params.DurationLimit)
+		spec.Engine.Ongash.Params.BlockReward["0x0"] = hexutil.EncodeBig(ongash.FrontierBlockReward)
 
-	// Homestead
-	spec.Engine.Ongash.Params.HomesteadTransition = hexutil.Uint64(genesis.Config.HomesteadBlock.Uint64())
+		// Homestead
+		spec.Engine.Ongash.Params.HomesteadTransition = hexutil.Uint64(genesis.Config.HomesteadBlock.Uint64())
+	}
 
 	// Tangerine Whistle : 150
 	// https://github.com/ong2020/EIPs/blob/master/EIPS/eip-608.md
@@ -412,7 +768,22 @@ func newParityChainSpec(network string, genesis *core.Genesis, bootnodes []strin
 	if num := genesis.Config.IstanbulBlock; num != nil {
 		spec.setIstanbul(num)
 	}
+	// London
+	if num := genesis.Forks.LondonBlock; num != nil {
+		spec.setLondon(num, genesis)
+	}
+	// Shanghai
+	if time := genesis.Forks.ShanghaiTime; time != nil {
+		spec.setShanghai(*time)
+	}
+	// Cancun
+	if time := genesis.Forks.CancunTime; time != nil {
+		spec.setCancun(*time)
+	}
 	spec.Params.MaximumExtraDataSize = (hexutil.Uint64)(params.MaximumExtraDataSize)
+	if clique != nil {
+		spec.Params.MaximumExtraDataSize = cliqueMaxExtraDataSize
+	}
 	spec.Params.MinGasLimit = (hexutil.Uint64)(params.MinGasLimit)
 	spec.Params.GasLimitBoundDivisor = (math2.HexOrDecimal64)(params.GasLimitBoundDivisor)
 	spec.Params.NetworkID = (hexutil.Uint64)(genesis.Config.ChainID.Uint64())
@@ -486,7 +857,7 @@ func newParityChainSpec(network string, genesis *core.Genesis, bootnodes []strin
 	}
 	if genesis.Config.IstanbulBlock != nil {
 		if genesis.Config.ByzantiumBlock == nil {
-			return nil, errors.New("invalid genesis, istanbul fork is enabled while byzantium is not")
+			return nil, nil, errors.New("invalid genesis, istanbul fork is enabled while byzantium is not")
 		}
 		spec.setPrecompile(6, &parityChainSpecBuiltin{
 			Name:       "alt_bn128_add",
@@ -544,7 +915,57 @@ func newParityChainSpec(network string, genesis *core.Genesis, bootnodes []strin
 			},
 		})
 	}
-	return spec, nil
+	return spec, parityDroppedFields(genesis), nil
+}
+
+// parityDroppedFields lists the fields of a genesis which are set, but can't be
+// represented in a Parity chain spec.
+func parityDroppedFields(genesis *chainGenesis) []string {
+	var (
+		config  = genesis.Config
+		dropped []string
+	)
+	if config.DAOForkBlock != nil {
+		dropped = append(dropped, fmt.Sprintf("daoForkBlock %v dropped, the DAO fork is not supported", config.DAOForkBlock))
+	}
+	if config.EIP150Hash != (common.Hash{}) {
+		dropped = append(dropped, fmt.Sprintf("eip150Hash %x dropped", config.EIP150Hash))
+	}
+	if config.MuirGlacierBlock != nil {
+		dropped = append(dropped, fmt.Sprintf("muirGlacierBlock %v dropped, the bomb delay is not scheduled", config.MuirGlacierBlock))
+	}
+	if config.BerlinBlock != nil {
+		dropped = append(dropped, fmt.Sprintf("berlinBlock %v dropped, Berlin is not scheduled", config.BerlinBlock))
+	}
+	if config.YoloV3Block != nil {
+		dropped = append(dropped, fmt.Sprintf("yoloV3Block %v dropped", config.YoloV3Block))
+	}
+	if config.EWASMBlock != nil {
+		dropped = append(dropped, fmt.Sprintf("ewasmBlock %v dropped", config.EWASMBlock))
+	}
+	if genesis.Number != 0 {
+		dropped = append(dropped, fmt.Sprintf("number %d dropped", genesis.Number))
+	}
+	if genesis.GasUsed != 0 {
+		dropped = append(dropped, fmt.Sprintf("gasUsed %d dropped", genesis.GasUsed))
+	}
+	addresses := make([]common.Address, 0, len(genesis.Alloc))
+	for address := range genesis.Alloc {
+		addresses = append(addresses, address)
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		return bytes.Compare(addresses[i][:], addresses[j][:]) < 0
+	})
+	for _, address := range addresses {
+		account := genesis.Alloc[address]
+		if len(account.Code) > 0 {
+			dropped = append(dropped, fmt.Sprintf("code of alloc account %s dropped", address.Hex()))
+		}
+		if len(account.Storage) > 0 {
+			dropped = append(dropped, fmt.Sprintf("storage of alloc account %s dropped", address.Hex()))
+		}
+	}
+	return dropped
 }
 
 func (spec *parityChainSpec) setPrecompile(address byte, data *parityChainSpecBuiltin) {
@@ -559,10 +980,12 @@ func (spec *parityChainSpec) setPrecompile(address byte, data *parityChainSpecBu
 }
 
 func (spec *parityChainSpec) setByzantium(num *big.Int) {
-	spec.Engine.Ongash.Params.BlockReward[hexutil.EncodeBig(num)] = hexutil.EncodeBig(ongash.ByzantiumBlockReward)
-	spec.Engine.Ongash.Params.DifficultyBombDelays[hexutil.EncodeBig(num)] = hexutil.EncodeUint64(3000000)
 	n := hexutil.Uint64(num.Uint64())
-	spec.Engine.Ongash.Params.EIP100bTransition = n
+	if spec.Engine.Ongash != nil {
+		spec.Engine.Ongash.Params.BlockReward[hexutil.EncodeBig(num)] = hexutil.EncodeBig(ongash.ByzantiumBlockReward)
+		spec.Engine.Ongash.Params.DifficultyBombDelays[hexutil.EncodeBig(num)] = hexutil.EncodeUint64(3000000)
+		spec.Engine.Ongash.Params.EIP100bTransition = n
+	}
 	spec.Params.EIP140Transition = n
 	spec.Params.EIP211Transition = n
 	spec.Params.EIP214Transition = n
@@ -570,8 +993,10 @@ func (spec *parityChainSpec) setByzantium(num *big.Int) {
 }
 
 func (spec *parityChainSpec) setConstantinople(num *big.Int) {
-	spec.Engine.Ongash.Params.BlockReward[hexutil.EncodeBig(num)] = hexutil.EncodeBig(ongash.ConstantinopleBlockReward)
-	spec.Engine.Ongash.Params.DifficultyBombDelays[hexutil.EncodeBig(num)] = hexutil.EncodeUint64(2000000)
+	if spec.Engine.Ongash != nil {
+		spec.Engine.Ongash.Params.BlockReward[hexutil.EncodeBig(num)] = hexutil.EncodeBig(ongash.ConstantinopleBlockReward)
+		spec.Engine.Ongash.Params.DifficultyBombDelays[hexutil.EncodeBig(num)] = hexutil.EncodeUint64(2000000)
+	}
 	n := hexutil.Uint64(num.Uint64())
 	spec.Params.EIP145Transition = n
 	spec.Params.EIP1014Transition = n
@@ -590,6 +1015,165 @@ func (spec *parityChainSpec) setIstanbul(num *big.Int) {
 	spec.Params.EIP1283ReenableTransition = hexutil.Uint64(num.Uint64())
 }
 
+// setLondon schedules the EIP-1559 fee market along with the rest of London.
+func (spec *parityChainSpec) setLondon(num *big.Int, genesis *chainGenesis) {
+	n := hexutil.Uint64(num.Uint64())
+	spec.Params.EIP1559Transition = &n
+	spec.Params.EIP3198Transition = &n
+	spec.Params.EIP3529Transition = &n
+	spec.Params.EIP3541Transition = &n
+
+	denominator, elasticity := feeMarketParams(&genesis.Forks)
+	spec.Params.EIP1559BaseFeeMaxChangeDenominator = (*hexutil.Uint64)(&denominator)
+	spec.Params.EIP1559ElasticityMultiplier = (*hexutil.Uint64)(&elasticity)
+	spec.Params.EIP1559BaseFeeInitialValue = (*hexutil.Big)(genesis.baseFee())
+}
+
+// setChainIDTransitions schedules chain id (replay protection) changes at the
+// given fork blocks.
+func (spec *parityChainSpec) setChainIDTransitions(transitions map[uint64]uint64) {
+	spec.Params.ChainIDTransitions = make(map[string]hexutil.Uint64)
+	for block, id := range transitions {
+		spec.Params.ChainIDTransitions[hexutil.EncodeUint64(block)] = hexutil.Uint64(id)
+	}
+}
+
+func (spec *parityChainSpec) setShanghai(time uint64) {
+	t := hexutil.Uint64(time)
+	spec.Params.EIP3651TransitionTimestamp = &t
+	spec.Params.EIP3855TransitionTimestamp = &t
+	spec.Params.EIP3860TransitionTimestamp = &t
+	spec.Params.EIP4895TransitionTimestamp = &t
+}
+
+func (spec *parityChainSpec) setCancun(time uint64) {
+	t := hexutil.Uint64(time)
+	spec.Params.EIP1153TransitionTimestamp = &t
+	spec.Params.EIP4788TransitionTimestamp = &t
+	spec.Params.EIP4844TransitionTimestamp = &t
+	spec.Params.EIP5656TransitionTimestamp = &t
+	spec.Params.EIP6780TransitionTimestamp = &t
+}
+
+// newGenesisFromParitySpec converts a Parity chain specification back into a
+// go-orange genesis block, reversing newParityChainSpec. The fields not carried
+// by the Parity spec can't be recovered and are left unset:
+//
+//   - the DAO fork, the EIP-150 hash, Muir Glacier and Berlin are not emitted
+//   - the code and storage of the alloc accounts are not emitted
+//   - the consensus test only block number and gas used are not emitted
+//   - empty precompile accounts are indistinguishable from the builtins
+//
+// Some fields round-trip into an equivalent, but not identical configuration:
+// an unset Petersburg is recovered as activating alongside Constantinople and
+// fee market parameters matching the mainnet defaults are recovered as unset.
+func newGenesisFromParitySpec(spec *parityChainSpec) (*chainGenesis, error) {
+	if spec.Engine.Ongash == nil {
+		return nil, errors.New("unsupported consensus engine")
+	}
+	if spec.Genesis.StateRoot != nil {
+		return nil, errors.New("chain spec omits the alloc, only carrying its state root")
+	}
+	config := &params.ChainConfig{
+		ChainID:        new(big.Int).SetUint64(uint64(spec.Params.ChainID)),
+		HomesteadBlock: new(big.Int).SetUint64(uint64(spec.Engine.Ongash.Params.HomesteadTransition)),
+		EIP150Block:    new(big.Int).SetUint64(uint64(spec.Params.EIP150Transition)),
+		EIP155Block:    new(big.Int).SetUint64(uint64(spec.Params.EIP155Transition)),
+		EIP158Block:    new(big.Int).SetUint64(uint64(spec.Params.EIP161abcTransition)),
+		Ongash:         new(params.OngashConfig),
+	}
+	// Byzantium and Istanbul are only unambiguous from their precompiles, since
+	// the transitions of unscheduled forks are emitted as zero
+	if num := spec.precompileActivation(5); num != nil {
+		config.ByzantiumBlock = num
+	}
+	if num := spec.precompileActivation(9); num != nil {
+		config.IstanbulBlock = num
+	}
+	// Constantinople is the only fork delaying the difficulty bomb by 2M blocks
+	for block, delay := range spec.Engine.Ongash.Params.DifficultyBombDelays {
+		if delay != hexutil.EncodeUint64(2000000) {
+			continue
+		}
+		num, err := hexutil.DecodeBig(block)
+		if err != nil {
+			return nil, fmt.Errorf("invalid difficulty bomb delay block %q: %v", block, err)
+		}
+		config.ConstantinopleBlock = num
+	}
+	if config.ConstantinopleBlock != nil {
+		config.PetersburgBlock = new(big.Int).SetUint64(uint64(spec.Params.EIP1283DisableTransition))
+		if config.PetersburgBlock.Cmp(config.ConstantinopleBlock) < 0 {
+			config.PetersburgBlock = new(big.Int).Set(config.ConstantinopleBlock)
+		}
+	}
+	genesis := newChainGenesis(&core.Genesis{
+		Config:     config,
+		Nonce:      spec.Genesis.Seal.Orange.Nonce.Uint64(),
+		Timestamp:  uint64(spec.Genesis.Timestamp),
+		ExtraData:  common.CopyBytes(spec.Genesis.ExtraData),
+		GasLimit:   uint64(spec.Genesis.GasLimit),
+		Mixhash:    common.BytesToHash(spec.Genesis.Seal.Orange.MixHash),
+		Coinbase:   spec.Genesis.Author,
+		ParentHash: spec.Genesis.ParentHash,
+		Alloc:      make(core.GenesisAlloc),
+	})
+	if num := spec.Params.EIP1559Transition; num != nil {
+		genesis.Forks.LondonBlock = new(big.Int).SetUint64(uint64(*num))
+		if d := spec.Params.EIP1559BaseFeeMaxChangeDenominator; d != nil && uint64(*d) != defaultBaseFeeChangeDenominator {
+			denominator := uint64(*d)
+			genesis.Forks.BaseFeeChangeDenominator = &denominator
+		}
+		if e := spec.Params.EIP1559ElasticityMultiplier; e != nil && uint64(*e) != defaultElasticityMultiplier {
+			elasticity := uint64(*e)
+			genesis.Forks.ElasticityMultiplier = &elasticity
+		}
+		if fee := spec.Params.EIP1559BaseFeeInitialValue; fee != nil && (*big.Int)(fee).Cmp(genesis.baseFee()) != 0 {
+			genesis.BaseFee = new(big.Int).Set((*big.Int)(fee))
+		}
+	}
+	if t := spec.Params.EIP3855TransitionTimestamp; t != nil {
+		time := uint64(*t)
+		genesis.Forks.ShanghaiTime = &time
+	}
+	if t := spec.Params.EIP1153TransitionTimestamp; t != nil {
+		time := uint64(*t)
+		genesis.Forks.CancunTime = &time
+	}
+	if spec.Genesis.Difficulty != nil {
+		genesis.Difficulty = new(big.Int).Set((*big.Int)(spec.Genesis.Difficulty))
+	}
+	for address, account := range spec.Accounts {
+		balance := (*big.Int)(&account.Balance)
+
+		// Skip the builtins which were only added as precompile definitions
+		if account.Builtin != nil && balance.Sign() == 0 && account.Nonce == 0 {
+			continue
+		}
+		genesis.Alloc[common.Address(address)] = core.GenesisAccount{
+			Balance: new(big.Int).Set(balance),
+			Nonce:   uint64(account.Nonce),
+		}
+	}
+	return genesis, nil
+}
+
+// precompileActivation returns the activation block of a builtin contract, or
+// nil if the builtin is not defined or has no activation block.
+func (spec *parityChainSpec) precompileActivation(address byte) *big.Int {
+	account, ok := spec.Accounts[common.UnprefixedAddress(common.BytesToAddress([]byte{address}))]
+	if !ok || account.Builtin == nil || account.Builtin.ActivateAt == nil {
+		return nil
+	}
+	return new(big.Int).Set((*big.Int)(account.Builtin.ActivateAt))
+}
+
+// WriteParityChainSpec serializes a Parity chain spec into the writer as indented
+// JSON, terminated by a newline.
+func WriteParityChainSpec(w io.Writer, spec *parityChainSpec) error {
+	return writeChainSpecJSON(w, spec)
+}
+
 // pyOrangeGenesisSpec represents the genesis specification format used by the
 // Python Orange implementation.
 type pyOrangeGenesisSpec struct {
@@ -606,7 +1190,7 @@ type pyOrangeGenesisSpec struct {
 
 // newPyOrangeGenesisSpec converts a go-orange genesis block into a Parity specific
 // chain specification format.
-func newPyOrangeGenesisSpec(network string, genesis *core.Genesis) (*pyOrangeGenesisSpec, error) {
+func newPyOrangeGenesisSpec(network string, genesis *chainGenesis) (*pyOrangeGenesisSpec, error) {
 	// Only ongash is currently supported between go-orange and pyorange
 	if genesis.Config.Ongash == nil {
 		return nil, errors.New("unsupported consensus engine")
@@ -624,3 +1208,166 @@ func newPyOrangeGenesisSpec(network string, genesis *core.Genesis) (*pyOrangeGen
 	}
 	return spec, nil
 }
+
+// besuGenesisSpec represents the genesis specification format used by the
+// Hyperledger Besu implementation.
+type besuGenesisSpec struct {
+	Config struct {
+		ChainID             *big.Int               `json:"chainId"`
+		HomesteadBlock      *big.Int               `json:"homesteadBlock,omitempty"`
+		EIP150Block         *big.Int               `json:"eip150Block,omitempty"`
+		EIP155Block         *big.Int               `json:"eip155Block,omitempty"`
+		EIP158Block         *big.Int               `json:"eip158Block,omitempty"`
+		ByzantiumBlock      *big.Int               `json:"byzantiumBlock,omitempty"`
+		ConstantinopleBlock *big.Int               `json:"constantinopleBlock,omitempty"`
+		PetersburgBlock     *big.Int               `json:"petersburgBlock,omitempty"`
+		IstanbulBlock       *big.Int               `json:"istanbulBlock,omitempty"`
+		BerlinBlock         *big.Int               `json:"berlinBlock,omitempty"`
+		LondonBlock         *big.Int               `json:"londonBlock,omitempty"`
+		Ongash              *besuGenesisSpecOngash `json:"ongash,omitempty"`
+
+		// Fee market parameters, only emitted if London is scheduled
+		BaseFeeChangeDenominator *uint64 `json:"baseFeeMaxChangeDenominator,omitempty"`
+		ElasticityMultiplier     *uint64 `json:"elasticityMultiplier,omitempty"`
+	} `json:"config"`
+
+	Nonce      hexutil.Uint64                                       `json:"nonce"`
+	Timestamp  hexutil.Uint64                                       `json:"timestamp"`
+	ExtraData  hexutil.Bytes                                        `json:"extraData"`
+	GasLimit   hexutil.Uint64                                       `json:"gasLimit"`
+	Difficulty *hexutil.Big                                         `json:"difficulty"`
+	MixHash    common.Hash                                          `json:"mixHash"`
+	Coinbase   common.Address                                       `json:"coinbase"`
+	Alloc      map[common.UnprefixedAddress]*besuGenesisSpecAccount `json:"alloc"`
+}
+
+// besuGenesisSpecOngash is the proof-of-work consensus engine definition. A fixed
+// difficulty disables the difficulty adjustment, easing mining on dev chains.
+type besuGenesisSpecOngash struct {
+	FixedDifficulty *uint64 `json:"fixeddifficulty,omitempty"`
+}
+
+// besuGenesisSpecAccount is the prefunded genesis account and/or precompiled
+// contract definition.
+type besuGenesisSpecAccount struct {
+	Balance *hexutil.Big                `json:"balance"`
+	Nonce   hexutil.Uint64              `json:"nonce,omitempty"`
+	Code    hexutil.Bytes               `json:"code,omitempty"`
+	Storage map[common.Hash]common.Hash `json:"storage,omitempty"`
+}
+
+// newBesuGenesisSpec converts a go-orange genesis block into a Besu specific
+// genesis specification format.
+func newBesuGenesisSpec(network string, genesis *chainGenesis) (*besuGenesisSpec, error) {
+	// Only ongash is currently supported between go-orange and besu
+	if genesis.Config.Ongash == nil {
+		return nil, errors.New("unsupported consensus engine")
+	}
+	if err := validateForkOrder(genesis); err != nil {
+		return nil, err
+	}
+	if err := validateAllocBalances(genesis.Alloc); err != nil {
+		return nil, err
+	}
+	spec := &besuGenesisSpec{
+		Nonce:      (hexutil.Uint64)(genesis.Nonce),
+		Timestamp:  (hexutil.Uint64)(genesis.Timestamp),
+		ExtraData:  genesis.ExtraData,
+		GasLimit:   (hexutil.Uint64)(genesis.GasLimit),
+		Difficulty: (*hexutil.Big)(genesis.Difficulty),
+		MixHash:    genesis.Mixhash,
+		Coinbase:   genesis.Coinbase,
+		Alloc:      make(map[common.UnprefixedAddress]*besuGenesisSpecAccount),
+	}
+	spec.Config.ChainID = genesis.Config.ChainID
+	spec.Config.HomesteadBlock = genesis.Config.HomesteadBlock
+	spec.Config.EIP150Block = genesis.Config.EIP150Block
+	spec.Config.EIP155Block = genesis.Config.EIP155Block
+	spec.Config.EIP158Block = genesis.Config.EIP158Block
+	spec.Config.ByzantiumBlock = genesis.Config.ByzantiumBlock
+	spec.Config.ConstantinopleBlock = genesis.Config.ConstantinopleBlock
+	spec.Config.PetersburgBlock = genesis.Config.PetersburgBlock
+	spec.Config.IstanbulBlock = genesis.Config.IstanbulBlock
+	spec.Config.BerlinBlock = genesis.Config.BerlinBlock
+	spec.Config.LondonBlock = genesis.Forks.LondonBlock
+	spec.Config.Ongash = new(besuGenesisSpecOngash)
+
+	if genesis.Forks.LondonBlock != nil {
+		denominator, elasticity := feeMarketParams(&genesis.Forks)
+		spec.Config.BaseFeeChangeDenominator = &denominator
+		spec.Config.ElasticityMultiplier = &elasticity
+	}
+
+	for address, account := range genesis.Alloc {
+		spec.Alloc[common.UnprefixedAddress(address)] = &besuGenesisSpecAccount{
+			Balance: (*hexutil.Big)(account.Balance),
+			Nonce:   (hexutil.Uint64)(account.Nonce),
+			Code:    account.Code,
+			Storage: account.Storage,
+		}
+	}
+	return spec, nil
+}
+
+// nethermindChainSpec is the chain specification format used by Nethermind. It
+// is derived from the Parity format, but also carries the code and storage of
+// the genesis accounts.
+type nethermindChainSpec struct {
+	SpecVersion int    `json:"specVersion"`
+	Name        string `json:"name"`
+	Datadir     string `json:"dataDir"`
+	Engine      struct {
+		Ongash *parityChainSpecOngash `json:"Ongash,omitempty"`
+		Clique *parityChainSpecClique `json:"clique,omitempty"`
+	} `json:"engine"`
+
+	Params  parityChainSpecParams  `json:"params"`
+	Genesis parityChainSpecGenesis `json:"genesis"`
+
+	Nodes    []string                                                 `json:"nodes"`
+	Accounts map[common.UnprefixedAddress]*nethermindChainSpecAccount `json:"accounts"`
+}
+
+// nethermindChainSpecAccount is the prefunded genesis account and/or precompiled
+// contract definition.
+type nethermindChainSpecAccount struct {
+	Balance math2.HexOrDecimal256       `json:"balance"`
+	Nonce   math2.HexOrDecimal64        `json:"nonce,omitempty"`
+	Code    hexutil.Bytes               `json:"code,omitempty"`
+	Storage map[common.Hash]common.Hash `json:"storage,omitempty"`
+	Builtin *parityChainSpecBuiltin     `json:"builtin,omitempty"`
+}
+
+// newNethermindChainSpec converts a go-orange genesis block into a Nethermind
+// specific chain specification format.
+func newNethermindChainSpec(network string, genesis *chainGenesis, bootnodes []string) (*nethermindChainSpec, error) {
+	// The Nethermind format is derived from Parity's, so convert via the latter
+	parity, err := newParityChainSpec(network, genesis, bootnodes)
+	if err != nil {
+		return nil, err
+	}
+	spec := &nethermindChainSpec{
+		SpecVersion: parity.SpecVersion,
+		Name:        parity.Name,
+		Datadir:     parity.Datadir,
+		Params:      parity.Params,
+		Genesis:     parity.Genesis,
+		Nodes:       parity.Nodes,
+		Accounts:    make(map[common.UnprefixedAddress]*nethermindChainSpecAccount),
+	}
+	spec.Engine.Ongash, spec.Engine.Clique = parity.Engine.Ongash, parity.Engine.Clique
+
+	// Carry over the builtins and balances, adding the code and storage Parity drops
+	for address, account := range parity.Accounts {
+		spec.Accounts[address] = &nethermindChainSpecAccount{
+			Balance: account.Balance,
+			Nonce:   account.Nonce,
+			Builtin: account.Builtin,
+		}
+	}
+	for address, account := range genesis.Alloc {
+		spec.Accounts[common.UnprefixedAddress(address)].Code = account.Code
+		spec.Accounts[common.UnprefixedAddress(address)].Storage = account.Storage
+	}
+	return spec, nil
+}
@@ -19,26 +19,39 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"io"
 	"io/ioutil"
+	"math/big"
 	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/davecgh/go-spew/spew"
+	"github.com/ong2020/go-orange/common"
 	"github.com/ong2020/go-orange/core"
+	"github.com/ong2020/go-orange/core/types"
+	"github.com/ong2020/go-orange/crypto"
+	"github.com/ong2020/go-orange/params"
+	"github.com/ong2020/go-orange/rlp"
 )
 
+// sturebyBootnodes are the bootnodes injected into the Stureby chainspecs.
+var sturebyBootnodes = []string{
+	"enode://d860a01f9722d78051619d1e2351aba3f43f943f6f00718d1b9baa4101932a1f5011f16bb2b1bb35db20d6fe28fa0bf09636d26a87d31de9ec6203eeedb1f666@18.138.108.67:30303",
+	"enode://22a8232c3abc76a16ae9d6c3b164f98775fe226f0917b0ca871128a74a8e9630b458460865bab457221f1d448dd9791d24c4e5d88786180ac185df813a68d4de@3.209.45.79:30303",
+}
+
 // Tests the go-orange to Along chainspec conversion for the Stureby testnet.
 func TestAlongSturebyConverter(t *testing.T) {
 	blob, err := ioutil.ReadFile("testdata/stureby_gong.json")
 	if err != nil {
 		t.Fatalf("could not read file: %v", err)
 	}
-	var genesis core.Genesis
+	var genesis chainGenesis
 	if err := json.Unmarshal(blob, &genesis); err != nil {
 		t.Fatalf("failed parsing genesis: %v", err)
 	}
-	spec, err := newAlongGenesisSpec("stureby", &genesis)
+	spec, err := newAlongGenesisSpec("stureby", &genesis, sturebyBootnodes)
 	if err != nil {
 		t.Fatalf("failed creating chainspec: %v", err)
 	}
@@ -65,6 +78,13 @@ func TestAlongSturebyConverter(t *testing.T) {
 			}
 		}
 	}
+	var enc bytes.Buffer
+	if err := WriteAlongGenesisSpec(&enc, spec); err != nil {
+		t.Fatalf("failed encoding chainspec: %v", err)
+	}
+	if !bytes.Equal(expBlob, enc.Bytes()) {
+		t.Fatalf("chainspec encoding mismatch")
+	}
 }
 
 // Tests the go-orange to Parity chainspec conversion for the Stureby testnet.
@@ -73,7 +93,7 @@ func TestParitySturebyConverter(t *testing.T) {
 	if err != nil {
 		t.Fatalf("could not read file: %v", err)
 	}
-	var genesis core.Genesis
+	var genesis chainGenesis
 	if err := json.Unmarshal(blob, &genesis); err != nil {
 		t.Fatalf("failed parsing genesis: %v", err)
 	}
@@ -81,15 +101,472 @@ func TestParitySturebyConverter(t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed creating chainspec: %v", err)
 	}
-	enc, err := json.MarshalIndent(spec, "", "  ")
-	if err != nil {
+	var enc bytes.Buffer
+	if err := WriteParityChainSpec(&enc, spec); err != nil {
 		t.Fatalf("failed encoding chainspec: %v", err)
 	}
 	expBlob, err := ioutil.ReadFile("testdata/stureby_parity.json")
 	if err != nil {
 		t.Fatalf("could not read file: %v", err)
 	}
-	if !bytes.Equal(expBlob, enc) {
+	if !bytes.Equal(expBlob, enc.Bytes()) {
+		t.Fatalf("chainspec mismatch")
+	}
+}
+
+// Tests that converting a genesis into a Parity chainspec and back retains all
+// the consensus relevant fields.
+func TestParityRoundTrip(t *testing.T) {
+	for _, file := range []string{"testdata/stureby_gong.json", "testdata/london_gong.json"} {
+		blob, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("could not read file: %v", err)
+		}
+		var genesis chainGenesis
+		if err := json.Unmarshal(blob, &genesis); err != nil {
+			t.Fatalf("%s: failed parsing genesis: %v", file, err)
+		}
+		spec, err := newParityChainSpec("stureby", &genesis, []string{})
+		if err != nil {
+			t.Fatalf("%s: failed creating chainspec: %v", file, err)
+		}
+		// Round trip the spec through JSON too, as if loaded from disk
+		enc, err := json.Marshal(spec)
+		if err != nil {
+			t.Fatalf("%s: failed encoding chainspec: %v", file, err)
+		}
+		var loaded parityChainSpec
+		if err := json.Unmarshal(enc, &loaded); err != nil {
+			t.Fatalf("%s: failed decoding chainspec: %v", file, err)
+		}
+		have, err := newGenesisFromParitySpec(&loaded)
+		if err != nil {
+			t.Fatalf("%s: failed converting chainspec back: %v", file, err)
+		}
+		// Explicitly exclude the fields Parity specs can't carry
+		want := genesis
+		config := *genesis.Config
+		want.Config = &config
+
+		want.Config.DAOForkBlock, want.Config.DAOForkSupport = nil, false
+		want.Config.EIP150Hash = common.Hash{}
+		want.Config.MuirGlacierBlock = nil
+		want.Config.BerlinBlock = nil
+		for addr, account := range want.Alloc {
+			if len(account.Code) > 0 || len(account.Storage) > 0 {
+				t.Fatalf("%s: test genesis contains code or storage at %x", file, addr)
+			}
+		}
+		if !reflect.DeepEqual(have.Config, want.Config) {
+			t.Errorf("%s: chain config mismatch:\nhave %v\nwant %v", file, have.Config, want.Config)
+		}
+		have.Config, want.Config = nil, nil
+		if !reflect.DeepEqual(have, &want) {
+			t.Errorf("%s: genesis mismatch:\nhave %+v\nwant %+v", file, have, &want)
+		}
+	}
+}
+
+// Tests that a London enabled genesis carries its fee market parameters over
+// into the Parity chainspec.
+func TestParityLondonConverter(t *testing.T) {
+	blob, err := ioutil.ReadFile("testdata/london_gong.json")
+	if err != nil {
+		t.Fatalf("could not read file: %v", err)
+	}
+	var genesis chainGenesis
+	if err := json.Unmarshal(blob, &genesis); err != nil {
+		t.Fatalf("failed parsing genesis: %v", err)
+	}
+	spec, err := newParityChainSpec("stureby", &genesis, []string{})
+	if err != nil {
+		t.Fatalf("failed creating chainspec: %v", err)
+	}
+	var enc bytes.Buffer
+	if err := WriteParityChainSpec(&enc, spec); err != nil {
+		t.Fatalf("failed encoding chainspec: %v", err)
+	}
+	expBlob, err := ioutil.ReadFile("testdata/london_parity.json")
+	if err != nil {
+		t.Fatalf("could not read file: %v", err)
+	}
+	if !bytes.Equal(expBlob, enc.Bytes()) {
+		t.Fatalf("chainspec mismatch")
+	}
+}
+
+// Tests the go-orange to Nethermind chainspec conversion for the Stureby testnet.
+func TestNethermindSturebyConverter(t *testing.T) {
+	blob, err := ioutil.ReadFile("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("could not read file: %v", err)
+	}
+	var genesis chainGenesis
+	if err := json.Unmarshal(blob, &genesis); err != nil {
+		t.Fatalf("failed parsing genesis: %v", err)
+	}
+	spec, err := newNethermindChainSpec("stureby", &genesis, []string{})
+	if err != nil {
+		t.Fatalf("failed creating chainspec: %v", err)
+	}
+	var enc bytes.Buffer
+	if err := writeChainSpecJSON(&enc, spec); err != nil {
+		t.Fatalf("failed encoding chainspec: %v", err)
+	}
+	expBlob, err := ioutil.ReadFile("testdata/stureby_nethermind.json")
+	if err != nil {
+		t.Fatalf("could not read file: %v", err)
+	}
+	if !bytes.Equal(expBlob, enc.Bytes()) {
 		t.Fatalf("chainspec mismatch")
 	}
 }
+
+// Tests that the Nethermind converter selects the Clique engine for Clique
+// networks and retains the code and storage of the genesis accounts.
+func TestNethermindCliqueConverter(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	genesis.Config.Ongash, genesis.Config.Clique = nil, &params.CliqueConfig{Period: 15, Epoch: 30000}
+	genesis.ExtraData = cliqueExtraData([]common.Address{{0x01}})
+
+	contract := common.HexToAddress("0x0c0de")
+	genesis.Alloc[contract] = core.GenesisAccount{
+		Balance: big.NewInt(1),
+		Code:    []byte{0x60, 0x00},
+		Storage: map[common.Hash]common.Hash{{0x01}: {0x02}},
+	}
+	spec, err := newNethermindChainSpec("stureby", genesis, nil)
+	if err != nil {
+		t.Fatalf("failed creating chainspec: %v", err)
+	}
+	if spec.Engine.Ongash != nil {
+		t.Errorf("ongash engine emitted for clique network")
+	}
+	if clique := spec.Engine.Clique; clique == nil || clique.Params.Period != 15 || clique.Params.Epoch != 30000 {
+		t.Errorf("clique engine mismatch: have %+v", clique)
+	}
+	account := spec.Accounts[common.UnprefixedAddress(contract)]
+	if account == nil {
+		t.Fatalf("contract account missing")
+	}
+	if !bytes.Equal(account.Code, []byte{0x60, 0x00}) {
+		t.Errorf("contract code mismatch: have %x, want %x", account.Code, []byte{0x60, 0x00})
+	}
+	if !reflect.DeepEqual(account.Storage, genesis.Alloc[contract].Storage) {
+		t.Errorf("contract storage mismatch: have %v, want %v", account.Storage, genesis.Alloc[contract].Storage)
+	}
+	// Genesis configs running neither engine must be rejected
+	genesis.Config.Clique = nil
+	if _, err := newNethermindChainSpec("stureby", genesis, nil); err == nil {
+		t.Errorf("engineless genesis accepted")
+	}
+}
+
+// Tests that Clique genesis blocks are converted into the proof-of-authority
+// engine definitions of both the Along and Parity chainspecs.
+func TestCliqueConverters(t *testing.T) {
+	genesis, err := loadGenesis("testdata/clique_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	along, err := newAlongGenesisSpec("clique", genesis, nil)
+	if err != nil {
+		t.Fatalf("failed creating along chainspec: %v", err)
+	}
+	parity, err := newParityChainSpec("clique", genesis, []string{})
+	if err != nil {
+		t.Fatalf("failed creating parity chainspec: %v", err)
+	}
+	for _, test := range []struct {
+		golden string
+		write  func(w io.Writer) error
+	}{
+		{"testdata/clique_along.json", func(w io.Writer) error { return WriteAlongGenesisSpec(w, along) }},
+		{"testdata/clique_parity.json", func(w io.Writer) error { return WriteParityChainSpec(w, parity) }},
+	} {
+		var enc bytes.Buffer
+		if err := test.write(&enc); err != nil {
+			t.Fatalf("%s: failed encoding chainspec: %v", test.golden, err)
+		}
+		expBlob, err := ioutil.ReadFile(test.golden)
+		if err != nil {
+			t.Fatalf("could not read file: %v", err)
+		}
+		if !bytes.Equal(expBlob, enc.Bytes()) {
+			t.Errorf("%s: chainspec mismatch", test.golden)
+		}
+	}
+}
+
+// Tests that Clique genesis blocks with a malformed extra-data are rejected.
+func TestCliqueExtraDataValidation(t *testing.T) {
+	genesis, err := loadGenesis("testdata/clique_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	tests := []struct {
+		extra []byte
+		want  string
+	}{
+		{make([]byte, 32), "invalid clique extra-data: 32 bytes, need at least 97 for the vanity and seal"},
+		{make([]byte, 32+65), "invalid clique extra-data: no signers"},
+		{make([]byte, 32+19+65), "invalid clique extra-data: signer section of 19 bytes is not a multiple of 20"},
+	}
+	for _, tt := range tests {
+		genesis.ExtraData = tt.extra
+		if _, err := newAlongGenesisSpec("clique", genesis, nil); err == nil || err.Error() != tt.want {
+			t.Errorf("along error mismatch: have %v, want %v", err, tt.want)
+		}
+		if _, err := newParityChainSpec("clique", genesis, nil); err == nil || err.Error() != tt.want {
+			t.Errorf("parity error mismatch: have %v, want %v", err, tt.want)
+		}
+	}
+}
+
+// Tests the go-orange to Besu genesis conversion for the Stureby testnet.
+func TestBesuSturebyConverter(t *testing.T) {
+	blob, err := ioutil.ReadFile("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("could not read file: %v", err)
+	}
+	var genesis chainGenesis
+	if err := json.Unmarshal(blob, &genesis); err != nil {
+		t.Fatalf("failed parsing genesis: %v", err)
+	}
+	spec, err := newBesuGenesisSpec("stureby", &genesis)
+	if err != nil {
+		t.Fatalf("failed creating genesis spec: %v", err)
+	}
+	enc, err := json.MarshalIndent(spec, "", "  ")
+	if err != nil {
+		t.Fatalf("failed encoding genesis spec: %v", err)
+	}
+	expBlob, err := ioutil.ReadFile("testdata/stureby_besu.json")
+	if err != nil {
+		t.Fatalf("could not read file: %v", err)
+	}
+	if !bytes.Equal(expBlob, enc) {
+		t.Fatalf("genesis spec mismatch")
+	}
+}
+
+// Tests that timestamp based fork activations are carried over into both the
+// Along and Parity chainspecs, and omitted if not scheduled.
+func TestShanghaiTimeConverter(t *testing.T) {
+	blob, err := ioutil.ReadFile("testdata/shanghai_gong.json")
+	if err != nil {
+		t.Fatalf("could not read file: %v", err)
+	}
+	var genesis chainGenesis
+	if err := json.Unmarshal(blob, &genesis); err != nil {
+		t.Fatalf("failed parsing genesis: %v", err)
+	}
+	along, err := newAlongGenesisSpec("shanghai", &genesis, nil)
+	if err != nil {
+		t.Fatalf("failed creating along chainspec: %v", err)
+	}
+	if along.Params.ShanghaiForkTime == nil || uint64(*along.Params.ShanghaiForkTime) != 1681338455 {
+		t.Errorf("along shanghai time mismatch: have %v, want %v", along.Params.ShanghaiForkTime, 1681338455)
+	}
+	if along.Params.CancunForkTime != nil {
+		t.Errorf("along cancun time set: %v", *along.Params.CancunForkTime)
+	}
+	parity, err := newParityChainSpec("shanghai", &genesis, []string{})
+	if err != nil {
+		t.Fatalf("failed creating parity chainspec: %v", err)
+	}
+	enc, err := json.Marshal(parity)
+	if err != nil {
+		t.Fatalf("failed encoding chainspec: %v", err)
+	}
+	for _, field := range []string{"eip3651TransitionTimestamp", "eip3855TransitionTimestamp", "eip3860TransitionTimestamp", "eip4895TransitionTimestamp"} {
+		if want := `"` + field + `":"0x64373057"`; !strings.Contains(string(enc), want) {
+			t.Errorf("parity chainspec missing %s", want)
+		}
+	}
+	if strings.Contains(string(enc), "eip4844TransitionTimestamp") {
+		t.Errorf("parity chainspec contains unscheduled cancun transition")
+	}
+}
+
+// Tests that the forks go-orange doesn't implement are parsed out of the chain
+// config next to the go-orange ones, and are encoded back into it.
+func TestChainGenesisJSON(t *testing.T) {
+	blob, err := ioutil.ReadFile("testdata/shanghai_gong.json")
+	if err != nil {
+		t.Fatalf("could not read file: %v", err)
+	}
+	var genesis chainGenesis
+	if err := json.Unmarshal(blob, &genesis); err != nil {
+		t.Fatalf("failed parsing genesis: %v", err)
+	}
+	if genesis.Forks.ShanghaiTime == nil || *genesis.Forks.ShanghaiTime != 1681338455 {
+		t.Fatalf("shanghai time mismatch: have %v, want %v", genesis.Forks.ShanghaiTime, 1681338455)
+	}
+	if genesis.Config.IstanbulBlock == nil || genesis.Config.IstanbulBlock.Uint64() != 50000 {
+		t.Fatalf("istanbul block mismatch: have %v, want %v", genesis.Config.IstanbulBlock, 50000)
+	}
+	enc, err := json.Marshal(genesis)
+	if err != nil {
+		t.Fatalf("failed encoding genesis: %v", err)
+	}
+	var reloaded chainGenesis
+	if err := json.Unmarshal(enc, &reloaded); err != nil {
+		t.Fatalf("failed parsing encoded genesis: %v", err)
+	}
+	if !reflect.DeepEqual(reloaded, genesis) {
+		t.Errorf("genesis mismatch after round trip:\nhave %+v\nwant %+v", reloaded, genesis)
+	}
+}
+
+// Tests that the genesis hash of chains starting on London covers the base fee
+// of the genesis header, while later London forks leave it untouched.
+func TestLondonGenesisHash(t *testing.T) {
+	genesis, err := loadGenesis("testdata/london_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	hash := func() common.Hash {
+		hash, err := GenesisHash(genesis)
+		if err != nil {
+			t.Fatalf("failed to hash genesis: %v", err)
+		}
+		return hash
+	}
+	base := genesis.ToBlock(nil).Hash()
+	if have := hash(); have != base {
+		t.Fatalf("pre-London genesis hash mismatch: have %x, want %x", have, base)
+	}
+	genesis.Forks.LondonBlock = big.NewInt(0)
+	london := hash()
+	if london == base {
+		t.Fatalf("London genesis hash ignores the base fee")
+	}
+	genesis.BaseFee = new(big.Int).SetUint64(defaultInitialBaseFee)
+	if have := hash(); have != london {
+		t.Errorf("explicit default base fee hash mismatch: have %x, want %x", have, london)
+	}
+	genesis.BaseFee = big.NewInt(7)
+	if have := hash(); have == london {
+		t.Errorf("genesis hash unchanged after base fee change")
+	}
+}
+
+// Tests that the genesis hash of chains starting on Shanghai or Cancun covers the
+// additional header fields, while unrepresentable fork combinations are rejected.
+func TestShanghaiGenesisHash(t *testing.T) {
+	genesis, err := loadGenesis("testdata/london_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	genesis.Forks.LondonBlock = big.NewInt(0)
+	london, err := GenesisHash(genesis)
+	if err != nil {
+		t.Fatalf("failed to hash London genesis: %v", err)
+	}
+	// Shanghai scheduled after genesis doesn't change the header
+	later := genesis.Timestamp + 1
+	genesis.Forks.ShanghaiTime = &later
+	if have, err := GenesisHash(genesis); err != nil || have != london {
+		t.Fatalf("post-genesis Shanghai hash mismatch: have %x/%v, want %x/nil", have, err, london)
+	}
+	// Shanghai at genesis appends the empty withdrawals root
+	genesis.Forks.ShanghaiTime = &genesis.Timestamp
+
+	header := genesis.ToBlock(nil).Header()
+	blob, _ := rlp.EncodeToBytes([]interface{}{
+		header.ParentHash, header.UncleHash, header.Coinbase, header.Root,
+		header.TxHash, header.ReceiptHash, header.Bloom, header.Difficulty,
+		header.Number, header.GasLimit, header.GasUsed, header.Time,
+		header.Extra, header.MixDigest, header.Nonce, genesis.baseFee(),
+		types.EmptyRootHash,
+	})
+	want := crypto.Keccak256Hash(blob)
+	shanghai, err := GenesisHash(genesis)
+	if err != nil || shanghai != want {
+		t.Fatalf("Shanghai genesis hash mismatch: have %x/%v, want %x/nil", shanghai, err, want)
+	}
+	// Cancun at genesis appends the blob gas fields and the beacon root
+	genesis.Forks.CancunTime = &genesis.Timestamp
+	if have, err := GenesisHash(genesis); err != nil || have == shanghai {
+		t.Errorf("Cancun genesis hash mismatch: have %x/%v, want not %x", have, err, shanghai)
+	}
+	// Time forks at genesis without their predecessors can't be represented
+	genesis.Forks.ShanghaiTime = nil
+	if _, err := GenesisHash(genesis); err == nil {
+		t.Errorf("Cancun genesis without Shanghai accepted")
+	}
+	genesis.Forks.ShanghaiTime, genesis.Forks.CancunTime, genesis.Forks.LondonBlock = &genesis.Timestamp, nil, nil
+	if _, err := GenesisHash(genesis); err == nil {
+		t.Errorf("Shanghai genesis without London accepted")
+	}
+}
+
+// Tests that both the Along and Parity chainspecs carry the current layout
+// version.
+func TestChainSpecVersion(t *testing.T) {
+	blob, err := ioutil.ReadFile("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("could not read file: %v", err)
+	}
+	var genesis chainGenesis
+	if err := json.Unmarshal(blob, &genesis); err != nil {
+		t.Fatalf("failed parsing genesis: %v", err)
+	}
+	hash := genesis.ToBlock(nil).Hash()
+
+	along, err := newAlongGenesisSpec("stureby", &genesis, nil)
+	if err != nil {
+		t.Fatalf("failed creating along chainspec: %v", err)
+	}
+	parity, err := newParityChainSpec("stureby", &genesis, []string{})
+	if err != nil {
+		t.Fatalf("failed creating parity chainspec: %v", err)
+	}
+	for name, spec := range map[string]interface{}{"along": along, "parity": parity} {
+		enc, err := json.Marshal(spec)
+		if err != nil {
+			t.Fatalf("%s: failed encoding chainspec: %v", name, err)
+		}
+		var version struct {
+			SpecVersion *int `json:"specVersion"`
+		}
+		if err := json.Unmarshal(enc, &version); err != nil {
+			t.Fatalf("%s: failed parsing chainspec: %v", name, err)
+		}
+		if version.SpecVersion == nil || *version.SpecVersion != chainSpecVersion {
+			t.Errorf("%s: spec version mismatch: have %v, want %d", name, version.SpecVersion, chainSpecVersion)
+		}
+	}
+	if have := genesis.ToBlock(nil).Hash(); have != hash {
+		t.Errorf("genesis hash changed: have %x, want %x", have, hash)
+	}
+}
+
+// Tests that the Parity converter reports the genesis fields it can't represent.
+func TestParityDroppedFields(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	_, report, err := newParityChainSpecWithReport("stureby", genesis, nil)
+	if err != nil {
+		t.Fatalf("failed creating chainspec: %v", err)
+	}
+	if len(report) != 0 {
+		t.Fatalf("unexpected dropped fields: %v", report)
+	}
+	genesis.Config.MuirGlacierBlock = big.NewInt(60000)
+
+	_, report, err = newParityChainSpecWithReport("stureby", genesis, nil)
+	if err != nil {
+		t.Fatalf("failed creating chainspec: %v", err)
+	}
+	want := []string{"muirGlacierBlock 60000 dropped, the bomb delay is not scheduled"}
+	if !reflect.DeepEqual(report, want) {
+		t.Fatalf("dropped fields mismatch: have %v, want %v", report, want)
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2021 The go-orange Authors
+// This file is part of go-orange.
+//
+// go-orange is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-orange is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-orange. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ong2020/go-orange/common"
+	"github.com/ong2020/go-orange/common/hexutil"
+	"github.com/ong2020/go-orange/core"
+	"github.com/ong2020/go-orange/core/vm"
+	"github.com/ong2020/go-orange/p2p/enode"
+)
+
+// validateAllocCode scans the code of every account in the genesis alloc and
+// returns the addresses (sorted) whose bytecode ends in a truncated PUSH.
+func validateAllocCode(alloc core.GenesisAlloc) []common.Address {
+	var invalid []common.Address
+	for addr, account := range alloc {
+		if truncatedPush(account.Code) {
+			invalid = append(invalid, addr)
+		}
+	}
+	sort.Slice(invalid, func(i, j int) bool {
+		return bytes.Compare(invalid[i][:], invalid[j][:]) < 0
+	})
+	return invalid
+}
+
+// truncatedPush walks the bytecode opcode by opcode and reports whether the
+// immediate operand of a PUSH runs past the end of the code.
+func truncatedPush(code []byte) bool {
+	for pc := 0; pc < len(code); pc++ {
+		if op := vm.OpCode(code[pc]); op.IsPush() {
+			size := int(op - vm.PUSH1 + 1)
+			if pc+size >= len(code) {
+				return true
+			}
+			pc += size
+		}
+	}
+	return false
+}
+
+// emptyAllocAccounts returns the addresses (sorted) of the accounts in the
+// genesis alloc without balance, nonce, code and storage. Such accounts have no
+// effect other than bloating the state and are usually a mistake.
+func emptyAllocAccounts(alloc core.GenesisAlloc) []common.Address {
+	var empty []common.Address
+	for addr, account := range alloc {
+		if (account.Balance == nil || account.Balance.Sign() == 0) && account.Nonce == 0 && len(account.Code) == 0 && len(account.Storage) == 0 {
+			empty = append(empty, addr)
+		}
+	}
+	sort.Slice(empty, func(i, j int) bool {
+		return bytes.Compare(empty[i][:], empty[j][:]) < 0
+	})
+	return empty
+}
+
+// validateAllocBalances ensures every account in the genesis alloc has a set,
+// non-negative balance, which other clients require to load the chain spec.
+func validateAllocBalances(alloc core.GenesisAlloc) error {
+	addrs := make([]common.Address, 0, len(alloc))
+	for addr := range alloc {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool {
+		return bytes.Compare(addrs[i][:], addrs[j][:]) < 0
+	})
+	for _, addr := range addrs {
+		switch balance := alloc[addr].Balance; {
+		case balance == nil:
+			return fmt.Errorf("alloc account %s: missing balance", addr.Hex())
+		case balance.Sign() < 0:
+			return fmt.Errorf("alloc account %s: negative balance %v", addr.Hex(), balance)
+		}
+	}
+	return nil
+}
+
+// validateBootnodes ensures every bootnode is a valid enode URL, listing all the
+// invalid ones in the returned error.
+func validateBootnodes(bootnodes []string) error {
+	var invalid []string
+	for _, node := range bootnodes {
+		if _, err := enode.ParseV4(node); err != nil {
+			invalid = append(invalid, node)
+		}
+	}
+	if len(invalid) > 0 {
+		return fmt.Errorf("invalid bootnodes: %s", strings.Join(invalid, ", "))
+	}
+	return nil
+}
+
+// validateAllocJSON checks the alloc of a raw JSON genesis before decoding it,
+// so that malformed accounts are reported by address instead of by a generic
+// decoding error: balances must be set, code must be valid hex and storage
+// keys and values must be 32 byte hex strings.
+func validateAllocJSON(blob []byte) error {
+	var genesis struct {
+		Alloc map[string]struct {
+			Balance json.RawMessage   `json:"balance"`
+			Code    *string           `json:"code"`
+			Storage map[string]string `json:"storage"`
+		} `json:"alloc"`
+	}
+	if err := json.Unmarshal(blob, &genesis); err != nil {
+		return fmt.Errorf("invalid genesis spec: %v", err)
+	}
+	addrs := make([]string, 0, len(genesis.Alloc))
+	for addr := range genesis.Alloc {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+
+	for _, addr := range addrs {
+		if !common.IsHexAddress(addr) {
+			return fmt.Errorf("invalid alloc address %q", addr)
+		}
+		name, account := common.HexToAddress(addr).Hex(), genesis.Alloc[addr]
+		if len(account.Balance) == 0 || string(account.Balance) == "null" {
+			return fmt.Errorf("alloc account %s: missing balance", name)
+		}
+		if account.Code != nil {
+			if _, err := hexutil.Decode(*account.Code); err != nil {
+				return fmt.Errorf("alloc account %s: invalid code: %v", name, err)
+			}
+		}
+		for key, val := range account.Storage {
+			if blob, err := hexutil.Decode(key); err != nil || len(blob) != common.HashLength {
+				return fmt.Errorf("alloc account %s: invalid storage key %q, must be 32 bytes hex", name, key)
+			}
+			if blob, err := hexutil.Decode(val); err != nil || len(blob) != common.HashLength {
+				return fmt.Errorf("alloc account %s: invalid storage value %q at %s, must be 32 bytes hex", name, val, key)
+			}
+		}
+	}
+	return nil
+}
+
+// validateAllocSupply sums up the balances of all the accounts in the genesis
+// alloc and ensures the total matches the expected supply.
+func validateAllocSupply(alloc core.GenesisAlloc, expected *big.Int) error {
+	supply := new(big.Int)
+	for _, account := range alloc {
+		if account.Balance != nil {
+			supply.Add(supply, account.Balance)
+		}
+	}
+	if supply.Cmp(expected) != 0 {
+		return fmt.Errorf("genesis alloc supply mismatch: have %v, want %v", supply, expected)
+	}
+	return nil
+}
+
+// validateForkOrder rejects genesis specs scheduling forks in an order no client
+// can follow, e.g. Petersburg before Constantinople.
+func validateForkOrder(genesis *chainGenesis) error {
+	if err := genesis.Config.CheckConfigForkOrder(); err != nil {
+		return fmt.Errorf("invalid genesis, %v", err)
+	}
+	forks := genesis.Forks
+	if forks.LondonBlock != nil {
+		if berlin := genesis.Config.BerlinBlock; berlin == nil {
+			return fmt.Errorf("invalid genesis, unsupported fork ordering: berlinBlock not enabled, but londonBlock enabled at %v", forks.LondonBlock)
+		} else if berlin.Cmp(forks.LondonBlock) > 0 {
+			return fmt.Errorf("invalid genesis, unsupported fork ordering: berlinBlock enabled at %v, but londonBlock enabled at %v", berlin, forks.LondonBlock)
+		}
+	}
+	if forks.CancunTime != nil {
+		if forks.ShanghaiTime == nil {
+			return fmt.Errorf("invalid genesis, cancun fork is enabled at %d while shanghai is not", *forks.CancunTime)
+		}
+		if *forks.ShanghaiTime > *forks.CancunTime {
+			return fmt.Errorf("invalid genesis, shanghai fork is enabled at %d after cancun at %d", *forks.ShanghaiTime, *forks.CancunTime)
+		}
+	}
+	return nil
+}
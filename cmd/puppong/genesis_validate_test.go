@@ -0,0 +1,178 @@
+// Copyright 2021 The go-orange Authors
+// This file is part of go-orange.
+//
+// go-orange is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-orange is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-orange. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ong2020/go-orange/common"
+	"github.com/ong2020/go-orange/core"
+)
+
+// Tests that alloc accounts with truncated PUSH operands are detected.
+func TestValidateAllocCode(t *testing.T) {
+	var (
+		good      = common.HexToAddress("0x01")
+		truncated = common.HexToAddress("0x02")
+		exact     = common.HexToAddress("0x03")
+	)
+	// PUSH1 0x80 PUSH1 0x40 MSTORE, followed by a PUSH32 with only 31 bytes
+	code := append(common.FromHex("6080604052"), 0x7f)
+	code = append(code, make([]byte, 31)...)
+
+	alloc := core.GenesisAlloc{
+		good:      {Balance: big.NewInt(1), Code: common.FromHex("6080604052")},
+		truncated: {Balance: big.NewInt(1), Code: code},
+		exact:     {Balance: big.NewInt(1), Code: append(common.FromHex("7f"), make([]byte, 32)...)},
+	}
+	if invalid := validateAllocCode(alloc); !reflect.DeepEqual(invalid, []common.Address{truncated}) {
+		t.Fatalf("invalid accounts mismatch: have %v, want %v", invalid, []common.Address{truncated})
+	}
+}
+
+// Tests that the total alloc supply is checked against the expected cap.
+func TestValidateAllocSupply(t *testing.T) {
+	alloc := core.GenesisAlloc{
+		common.HexToAddress("0x01"): {Balance: big.NewInt(1000)},
+		common.HexToAddress("0x02"): {Balance: big.NewInt(2000)},
+		common.HexToAddress("0x03"): {Code: []byte{0x00}},
+	}
+	if err := validateAllocSupply(alloc, big.NewInt(3000)); err != nil {
+		t.Errorf("matching supply rejected: %v", err)
+	}
+	if err := validateAllocSupply(alloc, big.NewInt(3001)); err == nil {
+		t.Errorf("mismatching supply accepted")
+	}
+	// Ensure the check is wired into the conversion
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	if _, err := buildChainSpec(genesis, &convertConfig{format: "parity", expectedSupply: big.NewInt(9)}); err != nil {
+		t.Errorf("matching stureby supply rejected: %v", err)
+	}
+	if _, err := buildChainSpec(genesis, &convertConfig{format: "parity", expectedSupply: big.NewInt(10)}); err == nil {
+		t.Errorf("mismatching stureby supply accepted")
+	}
+}
+
+// Tests that the converters reject known-invalid fork orderings.
+func TestValidateForkOrder(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	genesis.Config.PetersburgBlock = big.NewInt(35000) // Constantinople is at 40000
+
+	want := "invalid genesis, unsupported fork ordering: constantinopleBlock enabled at 40000, but petersburgBlock enabled at 35000"
+	if _, err := newAlongGenesisSpec("stureby", genesis, nil); err == nil || err.Error() != want {
+		t.Errorf("along error mismatch: have %v, want %v", err, want)
+	}
+	if _, err := newParityChainSpec("stureby", genesis, nil); err == nil || err.Error() != want {
+		t.Errorf("parity error mismatch: have %v, want %v", err, want)
+	}
+	// Timestamp based forks must be ordered too
+	genesis.Config.PetersburgBlock = big.NewInt(40000)
+	shanghai, cancun := uint64(2000), uint64(1000)
+	genesis.Forks.ShanghaiTime, genesis.Forks.CancunTime = &shanghai, &cancun
+
+	want = "invalid genesis, shanghai fork is enabled at 2000 after cancun at 1000"
+	if _, err := newParityChainSpec("stureby", genesis, nil); err == nil || err.Error() != want {
+		t.Errorf("parity error mismatch: have %v, want %v", err, want)
+	}
+	// London must follow Berlin, even though go-orange doesn't implement it
+	genesis.Forks.ShanghaiTime, genesis.Forks.CancunTime = nil, nil
+	genesis.Config.BerlinBlock, genesis.Forks.LondonBlock = big.NewInt(60000), big.NewInt(55000)
+
+	want = "invalid genesis, unsupported fork ordering: berlinBlock enabled at 60000, but londonBlock enabled at 55000"
+	if _, err := newAlongGenesisSpec("stureby", genesis, nil); err == nil || err.Error() != want {
+		t.Errorf("along error mismatch: have %v, want %v", err, want)
+	}
+}
+
+// Tests that malformed genesis allocs are rejected with errors naming the
+// offending account.
+func TestValidateAlloc(t *testing.T) {
+	tests := []struct {
+		alloc string
+		err   string
+	}{
+		{
+			alloc: `{"0x0000000000000000000000000000000000000001": {"balance": "0x1"}, "0x0000000000000000000000000000000000000002": {"code": "0x00"}}`,
+			err:   "alloc account 0x0000000000000000000000000000000000000002: missing balance",
+		},
+		{
+			alloc: `{"0000000000000000000000000000000000000003": {"balance": null}}`,
+			err:   "alloc account 0x0000000000000000000000000000000000000003: missing balance",
+		},
+		{
+			alloc: `{"0000000000000000000000000000000000000004": {"balance": "0x1", "code": "0xzz"}}`,
+			err:   "alloc account 0x0000000000000000000000000000000000000004: invalid code: invalid hex string",
+		},
+		{
+			alloc: `{"0000000000000000000000000000000000000005": {"balance": "0x1", "storage": {"0x01": "0x0000000000000000000000000000000000000000000000000000000000000001"}}}`,
+			err:   `alloc account 0x0000000000000000000000000000000000000005: invalid storage key "0x01", must be 32 bytes hex`,
+		},
+		{
+			alloc: `{"0000000000000000000000000000000000000006": {"balance": "0x1", "storage": {"0x0000000000000000000000000000000000000000000000000000000000000001": "0x01"}}}`,
+			err:   `alloc account 0x0000000000000000000000000000000000000006: invalid storage value "0x01" at 0x0000000000000000000000000000000000000000000000000000000000000001, must be 32 bytes hex`,
+		},
+		{
+			alloc: `{"0x07": {"balance": "0x1"}}`,
+			err:   `invalid alloc address "0x07"`,
+		},
+	}
+	for i, tt := range tests {
+		err := validateAllocJSON([]byte(`{"alloc": ` + tt.alloc + `}`))
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	// Balances set programmatically must be checked by the converters too
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	genesis.Alloc[common.HexToAddress("0x0a")] = core.GenesisAccount{Balance: big.NewInt(-1)}
+
+	want := "alloc account 0x000000000000000000000000000000000000000A: negative balance -1"
+	if _, err := newParityChainSpec("stureby", genesis, nil); err == nil || err.Error() != want {
+		t.Errorf("parity error mismatch: have %v, want %v", err, want)
+	}
+	genesis.Alloc[common.HexToAddress("0x0a")] = core.GenesisAccount{}
+
+	want = "alloc account 0x000000000000000000000000000000000000000A: missing balance"
+	if _, err := newAlongGenesisSpec("stureby", genesis, nil); err == nil || err.Error() != want {
+		t.Errorf("along error mismatch: have %v, want %v", err, want)
+	}
+}
+
+// Tests that the Along converter rejects invalid bootnodes, listing all of them.
+func TestValidateBootnodes(t *testing.T) {
+	genesis, err := loadGenesis("testdata/stureby_gong.json")
+	if err != nil {
+		t.Fatalf("failed to load genesis: %v", err)
+	}
+	bootnodes := []string{sturebyBootnodes[0], "enode://invalid", sturebyBootnodes[1], "127.0.0.1:30303"}
+
+	want := "invalid bootnodes: enode://invalid, 127.0.0.1:30303"
+	if _, err := newAlongGenesisSpec("stureby", genesis, bootnodes); err == nil || err.Error() != want {
+		t.Errorf("along error mismatch: have %v, want %v", err, want)
+	}
+}
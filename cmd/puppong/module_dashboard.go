@@ -641,7 +641,9 @@ func deployDashboard(client *sshClient, network string, conf *config, config *da
 	files[filepath.Join(workdir, network+".json")] = genesis
 
 	if conf.Genesis.Config.Ongash != nil {
-		cppSpec, err := newAlongGenesisSpec(network, conf.Genesis)
+		chain := newChainGenesis(conf.Genesis)
+
+		cppSpec, err := newAlongGenesisSpec(network, chain, conf.bootnodes)
 		if err != nil {
 			return nil, err
 		}
@@ -651,14 +653,14 @@ func deployDashboard(client *sshClient, network string, conf *config, config *da
 		harmonySpecJSON, _ := conf.Genesis.MarshalJSON()
 		files[filepath.Join(workdir, network+"-harmony.json")] = harmonySpecJSON
 
-		paritySpec, err := newParityChainSpec(network, conf.Genesis, conf.bootnodes)
+		paritySpec, err := newParityChainSpec(network, chain, conf.bootnodes)
 		if err != nil {
 			return nil, err
 		}
 		paritySpecJSON, _ := json.Marshal(paritySpec)
 		files[filepath.Join(workdir, network+"-parity.json")] = paritySpecJSON
 
-		pyongSpec, err := newPyOrangeGenesisSpec(network, conf.Genesis)
+		pyongSpec, err := newPyOrangeGenesisSpec(network, chain)
 		if err != nil {
 			return nil, err
 		}
@@ -51,6 +51,9 @@ func main() {
 		return nil
 	}
 	app.Action = runWizard
+	app.Commands = []cli.Command{
+		convertCommand,
+	}
 	app.Run(os.Args)
 }
 
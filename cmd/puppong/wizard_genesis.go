@@ -270,13 +270,13 @@ func (w *wizard) manageGenesis() {
 		log.Info("Saved native genesis chain spec", "path", gongJson)
 
 		// Export the genesis spec used by Along (formerly C++ Orange)
-		if spec, err := newAlongGenesisSpec(w.network, w.conf.Genesis); err != nil {
+		if spec, err := newAlongGenesisSpec(w.network, newChainGenesis(w.conf.Genesis), []string{}); err != nil {
 			log.Error("Failed to create Along chain spec", "err", err)
 		} else {
 			saveGenesis(folder, w.network, "along", spec)
 		}
 		// Export the genesis spec used by Parity
-		if spec, err := newParityChainSpec(w.network, w.conf.Genesis, []string{}); err != nil {
+		if spec, err := newParityChainSpec(w.network, newChainGenesis(w.conf.Genesis), []string{}); err != nil {
 			log.Error("Failed to create Parity chain spec", "err", err)
 		} else {
 			saveGenesis(folder, w.network, "parity", spec)
@@ -368,6 +368,9 @@ func NewBlockChain(db ongdb.Database, cacheConfig *CacheConfig, chainConfig *par
 		var recover bool
 
 		head := bc.CurrentBlock()
+		if _, err := rawdb.MigrateSnapshotRecoveryNumber(bc.db); err != nil {
+			log.Warn("Failed to migrate snapshot recovery number", "err", err)
+		}
 		if layer := rawdb.ReadSnapshotRecoveryNumber(bc.db); layer != nil && *layer > head.NumberU64() {
 			log.Warn("Enabling snapshot recovery", "chainhead", head.NumberU64(), "diskbase", *layer)
 			recover = true
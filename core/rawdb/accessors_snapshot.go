@@ -17,17 +17,93 @@
 package rawdb
 
 import (
+	"bytes"
 	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync"
 
+	"github.com/golang/snappy"
+	"github.com/google/uuid"
 	"github.com/ong2020/go-orange/common"
 	"github.com/ong2020/go-orange/log"
+	"github.com/ong2020/go-orange/metrics"
 	"github.com/ong2020/go-orange/ongdb"
+	"github.com/ong2020/go-orange/rlp"
 )
 
+// snapshotMeter counts the database accesses of a group of snapshot accessors.
+// The counters are no-ops unless metrics were enabled at startup.
+type snapshotMeter struct {
+	reads      metrics.Counter // Number of database reads
+	readBytes  metrics.Counter // Total size of the values read
+	writes     metrics.Counter // Number of database writes
+	writeBytes metrics.Counter // Total size of the values written
+	deletes    metrics.Counter // Number of database deletions
+}
+
+// newSnapshotMeter creates the counters of a snapshot accessor group, registered
+// under db/snapshot/<name> in the given registry.
+func newSnapshotMeter(r metrics.Registry, name string) *snapshotMeter {
+	prefix := "db/snapshot/" + name
+	return &snapshotMeter{
+		reads:      metrics.NewRegisteredCounter(prefix+"/reads", r),
+		readBytes:  metrics.NewRegisteredCounter(prefix+"/reads/bytes", r),
+		writes:     metrics.NewRegisteredCounter(prefix+"/writes", r),
+		writeBytes: metrics.NewRegisteredCounter(prefix+"/writes/bytes", r),
+		deletes:    metrics.NewRegisteredCounter(prefix+"/deletes", r),
+	}
+}
+
+func (m *snapshotMeter) read(data []byte) {
+	m.reads.Inc(1)
+	m.readBytes.Inc(int64(len(data)))
+}
+
+func (m *snapshotMeter) write(data []byte) {
+	m.writes.Inc(1)
+	m.writeBytes.Inc(int64(len(data)))
+}
+
+func (m *snapshotMeter) delete() {
+	m.deletes.Inc(1)
+}
+
+// snapshotMeterSet groups the meters of the snapshot accessors.
+type snapshotMeterSet struct {
+	root      *snapshotMeter // Snapshot and disk layer roots
+	account   *snapshotMeter // Account snapshot leaves
+	storage   *snapshotMeter // Storage snapshot leaves
+	journal   *snapshotMeter // Diff layer journal
+	generator *snapshotMeter // Generator progress marker and generation bookkeeping
+	recovery  *snapshotMeter // Recovery block number
+	sync      *snapshotMeter // Sync status
+	metadata  *snapshotMeter // Layout version and other snapshot metadata
+}
+
+func newSnapshotMeterSet(r metrics.Registry) *snapshotMeterSet {
+	return &snapshotMeterSet{
+		root:      newSnapshotMeter(r, "root"),
+		account:   newSnapshotMeter(r, "account"),
+		storage:   newSnapshotMeter(r, "storage"),
+		journal:   newSnapshotMeter(r, "journal"),
+		generator: newSnapshotMeter(r, "generator"),
+		recovery:  newSnapshotMeter(r, "recovery"),
+		sync:      newSnapshotMeter(r, "syncstatus"),
+		metadata:  newSnapshotMeter(r, "metadata"),
+	}
+}
+
+// snapshotMeters are the meters of the snapshot accessors, registered in the
+// default metrics registry.
+var snapshotMeters = newSnapshotMeterSet(nil)
+
 // ReadSnapshotRoot retrieves the root of the block whose state is contained in
 // the persisted snapshot.
 func ReadSnapshotRoot(db ongdb.KeyValueReader) common.Hash {
 	data, _ := db.Get(snapshotRootKey)
+	snapshotMeters.root.read(data)
 	if len(data) != common.HashLength {
 		return common.Hash{}
 	}
@@ -37,162 +113,1025 @@ func ReadSnapshotRoot(db ongdb.KeyValueReader) common.Hash {
 // WriteSnapshotRoot stores the root of the block whose state is contained in
 // the persisted snapshot.
 func WriteSnapshotRoot(db ongdb.KeyValueWriter, root common.Hash) {
-	if err := db.Put(snapshotRootKey, root[:]); err != nil {
+	if err := TryWriteSnapshotRoot(db, root); err != nil {
 		log.Crit("Failed to store snapshot root", "err", err)
 	}
 }
 
+// TryWriteSnapshotRoot is the error-returning variant of WriteSnapshotRoot.
+func TryWriteSnapshotRoot(db ongdb.KeyValueWriter, root common.Hash) error {
+	snapshotMeters.root.write(root[:])
+	return db.Put(snapshotRootKey, root[:])
+}
+
 // DeleteSnapshotRoot deletes the hash of the block whose state is contained in
 // the persisted snapshot. Since snapshots are not immutable, this  Method can
 // be used during updates, so a crash or failure will mark the entire snapshot
 // invalid.
 func DeleteSnapshotRoot(db ongdb.KeyValueWriter) {
-	if err := db.Delete(snapshotRootKey); err != nil {
+	if err := TryDeleteSnapshotRoot(db); err != nil {
 		log.Crit("Failed to remove snapshot root", "err", err)
 	}
 }
 
+// TryDeleteSnapshotRoot is the error-returning variant of DeleteSnapshotRoot.
+func TryDeleteSnapshotRoot(db ongdb.KeyValueWriter) error {
+	snapshotMeters.root.delete()
+	return db.Delete(snapshotRootKey)
+}
+
+// ReadSnapshotDisabled retrieves whether the snapshot was disabled by the
+// operator. Snapshots are enabled unless the flag was explicitly set.
+func ReadSnapshotDisabled(db ongdb.KeyValueReader) bool {
+	disabled, _ := db.Has(snapshotDisabledKey)
+	snapshotMeters.metadata.read(nil)
+	return disabled
+}
+
+// WriteSnapshotDisabled flags the snapshot as disabled, persisting across restarts.
+func WriteSnapshotDisabled(db ongdb.KeyValueWriter) {
+	if err := TryWriteSnapshotDisabled(db); err != nil {
+		log.Crit("Failed to store snapshot disabled flag", "err", err)
+	}
+}
+
+// TryWriteSnapshotDisabled is the error-returning variant of WriteSnapshotDisabled.
+func TryWriteSnapshotDisabled(db ongdb.KeyValueWriter) error {
+	snapshotMeters.metadata.write([]byte{0x01})
+	return db.Put(snapshotDisabledKey, []byte{0x01})
+}
+
+// DeleteSnapshotDisabled clears the snapshot disabled flag, re-enabling the
+// snapshot.
+func DeleteSnapshotDisabled(db ongdb.KeyValueWriter) {
+	if err := TryDeleteSnapshotDisabled(db); err != nil {
+		log.Crit("Failed to remove snapshot disabled flag", "err", err)
+	}
+}
+
+// TryDeleteSnapshotDisabled is the error-returning variant of DeleteSnapshotDisabled.
+func TryDeleteSnapshotDisabled(db ongdb.KeyValueWriter) error {
+	snapshotMeters.metadata.delete()
+	return db.Delete(snapshotDisabledKey)
+}
+
+// ReadSnapshotRootTimestamp retrieves the timestamp of the block whose state is
+// contained in the persisted snapshot, or false if none was recorded.
+func ReadSnapshotRootTimestamp(db ongdb.KeyValueReader) (uint64, bool) {
+	data, _ := db.Get(snapshotRootTimestampKey)
+	snapshotMeters.root.read(data)
+	if len(data) != 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(data), true
+}
+
+// WriteSnapshotRootTimestamp stores the timestamp of the block whose state is
+// contained in the persisted snapshot.
+func WriteSnapshotRootTimestamp(db ongdb.KeyValueWriter, t uint64) {
+	if err := TryWriteSnapshotRootTimestamp(db, t); err != nil {
+		log.Crit("Failed to store snapshot root timestamp", "err", err)
+	}
+}
+
+// TryWriteSnapshotRootTimestamp is the error-returning variant of WriteSnapshotRootTimestamp.
+func TryWriteSnapshotRootTimestamp(db ongdb.KeyValueWriter, t uint64) error {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], t)
+	snapshotMeters.root.write(buf[:])
+	return db.Put(snapshotRootTimestampKey, buf[:])
+}
+
+// ReadSnapshotVersion retrieves the version of the on-disk layout of the
+// persisted snapshot, or false if no version was recorded.
+func ReadSnapshotVersion(db ongdb.KeyValueReader) (uint64, bool) {
+	data, _ := db.Get(snapshotVersionKey)
+	snapshotMeters.metadata.read(data)
+	if len(data) != 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(data), true
+}
+
+// WriteSnapshotVersion stores the version of the on-disk layout of the
+// persisted snapshot.
+func WriteSnapshotVersion(db ongdb.KeyValueWriter, version uint64) {
+	if err := TryWriteSnapshotVersion(db, version); err != nil {
+		log.Crit("Failed to store snapshot version", "err", err)
+	}
+}
+
+// TryWriteSnapshotVersion is the error-returning variant of WriteSnapshotVersion.
+func TryWriteSnapshotVersion(db ongdb.KeyValueWriter, version uint64) error {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], version)
+	snapshotMeters.metadata.write(buf[:])
+	return db.Put(snapshotVersionKey, buf[:])
+}
+
+// ReadDiskLayerRoot retrieves the root of the persisted snapshot disk layer,
+// which may lag behind the head root tracked by ReadSnapshotRoot.
+func ReadDiskLayerRoot(db ongdb.KeyValueReader) common.Hash {
+	data, _ := db.Get(snapshotDiskLayerRootKey)
+	snapshotMeters.root.read(data)
+	if len(data) != common.HashLength {
+		return common.Hash{}
+	}
+	return common.BytesToHash(data)
+}
+
+// WriteDiskLayerRoot stores the root of the persisted snapshot disk layer.
+func WriteDiskLayerRoot(db ongdb.KeyValueWriter, root common.Hash) {
+	if err := TryWriteDiskLayerRoot(db, root); err != nil {
+		log.Crit("Failed to store snapshot disk layer root", "err", err)
+	}
+}
+
+// TryWriteDiskLayerRoot is the error-returning variant of WriteDiskLayerRoot.
+func TryWriteDiskLayerRoot(db ongdb.KeyValueWriter, root common.Hash) error {
+	snapshotMeters.root.write(root[:])
+	return db.Put(snapshotDiskLayerRootKey, root[:])
+}
+
+// DeleteDiskLayerRoot deletes the root of the persisted snapshot disk layer.
+func DeleteDiskLayerRoot(db ongdb.KeyValueWriter) {
+	if err := TryDeleteDiskLayerRoot(db); err != nil {
+		log.Crit("Failed to remove snapshot disk layer root", "err", err)
+	}
+}
+
+// TryDeleteDiskLayerRoot is the error-returning variant of DeleteDiskLayerRoot.
+func TryDeleteDiskLayerRoot(db ongdb.KeyValueWriter) error {
+	snapshotMeters.root.delete()
+	return db.Delete(snapshotDiskLayerRootKey)
+}
+
 // ReadAccountSnapshot retrieves the snapshot entry of an account trie leaf.
 func ReadAccountSnapshot(db ongdb.KeyValueReader, hash common.Hash) []byte {
 	data, _ := db.Get(accountSnapshotKey(hash))
+	snapshotMeters.account.read(data)
 	return data
 }
 
+// HasAccountSnapshot checks whether the snapshot entry of an account trie leaf
+// exists, without retrieving its value.
+func HasAccountSnapshot(db ongdb.KeyValueReader, hash common.Hash) (bool, error) {
+	snapshotMeters.account.read(nil)
+	return db.Has(accountSnapshotKey(hash))
+}
+
 // WriteAccountSnapshot stores the snapshot entry of an account trie leaf.
 func WriteAccountSnapshot(db ongdb.KeyValueWriter, hash common.Hash, entry []byte) {
-	if err := db.Put(accountSnapshotKey(hash), entry); err != nil {
+	if err := TryWriteAccountSnapshot(db, hash, entry); err != nil {
 		log.Crit("Failed to store account snapshot", "err", err)
 	}
 }
 
+// TryWriteAccountSnapshot is the error-returning variant of WriteAccountSnapshot.
+func TryWriteAccountSnapshot(db ongdb.KeyValueWriter, hash common.Hash, entry []byte) error {
+	snapshotMeters.account.write(entry)
+	return db.Put(accountSnapshotKey(hash), entry)
+}
+
 // DeleteAccountSnapshot removes the snapshot entry of an account trie leaf.
 func DeleteAccountSnapshot(db ongdb.KeyValueWriter, hash common.Hash) {
-	if err := db.Delete(accountSnapshotKey(hash)); err != nil {
+	if err := TryDeleteAccountSnapshot(db, hash); err != nil {
 		log.Crit("Failed to delete account snapshot", "err", err)
 	}
 }
 
+// TryDeleteAccountSnapshot is the error-returning variant of DeleteAccountSnapshot.
+func TryDeleteAccountSnapshot(db ongdb.KeyValueWriter, hash common.Hash) error {
+	snapshotMeters.account.delete()
+	return db.Delete(accountSnapshotKey(hash))
+}
+
 // ReadStorageSnapshot retrieves the snapshot entry of an storage trie leaf.
 func ReadStorageSnapshot(db ongdb.KeyValueReader, accountHash, storageHash common.Hash) []byte {
 	data, _ := db.Get(storageSnapshotKey(accountHash, storageHash))
+	snapshotMeters.storage.read(data)
 	return data
 }
 
+// HasStorageSnapshot checks whether the snapshot entry of a storage trie leaf
+// exists, without retrieving its value.
+func HasStorageSnapshot(db ongdb.KeyValueReader, accountHash, storageHash common.Hash) (bool, error) {
+	snapshotMeters.storage.read(nil)
+	return db.Has(storageSnapshotKey(accountHash, storageHash))
+}
+
 // WriteStorageSnapshot stores the snapshot entry of an storage trie leaf.
 func WriteStorageSnapshot(db ongdb.KeyValueWriter, accountHash, storageHash common.Hash, entry []byte) {
-	if err := db.Put(storageSnapshotKey(accountHash, storageHash), entry); err != nil {
+	if err := TryWriteStorageSnapshot(db, accountHash, storageHash, entry); err != nil {
 		log.Crit("Failed to store storage snapshot", "err", err)
 	}
 }
 
+// TryWriteStorageSnapshot is the error-returning variant of WriteStorageSnapshot.
+func TryWriteStorageSnapshot(db ongdb.KeyValueWriter, accountHash, storageHash common.Hash, entry []byte) error {
+	snapshotMeters.storage.write(entry)
+	return db.Put(storageSnapshotKey(accountHash, storageHash), entry)
+}
+
 // DeleteStorageSnapshot removes the snapshot entry of an storage trie leaf.
 func DeleteStorageSnapshot(db ongdb.KeyValueWriter, accountHash, storageHash common.Hash) {
-	if err := db.Delete(storageSnapshotKey(accountHash, storageHash)); err != nil {
+	if err := TryDeleteStorageSnapshot(db, accountHash, storageHash); err != nil {
 		log.Crit("Failed to delete storage snapshot", "err", err)
 	}
 }
 
+// TryDeleteStorageSnapshot is the error-returning variant of DeleteStorageSnapshot.
+func TryDeleteStorageSnapshot(db ongdb.KeyValueWriter, accountHash, storageHash common.Hash) error {
+	snapshotMeters.storage.delete()
+	return db.Delete(storageSnapshotKey(accountHash, storageHash))
+}
+
 // IterateStorageSnapshots returns an iterator for walking the entire storage
 // space of a specific account.
 func IterateStorageSnapshots(db ongdb.Iteratee, accountHash common.Hash) ongdb.Iterator {
 	return db.NewIterator(storageSnapshotsKey(accountHash), nil)
 }
 
+// IterateAccountSnapshots returns an iterator for walking the entire account
+// snapshot space in key order. The account prefix is shared with other unrelated
+// keys, so callers should resolve entries through AccountSnapshotKeyHash and skip
+// the ones that are rejected.
+func IterateAccountSnapshots(db ongdb.Iteratee) ongdb.Iterator {
+	return db.NewIterator(SnapshotAccountPrefix, nil)
+}
+
+// AccountSnapshotKeyHash strips the prefix from an account snapshot key and
+// returns the account hash it belongs to. False is returned if the key is not
+// an account snapshot key.
+func AccountSnapshotKeyHash(key []byte) (common.Hash, bool) {
+	if len(key) != len(SnapshotAccountPrefix)+common.HashLength || !bytes.HasPrefix(key, SnapshotAccountPrefix) {
+		return common.Hash{}, false
+	}
+	return common.BytesToHash(key[len(SnapshotAccountPrefix):]), true
+}
+
+// ReadStorageSnapshotRange retrieves up to max consecutive storage snapshot
+// leaves of an account, starting at the given storage hash, in key order. The
+// returned flag reports whether more leaves remain after the last one returned.
+func ReadStorageSnapshotRange(db ongdb.Iteratee, accountHash common.Hash, start common.Hash, max int) ([]common.Hash, [][]byte, bool, error) {
+	if max <= 0 {
+		return nil, nil, false, fmt.Errorf("invalid range size %d", max)
+	}
+	it := db.NewIterator(storageSnapshotsKey(accountHash), start[:])
+	defer it.Release()
+
+	var (
+		hashes []common.Hash
+		values [][]byte
+	)
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(SnapshotStoragePrefix)+2*common.HashLength {
+			continue
+		}
+		if len(hashes) >= max {
+			return hashes, values, true, it.Error()
+		}
+		hashes = append(hashes, common.BytesToHash(key[len(SnapshotStoragePrefix)+common.HashLength:]))
+		values = append(values, common.CopyBytes(it.Value()))
+	}
+	return hashes, values, false, it.Error()
+}
+
+// PageStorageSnapshots retrieves a page of at most pageSize consecutive storage
+// snapshot leaves of an account, starting at the given storage hash, in key order.
+// The returned cursor is the storage hash to resume the iteration from, or the
+// zero hash if no leaves remain. The cursor can't be ambiguous, since the zero
+// hash always sorts first.
+func PageStorageSnapshots(db ongdb.Iteratee, accountHash, start common.Hash, pageSize int) (slots []common.Hash, values [][]byte, next common.Hash, err error) {
+	if pageSize <= 0 {
+		return nil, nil, common.Hash{}, fmt.Errorf("invalid page size %d", pageSize)
+	}
+	it := db.NewIterator(storageSnapshotsKey(accountHash), start[:])
+	defer it.Release()
+
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(SnapshotStoragePrefix)+2*common.HashLength {
+			continue
+		}
+		slot := common.BytesToHash(key[len(SnapshotStoragePrefix)+common.HashLength:])
+		if len(slots) >= pageSize {
+			return slots, values, slot, it.Error()
+		}
+		slots = append(slots, slot)
+		values = append(values, common.CopyBytes(it.Value()))
+	}
+	return slots, values, common.Hash{}, it.Error()
+}
+
+// CountSnapshotLeaves counts the account and storage snapshot leaves persisted
+// in the database, without loading them into memory.
+func CountSnapshotLeaves(db ongdb.Iteratee) (accounts uint64, storage uint64, err error) {
+	return CountSnapshotLeavesFrom(db, common.Hash{})
+}
+
+// CountSnapshotLeavesFrom counts the account and storage snapshot leaves of the
+// accounts whose hash is equal to or greater than start, allowing a caller to
+// checkpoint the count across restarts.
+func CountSnapshotLeavesFrom(db ongdb.Iteratee, start common.Hash) (accounts uint64, storage uint64, err error) {
+	count := func(prefix []byte, keylen int) (uint64, error) {
+		it := db.NewIterator(prefix, start[:])
+		defer it.Release()
+
+		var n uint64
+		for it.Next() {
+			if len(it.Key()) == keylen {
+				n++
+			}
+		}
+		return n, it.Error()
+	}
+	if accounts, err = count(SnapshotAccountPrefix, len(SnapshotAccountPrefix)+common.HashLength); err != nil {
+		return 0, 0, err
+	}
+	if storage, err = count(SnapshotStoragePrefix, len(SnapshotStoragePrefix)+2*common.HashLength); err != nil {
+		return 0, 0, err
+	}
+	return accounts, storage, nil
+}
+
+// snapshotJournalHeaderSize is the size of the header prepended to the snapshot
+// journal, consisting of the 4 byte payload length and its 4 byte CRC32.
+const snapshotJournalHeaderSize = 8
+
+// snapshotJournalSnappyMagic is the prefix of snappy compressed journal payloads.
+// It can't be mistaken for an uncompressed payload, which always starts with the
+// RLP encoded journal version.
+var snapshotJournalSnappyMagic = []byte{0xff, 's', 'n', 'a', 'p'}
+
 // ReadSnapshotJournal retrieves the serialized in-memory diff layers saved at
 // the last shutdown. The blob is expected to be max a few 10s of megabytes.
-func ReadSnapshotJournal(db ongdb.KeyValueReader) []byte {
+// An error is returned if the journal was only partially written or corrupted.
+//
+// Journals written before the integrity header was introduced are accepted as
+// is. They are told apart by their leading RLP prefix byte, which would declare
+// a payload of at least 2GB if interpreted as a length. Journals written by
+// WriteSnapshotJournalCompressed are decompressed transparently.
+func ReadSnapshotJournal(db ongdb.KeyValueReader) ([]byte, error) {
 	data, _ := db.Get(snapshotJournalKey)
-	return data
+	snapshotMeters.journal.read(data)
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if data[0] >= 0x80 {
+		log.Warn("Loading snapshot journal without integrity header")
+		return data, nil
+	}
+	if len(data) < snapshotJournalHeaderSize {
+		return nil, fmt.Errorf("snapshot journal header truncated: %d bytes", len(data))
+	}
+	size, sum := binary.BigEndian.Uint32(data[:4]), binary.BigEndian.Uint32(data[4:8])
+	payload := data[snapshotJournalHeaderSize:]
+	if uint64(len(payload)) != uint64(size) {
+		return nil, fmt.Errorf("snapshot journal size mismatch: have %d, want %d", len(payload), size)
+	}
+	if have := crc32.ChecksumIEEE(payload); have != sum {
+		return nil, fmt.Errorf("snapshot journal checksum mismatch: have %08x, want %08x", have, sum)
+	}
+	if bytes.HasPrefix(payload, snapshotJournalSnappyMagic) {
+		journal, err := snappy.Decode(nil, payload[len(snapshotJournalSnappyMagic):])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress snapshot journal: %v", err)
+		}
+		return journal, nil
+	}
+	return payload, nil
+}
+
+// ReadSnapshotJournalReader retrieves the serialized in-memory diff layers saved
+// at the last shutdown as a stream, or nil if no journal was saved. The journal
+// is validated and decompressed as by ReadSnapshotJournal.
+//
+// The key-value stores only support full value reads, so the stream is currently
+// backed by the journal loaded in one go. Decoding from the stream keeps callers
+// independent of that, should the stores learn to stream values. Until then, the
+// stream also reports the journal size via a Size() int64 method.
+func ReadSnapshotJournalReader(db ongdb.KeyValueReader) (io.ReadCloser, error) {
+	journal, err := ReadSnapshotJournal(db)
+	if err != nil || journal == nil {
+		return nil, err
+	}
+	return snapshotJournalStream{bytes.NewReader(journal)}, nil
+}
+
+// snapshotJournalStream is a snapshot journal stream backed by the journal loaded
+// in one go, so there is nothing to release on close.
+type snapshotJournalStream struct {
+	*bytes.Reader
+}
+
+// Close implements io.Closer.
+func (s snapshotJournalStream) Close() error {
+	return nil
 }
 
 // WriteSnapshotJournal stores the serialized in-memory diff layers to save at
 // shutdown. The blob is expected to be max a few 10s of megabytes.
 func WriteSnapshotJournal(db ongdb.KeyValueWriter, journal []byte) {
-	if err := db.Put(snapshotJournalKey, journal); err != nil {
+	if err := TryWriteSnapshotJournal(db, journal); err != nil {
+		log.Crit("Failed to store snapshot journal", "err", err)
+	}
+}
+
+// TryWriteSnapshotJournal is the error-returning variant of WriteSnapshotJournal.
+func TryWriteSnapshotJournal(db ongdb.KeyValueWriter, journal []byte) error {
+	return writeSnapshotJournalPayload(db, journal)
+}
+
+// WriteSnapshotJournalCompressed stores the serialized in-memory diff layers to
+// save at shutdown, compressed with snappy. ReadSnapshotJournal decompresses it
+// transparently, but older versions are unable to load it.
+func WriteSnapshotJournalCompressed(db ongdb.KeyValueWriter, journal []byte) {
+	if err := TryWriteSnapshotJournalCompressed(db, journal); err != nil {
 		log.Crit("Failed to store snapshot journal", "err", err)
 	}
 }
 
+// TryWriteSnapshotJournalCompressed is the error-returning variant of
+// WriteSnapshotJournalCompressed.
+func TryWriteSnapshotJournalCompressed(db ongdb.KeyValueWriter, journal []byte) error {
+	payload := make([]byte, len(snapshotJournalSnappyMagic)+snappy.MaxEncodedLen(len(journal)))
+	copy(payload, snapshotJournalSnappyMagic)
+	compressed := snappy.Encode(payload[len(snapshotJournalSnappyMagic):], journal)
+
+	return writeSnapshotJournalPayload(db, payload[:len(snapshotJournalSnappyMagic)+len(compressed)])
+}
+
+// writeSnapshotJournalPayload stores a snapshot journal payload, prepending the
+// integrity header to it.
+func writeSnapshotJournalPayload(db ongdb.KeyValueWriter, payload []byte) error {
+	if uint64(len(payload)) >= 1<<31 {
+		return fmt.Errorf("snapshot journal too large: %d bytes", len(payload))
+	}
+	data := make([]byte, snapshotJournalHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(data[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(data[4:8], crc32.ChecksumIEEE(payload))
+	copy(data[snapshotJournalHeaderSize:], payload)
+
+	snapshotMeters.journal.write(data)
+	return db.Put(snapshotJournalKey, data)
+}
+
 // DeleteSnapshotJournal deletes the serialized in-memory diff layers saved at
 // the last shutdown
 func DeleteSnapshotJournal(db ongdb.KeyValueWriter) {
-	if err := db.Delete(snapshotJournalKey); err != nil {
+	if err := TryDeleteSnapshotJournal(db); err != nil {
 		log.Crit("Failed to remove snapshot journal", "err", err)
 	}
 }
 
+// TryDeleteSnapshotJournal is the error-returning variant of DeleteSnapshotJournal.
+func TryDeleteSnapshotJournal(db ongdb.KeyValueWriter) error {
+	snapshotMeters.journal.delete()
+	return db.Delete(snapshotJournalKey)
+}
+
 // ReadSnapshotGenerator retrieves the serialized snapshot generator saved at
 // the last shutdown.
 func ReadSnapshotGenerator(db ongdb.KeyValueReader) []byte {
 	data, _ := db.Get(snapshotGeneratorKey)
+	snapshotMeters.generator.read(data)
 	return data
 }
 
 // WriteSnapshotGenerator stores the serialized snapshot generator to save at
 // shutdown.
 func WriteSnapshotGenerator(db ongdb.KeyValueWriter, generator []byte) {
-	if err := db.Put(snapshotGeneratorKey, generator); err != nil {
+	if err := TryWriteSnapshotGenerator(db, generator); err != nil {
 		log.Crit("Failed to store snapshot generator", "err", err)
 	}
 }
 
+// TryWriteSnapshotGenerator is the error-returning variant of WriteSnapshotGenerator.
+func TryWriteSnapshotGenerator(db ongdb.KeyValueWriter, generator []byte) error {
+	snapshotMeters.generator.write(generator)
+	return db.Put(snapshotGeneratorKey, generator)
+}
+
 // DeleteSnapshotGenerator deletes the serialized snapshot generator saved at
 // the last shutdown
 func DeleteSnapshotGenerator(db ongdb.KeyValueWriter) {
-	if err := db.Delete(snapshotGeneratorKey); err != nil {
+	if err := TryDeleteSnapshotGenerator(db); err != nil {
 		log.Crit("Failed to remove snapshot generator", "err", err)
 	}
 }
 
+// TryDeleteSnapshotGenerator is the error-returning variant of DeleteSnapshotGenerator.
+func TryDeleteSnapshotGenerator(db ongdb.KeyValueWriter) error {
+	snapshotMeters.generator.delete()
+	return db.Delete(snapshotGeneratorKey)
+}
+
+// GeneratorProgress is the decoded form of the snapshot generator progress
+// marker persisted by the snapshot generator.
+type GeneratorProgress struct {
+	Wiping   bool   // Whether the database was in progress of being wiped (legacy, kept for layout compatibility)
+	Done     bool   // Whether the generator finished creating the snapshot
+	Marker   []byte // Key of the last generated account or storage slot
+	Accounts uint64 // Number of accounts generated so far
+	Slots    uint64 // Number of storage slots generated so far
+	Storage  uint64 // Total size of the generated leaves so far
+}
+
+// ReadSnapshotGeneratorProgress retrieves and decodes the snapshot generator
+// progress marker saved at the last shutdown. Nil is returned if no generator
+// progress was saved.
+func ReadSnapshotGeneratorProgress(db ongdb.KeyValueReader) (*GeneratorProgress, error) {
+	blob := ReadSnapshotGenerator(db)
+	if len(blob) == 0 {
+		return nil, nil
+	}
+	progress := new(GeneratorProgress)
+	if err := rlp.DecodeBytes(blob, progress); err != nil {
+		return nil, fmt.Errorf("failed to decode snapshot generator: %v", err)
+	}
+	return progress, nil
+}
+
+// WriteSnapshotGeneratorProgress encodes and stores the snapshot generator
+// progress marker.
+func WriteSnapshotGeneratorProgress(db ongdb.KeyValueWriter, progress *GeneratorProgress) {
+	if err := TryWriteSnapshotGeneratorProgress(db, progress); err != nil {
+		log.Crit("Failed to store snapshot generator", "err", err)
+	}
+}
+
+// TryWriteSnapshotGeneratorProgress is the error-returning variant of
+// WriteSnapshotGeneratorProgress.
+func TryWriteSnapshotGeneratorProgress(db ongdb.KeyValueWriter, progress *GeneratorProgress) error {
+	blob, err := rlp.EncodeToBytes(progress)
+	if err != nil {
+		return err
+	}
+	return TryWriteSnapshotGenerator(db, blob)
+}
+
 // ReadSnapshotRecoveryNumber retrieves the block number of the last persisted
-// snapshot layer.
+// snapshot layer. Legacy 4-byte encodings are widened transparently, they can be
+// rewritten into the current form via MigrateSnapshotRecoveryNumber.
 func ReadSnapshotRecoveryNumber(db ongdb.KeyValueReader) *uint64 {
 	data, _ := db.Get(snapshotRecoveryKey)
-	if len(data) == 0 {
-		return nil
-	}
-	if len(data) != 8 {
+	snapshotMeters.recovery.read(data)
+	return decodeSnapshotRecoveryNumber(data)
+}
+
+// decodeSnapshotRecoveryNumber decodes a snapshot recovery number, accepting both
+// the current 8-byte and the legacy 4-byte big endian encodings.
+func decodeSnapshotRecoveryNumber(data []byte) *uint64 {
+	var number uint64
+	switch len(data) {
+	case 8:
+		number = binary.BigEndian.Uint64(data)
+	case 4:
+		number = uint64(binary.BigEndian.Uint32(data))
+	default:
 		return nil
 	}
-	number := binary.BigEndian.Uint64(data)
 	return &number
 }
 
+// MigrateSnapshotRecoveryNumber rewrites a snapshot recovery number stored in the
+// legacy 4-byte encoding into the current 8-byte one, reporting whether anything
+// was migrated.
+func MigrateSnapshotRecoveryNumber(db ongdb.KeyValueStore) (bool, error) {
+	data, _ := db.Get(snapshotRecoveryKey)
+	snapshotMeters.recovery.read(data)
+	if len(data) != 4 {
+		return false, nil
+	}
+	number := decodeSnapshotRecoveryNumber(data)
+	if err := TryWriteSnapshotRecoveryNumber(db, *number); err != nil {
+		return false, err
+	}
+	log.Info("Migrated legacy snapshot recovery number", "number", *number)
+	return true, nil
+}
+
 // WriteSnapshotRecoveryNumber stores the block number of the last persisted
 // snapshot layer.
 func WriteSnapshotRecoveryNumber(db ongdb.KeyValueWriter, number uint64) {
-	var buf [8]byte
-	binary.BigEndian.PutUint64(buf[:], number)
-	if err := db.Put(snapshotRecoveryKey, buf[:]); err != nil {
+	if err := TryWriteSnapshotRecoveryNumber(db, number); err != nil {
 		log.Crit("Failed to store snapshot recovery number", "err", err)
 	}
 }
 
+// TryWriteSnapshotRecoveryNumber is the error-returning variant of WriteSnapshotRecoveryNumber.
+func TryWriteSnapshotRecoveryNumber(db ongdb.KeyValueWriter, number uint64) error {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], number)
+	snapshotMeters.recovery.write(buf[:])
+	return db.Put(snapshotRecoveryKey, buf[:])
+}
+
 // DeleteSnapshotRecoveryNumber deletes the block number of the last persisted
 // snapshot layer.
 func DeleteSnapshotRecoveryNumber(db ongdb.KeyValueWriter) {
-	if err := db.Delete(snapshotRecoveryKey); err != nil {
+	if err := TryDeleteSnapshotRecoveryNumber(db); err != nil {
 		log.Crit("Failed to remove snapshot recovery number", "err", err)
 	}
 }
 
+// TryDeleteSnapshotRecoveryNumber is the error-returning variant of DeleteSnapshotRecoveryNumber.
+func TryDeleteSnapshotRecoveryNumber(db ongdb.KeyValueWriter) error {
+	snapshotMeters.recovery.delete()
+	return db.Delete(snapshotRecoveryKey)
+}
+
 // ReadSnapshotSyncStatus retrieves the serialized sync status saved at shutdown.
 func ReadSnapshotSyncStatus(db ongdb.KeyValueReader) []byte {
 	data, _ := db.Get(snapshotSyncStatusKey)
+	snapshotMeters.sync.read(data)
 	return data
 }
 
 // WriteSnapshotSyncStatus stores the serialized sync status to save at shutdown.
 func WriteSnapshotSyncStatus(db ongdb.KeyValueWriter, status []byte) {
-	if err := db.Put(snapshotSyncStatusKey, status); err != nil {
+	if err := TryWriteSnapshotSyncStatus(db, status); err != nil {
 		log.Crit("Failed to store snapshot sync status", "err", err)
 	}
 }
 
+// TryWriteSnapshotSyncStatus is the error-returning variant of WriteSnapshotSyncStatus.
+func TryWriteSnapshotSyncStatus(db ongdb.KeyValueWriter, status []byte) error {
+	snapshotMeters.sync.write(status)
+	return db.Put(snapshotSyncStatusKey, status)
+}
+
 // DeleteSnapshotSyncStatus deletes the serialized sync status saved at the last
 // shutdown
 func DeleteSnapshotSyncStatus(db ongdb.KeyValueWriter) {
-	if err := db.Delete(snapshotSyncStatusKey); err != nil {
+	if err := TryDeleteSnapshotSyncStatus(db); err != nil {
 		log.Crit("Failed to remove snapshot sync status", "err", err)
 	}
 }
+
+// TryDeleteSnapshotSyncStatus is the error-returning variant of DeleteSnapshotSyncStatus.
+func TryDeleteSnapshotSyncStatus(db ongdb.KeyValueWriter) error {
+	snapshotMeters.sync.delete()
+	return db.Delete(snapshotSyncStatusKey)
+}
+
+// snapshotSeqLock serializes the read-modify-write cycles of TryNextSnapshotSeq,
+// TryBumpSnapshotFlushGen and TryAppendSnapshotWipedAccount, as the key-value
+// stores have no atomic update of their own.
+var snapshotSeqLock sync.Mutex
+
+// ReadSnapshotFlushGen retrieves the generation number of the last disk layer
+// flush, or zero if the disk layer was never flushed.
+func ReadSnapshotFlushGen(db ongdb.KeyValueReader) uint64 {
+	data, _ := db.Get(snapshotFlushGenKey)
+	snapshotMeters.metadata.read(data)
+	if len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
+
+// BumpSnapshotFlushGen increments the generation number of the disk layer
+// flushes and returns the new value. Concurrent callers within the process are
+// guaranteed distinct, monotonically increasing generations.
+func BumpSnapshotFlushGen(db ongdb.KeyValueStore) uint64 {
+	gen, err := TryBumpSnapshotFlushGen(db)
+	if err != nil {
+		log.Crit("Failed to store snapshot flush generation", "err", err)
+	}
+	return gen
+}
+
+// TryBumpSnapshotFlushGen is the error-returning variant of BumpSnapshotFlushGen.
+func TryBumpSnapshotFlushGen(db ongdb.KeyValueStore) (uint64, error) {
+	snapshotSeqLock.Lock()
+	defer snapshotSeqLock.Unlock()
+
+	gen := ReadSnapshotFlushGen(db) + 1
+
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], gen)
+	snapshotMeters.metadata.write(buf[:])
+	if err := db.Put(snapshotFlushGenKey, buf[:]); err != nil {
+		return 0, err
+	}
+	return gen, nil
+}
+
+// ReadSnapshotSeq retrieves the last snapshot sequence number handed out, or
+// zero if none was handed out yet.
+func ReadSnapshotSeq(db ongdb.KeyValueReader) uint64 {
+	data, _ := db.Get(snapshotSeqKey)
+	snapshotMeters.metadata.read(data)
+	if len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
+
+// NextSnapshotSeq increments the persisted snapshot sequence number and returns
+// the new value. Concurrent callers within the process are guaranteed distinct,
+// monotonically increasing numbers.
+func NextSnapshotSeq(db ongdb.KeyValueStore) uint64 {
+	seq, err := TryNextSnapshotSeq(db)
+	if err != nil {
+		log.Crit("Failed to store snapshot sequence", "err", err)
+	}
+	return seq
+}
+
+// TryNextSnapshotSeq is the error-returning variant of NextSnapshotSeq.
+func TryNextSnapshotSeq(db ongdb.KeyValueStore) (uint64, error) {
+	snapshotSeqLock.Lock()
+	defer snapshotSeqLock.Unlock()
+
+	seq := ReadSnapshotSeq(db) + 1
+
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], seq)
+	snapshotMeters.metadata.write(buf[:])
+	if err := db.Put(snapshotSeqKey, buf[:]); err != nil {
+		return 0, err
+	}
+	return seq, nil
+}
+
+// ReadSnapshotWipedAccounts retrieves the list of accounts whose stale leaves
+// were wiped during snapshot generation.
+func ReadSnapshotWipedAccounts(db ongdb.KeyValueReader) ([]common.Hash, error) {
+	data, _ := db.Get(snapshotWipedAccountsKey)
+	snapshotMeters.generator.read(data)
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var hashes []common.Hash
+	if err := rlp.DecodeBytes(data, &hashes); err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// AppendSnapshotWipedAccount adds an account to the list of accounts whose stale
+// leaves were wiped during snapshot generation. Concurrent appends within the
+// process are serialized, so none of them are lost.
+func AppendSnapshotWipedAccount(db ongdb.KeyValueStore, hash common.Hash) {
+	if err := TryAppendSnapshotWipedAccount(db, hash); err != nil {
+		log.Crit("Failed to store snapshot wiped account", "err", err)
+	}
+}
+
+// TryAppendSnapshotWipedAccount is the error-returning variant of
+// AppendSnapshotWipedAccount.
+func TryAppendSnapshotWipedAccount(db ongdb.KeyValueStore, hash common.Hash) error {
+	snapshotSeqLock.Lock()
+	defer snapshotSeqLock.Unlock()
+
+	hashes, err := ReadSnapshotWipedAccounts(db)
+	if err != nil {
+		return err
+	}
+	data, err := rlp.EncodeToBytes(append(hashes, hash))
+	if err != nil {
+		return err
+	}
+	snapshotMeters.generator.write(data)
+	return db.Put(snapshotWipedAccountsKey, data)
+}
+
+// ReadSnapshotGenWorkers retrieves the number of workers the snapshot was
+// generated with.
+func ReadSnapshotGenWorkers(db ongdb.KeyValueReader) (int, bool) {
+	data, _ := db.Get(snapshotGenWorkersKey)
+	snapshotMeters.generator.read(data)
+	if len(data) != 8 {
+		return 0, false
+	}
+	return int(binary.BigEndian.Uint64(data)), true
+}
+
+// WriteSnapshotGenWorkers stores the number of workers the snapshot was
+// generated with.
+func WriteSnapshotGenWorkers(db ongdb.KeyValueWriter, n int) {
+	if err := TryWriteSnapshotGenWorkers(db, n); err != nil {
+		log.Crit("Failed to store snapshot generator workers", "err", err)
+	}
+}
+
+// TryWriteSnapshotGenWorkers is the error-returning variant of WriteSnapshotGenWorkers.
+func TryWriteSnapshotGenWorkers(db ongdb.KeyValueWriter, n int) error {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(n))
+	snapshotMeters.generator.write(buf[:])
+	return db.Put(snapshotGenWorkersKey, buf[:])
+}
+
+// ReadSnapshotNetworkID retrieves the id of the network the persisted snapshot
+// belongs to.
+func ReadSnapshotNetworkID(db ongdb.KeyValueReader) (uint64, bool) {
+	data, _ := db.Get(snapshotNetworkIDKey)
+	snapshotMeters.metadata.read(data)
+	if len(data) != 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(data), true
+}
+
+// WriteSnapshotNetworkID stores the id of the network the persisted snapshot
+// belongs to.
+func WriteSnapshotNetworkID(db ongdb.KeyValueWriter, id uint64) {
+	if err := TryWriteSnapshotNetworkID(db, id); err != nil {
+		log.Crit("Failed to store snapshot network id", "err", err)
+	}
+}
+
+// TryWriteSnapshotNetworkID is the error-returning variant of WriteSnapshotNetworkID.
+func TryWriteSnapshotNetworkID(db ongdb.KeyValueWriter, id uint64) error {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], id)
+	snapshotMeters.metadata.write(buf[:])
+	return db.Put(snapshotNetworkIDKey, buf[:])
+}
+
+// EnsureSnapshotNetworkID checks that the persisted snapshot belongs to the
+// expected network. If no network id was recorded yet, the expected one is
+// stored.
+func EnsureSnapshotNetworkID(db ongdb.KeyValueStore, expected uint64) error {
+	id, ok := ReadSnapshotNetworkID(db)
+	if !ok {
+		return TryWriteSnapshotNetworkID(db, expected)
+	}
+	if id != expected {
+		return fmt.Errorf("snapshot network id mismatch: have %d, want %d", id, expected)
+	}
+	return nil
+}
+
+// ReadSnapshotAddressHint retrieves the address of the account whose snapshot
+// leaf is stored under the given account hash, if a hint was recorded.
+func ReadSnapshotAddressHint(db ongdb.KeyValueReader, hash common.Hash) (common.Address, bool) {
+	data, _ := db.Get(snapshotAddressHintKey(hash))
+	snapshotMeters.metadata.read(data)
+	if len(data) != common.AddressLength {
+		return common.Address{}, false
+	}
+	return common.BytesToAddress(data), true
+}
+
+// WriteSnapshotAddressHint stores the address of the account whose snapshot leaf
+// is stored under the given account hash, for debugging purposes.
+func WriteSnapshotAddressHint(db ongdb.KeyValueWriter, hash common.Hash, addr common.Address) {
+	if err := TryWriteSnapshotAddressHint(db, hash, addr); err != nil {
+		log.Crit("Failed to store snapshot address hint", "err", err)
+	}
+}
+
+// TryWriteSnapshotAddressHint is the error-returning variant of WriteSnapshotAddressHint.
+func TryWriteSnapshotAddressHint(db ongdb.KeyValueWriter, hash common.Hash, addr common.Address) error {
+	snapshotMeters.metadata.write(addr[:])
+	return db.Put(snapshotAddressHintKey(hash), addr[:])
+}
+
+// The state trie schemes a snapshot can target.
+const (
+	SnapshotHashScheme = "hash" // State trie nodes keyed by their hash
+	SnapshotPathScheme = "path" // State trie nodes keyed by their path
+)
+
+// ReadSnapshotTrieScheme retrieves the state trie scheme the persisted snapshot
+// targets. Missing or unknown schemes are reported as absent.
+func ReadSnapshotTrieScheme(db ongdb.KeyValueReader) (string, bool) {
+	data, _ := db.Get(snapshotTrieSchemeKey)
+	snapshotMeters.metadata.read(data)
+	switch scheme := string(data); scheme {
+	case SnapshotHashScheme, SnapshotPathScheme:
+		return scheme, true
+	default:
+		return "", false
+	}
+}
+
+// WriteSnapshotTrieScheme stores the state trie scheme the persisted snapshot
+// targets.
+func WriteSnapshotTrieScheme(db ongdb.KeyValueWriter, scheme string) {
+	if err := TryWriteSnapshotTrieScheme(db, scheme); err != nil {
+		log.Crit("Failed to store snapshot trie scheme", "err", err)
+	}
+}
+
+// TryWriteSnapshotTrieScheme is the error-returning variant of WriteSnapshotTrieScheme.
+// Unknown schemes are rejected without touching the database.
+func TryWriteSnapshotTrieScheme(db ongdb.KeyValueWriter, scheme string) error {
+	if scheme != SnapshotHashScheme && scheme != SnapshotPathScheme {
+		return fmt.Errorf("unknown snapshot trie scheme %q", scheme)
+	}
+	snapshotMeters.metadata.write([]byte(scheme))
+	return db.Put(snapshotTrieSchemeKey, []byte(scheme))
+}
+
+// ReadSnapshotGenUUID retrieves the identifier of the snapshot generation run,
+// used to correlate the logs of a generation across restarts.
+func ReadSnapshotGenUUID(db ongdb.KeyValueReader) (string, bool) {
+	data, _ := db.Get(snapshotGenUUIDKey)
+	snapshotMeters.generator.read(data)
+	if _, err := uuid.ParseBytes(data); err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// WriteSnapshotGenUUID stores the identifier of the snapshot generation run.
+func WriteSnapshotGenUUID(db ongdb.KeyValueWriter, id string) {
+	if err := TryWriteSnapshotGenUUID(db, id); err != nil {
+		log.Crit("Failed to store snapshot generator uuid", "err", err)
+	}
+}
+
+// TryWriteSnapshotGenUUID is the error-returning variant of WriteSnapshotGenUUID.
+// Malformed identifiers are rejected without touching the database.
+func TryWriteSnapshotGenUUID(db ongdb.KeyValueWriter, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return fmt.Errorf("invalid snapshot generator uuid %q: %v", id, err)
+	}
+	snapshotMeters.generator.write([]byte(id))
+	return db.Put(snapshotGenUUIDKey, []byte(id))
+}
+
+// NewSnapshotGenUUID generates a random identifier for a new snapshot generation
+// run and stores it.
+func NewSnapshotGenUUID(db ongdb.KeyValueWriter) string {
+	id := uuid.New().String()
+	WriteSnapshotGenUUID(db, id)
+	return id
+}
+
+// The consensus engines a snapshot's chain can be run by.
+const (
+	SnapshotOngashEngine = "ongash" // Proof-of-work
+	SnapshotCliqueEngine = "clique" // Proof-of-authority
+	SnapshotBeaconEngine = "beacon" // Proof-of-stake
+)
+
+// ReadSnapshotEngine retrieves the name of the consensus engine of the chain
+// the persisted snapshot belongs to. Missing or unknown engines are reported
+// as absent.
+func ReadSnapshotEngine(db ongdb.KeyValueReader) (string, bool) {
+	data, _ := db.Get(snapshotEngineKey)
+	snapshotMeters.metadata.read(data)
+	switch engine := string(data); engine {
+	case SnapshotOngashEngine, SnapshotCliqueEngine, SnapshotBeaconEngine:
+		return engine, true
+	default:
+		return "", false
+	}
+}
+
+// WriteSnapshotEngine stores the name of the consensus engine of the chain the
+// persisted snapshot belongs to.
+func WriteSnapshotEngine(db ongdb.KeyValueWriter, name string) {
+	if err := TryWriteSnapshotEngine(db, name); err != nil {
+		log.Crit("Failed to store snapshot consensus engine", "err", err)
+	}
+}
+
+// TryWriteSnapshotEngine is the error-returning variant of WriteSnapshotEngine.
+// Unknown engines are rejected without touching the database.
+func TryWriteSnapshotEngine(db ongdb.KeyValueWriter, name string) error {
+	switch name {
+	case SnapshotOngashEngine, SnapshotCliqueEngine, SnapshotBeaconEngine:
+	default:
+		return fmt.Errorf("unknown snapshot consensus engine %q", name)
+	}
+	snapshotMeters.metadata.write([]byte(name))
+	return db.Put(snapshotEngineKey, []byte(name))
+}
+
+// ReadSnapshotExpectedCounts retrieves the expected number of account and
+// storage snapshot leaves.
+func ReadSnapshotExpectedCounts(db ongdb.KeyValueReader) (accounts, storage uint64, ok bool) {
+	data, _ := db.Get(snapshotExpectedCountsKey)
+	snapshotMeters.metadata.read(data)
+	if len(data) != 16 {
+		return 0, 0, false
+	}
+	return binary.BigEndian.Uint64(data[:8]), binary.BigEndian.Uint64(data[8:]), true
+}
+
+// WriteSnapshotExpectedCounts stores the expected number of account and storage
+// snapshot leaves, to detect partial loss via VerifySnapshotCounts.
+func WriteSnapshotExpectedCounts(db ongdb.KeyValueWriter, accounts, storage uint64) {
+	if err := TryWriteSnapshotExpectedCounts(db, accounts, storage); err != nil {
+		log.Crit("Failed to store expected snapshot counts", "err", err)
+	}
+}
+
+// TryWriteSnapshotExpectedCounts is the error-returning variant of
+// WriteSnapshotExpectedCounts.
+func TryWriteSnapshotExpectedCounts(db ongdb.KeyValueWriter, accounts, storage uint64) error {
+	var buf [16]byte
+	binary.BigEndian.PutUint64(buf[:8], accounts)
+	binary.BigEndian.PutUint64(buf[8:], storage)
+	snapshotMeters.metadata.write(buf[:])
+	return db.Put(snapshotExpectedCountsKey, buf[:])
+}
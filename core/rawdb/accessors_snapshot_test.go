@@ -0,0 +1,1020 @@
+// Copyright 2021 The go-orange Authors
+// This file is part of the go-orange library.
+//
+// The go-orange library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-orange library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-orange library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/ong2020/go-orange/common"
+	"github.com/ong2020/go-orange/core/types"
+	"github.com/ong2020/go-orange/crypto"
+	"github.com/ong2020/go-orange/metrics"
+	"github.com/ong2020/go-orange/ongdb"
+	"github.com/ong2020/go-orange/rlp"
+)
+
+// Tests that the disk layer flush generation starts from zero and is bumped
+// sequentially, even by concurrent callers.
+func TestSnapshotFlushGen(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	if gen := ReadSnapshotFlushGen(db); gen != 0 {
+		t.Fatalf("absent flush generation mismatch: have %d, want %d", gen, 0)
+	}
+	for i := uint64(1); i <= 3; i++ {
+		gen, err := TryBumpSnapshotFlushGen(db)
+		if err != nil {
+			t.Fatalf("failed to bump flush generation: %v", err)
+		}
+		if gen != i {
+			t.Fatalf("bumped flush generation mismatch: have %d, want %d", gen, i)
+		}
+		if stored := ReadSnapshotFlushGen(db); stored != i {
+			t.Fatalf("stored flush generation mismatch: have %d, want %d", stored, i)
+		}
+	}
+	// Bump the generation concurrently and ensure none are duplicated
+	var (
+		gens = make(chan uint64, 100)
+		errc = make(chan error, 100)
+	)
+	for i := 0; i < 100; i++ {
+		go func() {
+			gen, err := TryBumpSnapshotFlushGen(db)
+			gens <- gen
+			errc <- err
+		}()
+	}
+	seen := make(map[uint64]bool)
+	for i := 0; i < 100; i++ {
+		if err := <-errc; err != nil {
+			t.Fatalf("failed to bump flush generation: %v", err)
+		}
+		seen[<-gens] = true
+	}
+	for i := uint64(4); i <= 103; i++ {
+		if !seen[i] {
+			t.Errorf("flush generation %d not handed out", i)
+		}
+	}
+	if gen := ReadSnapshotFlushGen(db); gen != 103 {
+		t.Fatalf("final flush generation mismatch: have %d, want %d", gen, 103)
+	}
+}
+
+// Tests that the snapshot sequence starts from zero and is incremented
+// sequentially, even by concurrent callers.
+func TestSnapshotSeq(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	if seq := ReadSnapshotSeq(db); seq != 0 {
+		t.Fatalf("absent sequence mismatch: have %d, want %d", seq, 0)
+	}
+	for i := uint64(1); i <= 3; i++ {
+		seq, err := TryNextSnapshotSeq(db)
+		if err != nil {
+			t.Fatalf("failed to increment sequence: %v", err)
+		}
+		if seq != i {
+			t.Fatalf("incremented sequence mismatch: have %d, want %d", seq, i)
+		}
+		if stored := ReadSnapshotSeq(db); stored != i {
+			t.Fatalf("stored sequence mismatch: have %d, want %d", stored, i)
+		}
+	}
+	// Hand out sequence numbers concurrently and ensure none are duplicated
+	var (
+		seqs = make(chan uint64, 100)
+		errc = make(chan error, 100)
+	)
+	for i := 0; i < 100; i++ {
+		go func() {
+			seq, err := TryNextSnapshotSeq(db)
+			seqs <- seq
+			errc <- err
+		}()
+	}
+	seen := make(map[uint64]bool)
+	for i := 0; i < 100; i++ {
+		if err := <-errc; err != nil {
+			t.Fatalf("failed to increment sequence: %v", err)
+		}
+		seen[<-seqs] = true
+	}
+	for i := uint64(4); i <= 103; i++ {
+		if !seen[i] {
+			t.Errorf("sequence number %d not handed out", i)
+		}
+	}
+	if seq := ReadSnapshotSeq(db); seq != 103 {
+		t.Fatalf("final sequence mismatch: have %d, want %d", seq, 103)
+	}
+}
+
+// Tests that the snapshot recovery number is decoded from both the current and
+// the legacy encodings, and that legacy values are migrated to the current one.
+func TestSnapshotRecoveryNumberLegacy(t *testing.T) {
+	tests := []struct {
+		blob     []byte
+		want     *uint64
+		migrated bool
+	}{
+		{blob: nil},
+		{blob: []byte{0x01, 0x02, 0x03}},
+		{blob: []byte{0x00, 0x01, 0x00, 0x00}, want: newUint64(65536), migrated: true},
+		{blob: []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00}, want: newUint64(65536)},
+	}
+	for i, tt := range tests {
+		db := NewMemoryDatabase()
+		if tt.blob != nil {
+			db.Put(snapshotRecoveryKey, tt.blob)
+		}
+		if have := ReadSnapshotRecoveryNumber(db); !reflect.DeepEqual(have, tt.want) {
+			t.Errorf("test %d: recovery number mismatch: have %v, want %v", i, have, tt.want)
+		}
+		migrated, err := MigrateSnapshotRecoveryNumber(db)
+		if err != nil {
+			t.Fatalf("test %d: failed to migrate recovery number: %v", i, err)
+		}
+		if migrated != tt.migrated {
+			t.Errorf("test %d: migration mismatch: have %v, want %v", i, migrated, tt.migrated)
+		}
+		if have := ReadSnapshotRecoveryNumber(db); !reflect.DeepEqual(have, tt.want) {
+			t.Errorf("test %d: migrated recovery number mismatch: have %v, want %v", i, have, tt.want)
+		}
+		// Migrated values must be stored in the current encoding
+		if blob, _ := db.Get(snapshotRecoveryKey); tt.migrated && len(blob) != 8 {
+			t.Errorf("test %d: migrated recovery number length mismatch: have %d, want %d", i, len(blob), 8)
+		}
+	}
+}
+
+// newUint64 returns a pointer to a copy of the given number.
+func newUint64(n uint64) *uint64 { return &n }
+
+// Tests that wiped accounts are appended to the persisted list in order, and that
+// concurrent appends are not lost.
+func TestSnapshotWipedAccounts(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	if hashes, err := ReadSnapshotWipedAccounts(db); err != nil || len(hashes) != 0 {
+		t.Fatalf("absent wiped accounts mismatch: have %v/%v, want none", hashes, err)
+	}
+	want := []common.Hash{{0x03}, {0x01}, {0x02}}
+	for _, hash := range want {
+		if err := TryAppendSnapshotWipedAccount(db, hash); err != nil {
+			t.Fatalf("failed to append wiped account: %v", err)
+		}
+	}
+	hashes, err := ReadSnapshotWipedAccounts(db)
+	if err != nil {
+		t.Fatalf("failed to read wiped accounts: %v", err)
+	}
+	if !reflect.DeepEqual(hashes, want) {
+		t.Fatalf("wiped accounts mismatch: have %v, want %v", hashes, want)
+	}
+	// Append accounts concurrently and ensure none are dropped
+	errc := make(chan error, 100)
+	for i := 0; i < 100; i++ {
+		go func(i int) {
+			errc <- TryAppendSnapshotWipedAccount(db, common.Hash{0xff, byte(i)})
+		}(i)
+	}
+	for i := 0; i < 100; i++ {
+		if err := <-errc; err != nil {
+			t.Fatalf("failed to append wiped account: %v", err)
+		}
+	}
+	if hashes, err = ReadSnapshotWipedAccounts(db); err != nil || len(hashes) != len(want)+100 {
+		t.Fatalf("concurrent wiped accounts mismatch: have %d/%v, want %d/nil", len(hashes), err, len(want)+100)
+	}
+	// Corrupt list must be reported, not silently dropped
+	db.Put(snapshotWipedAccountsKey, []byte{0xff})
+	if _, err := ReadSnapshotWipedAccounts(db); err == nil {
+		t.Fatalf("corrupt wiped accounts accepted")
+	}
+}
+
+// Tests that the snapshot generator worker count can be stored and retrieved.
+func TestSnapshotGenWorkers(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	if n, ok := ReadSnapshotGenWorkers(db); ok {
+		t.Fatalf("absent worker count returned: %d", n)
+	}
+	for _, want := range []int{1, 16, 0} {
+		WriteSnapshotGenWorkers(db, want)
+		if n, ok := ReadSnapshotGenWorkers(db); !ok || n != want {
+			t.Fatalf("worker count mismatch: have %d/%v, want %d/true", n, ok, want)
+		}
+	}
+}
+
+// Tests that the snapshot network id guard accepts matching ids, rejects
+// mismatching ones and records the expected id if none is stored.
+func TestEnsureSnapshotNetworkID(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	if id, ok := ReadSnapshotNetworkID(db); ok {
+		t.Fatalf("absent network id returned: %d", id)
+	}
+	if err := EnsureSnapshotNetworkID(db, 1337); err != nil {
+		t.Fatalf("absent network id rejected: %v", err)
+	}
+	if id, ok := ReadSnapshotNetworkID(db); !ok || id != 1337 {
+		t.Fatalf("network id mismatch: have %d/%v, want %d/true", id, ok, 1337)
+	}
+	if err := EnsureSnapshotNetworkID(db, 1337); err != nil {
+		t.Fatalf("matching network id rejected: %v", err)
+	}
+	if err := EnsureSnapshotNetworkID(db, 1); err == nil {
+		t.Fatalf("mismatching network id accepted")
+	}
+	if id, _ := ReadSnapshotNetworkID(db); id != 1337 {
+		t.Fatalf("network id overwritten on mismatch: have %d, want %d", id, 1337)
+	}
+}
+
+// Tests that account address hints can be stored and retrieved.
+func TestSnapshotAddressHint(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	addr := common.HexToAddress("0x0102030405060708090a0b0c0d0e0f1011121314")
+	hash := crypto.Keccak256Hash(addr.Bytes())
+
+	if _, ok := ReadSnapshotAddressHint(db, hash); ok {
+		t.Fatalf("non-existent address hint returned")
+	}
+	WriteSnapshotAddressHint(db, hash, addr)
+	if have, ok := ReadSnapshotAddressHint(db, hash); !ok || have != addr {
+		t.Fatalf("address hint mismatch: have %x/%v, want %x/true", have, ok, addr)
+	}
+	// Hints must not be picked up as account snapshot leaves
+	if blob := ReadAccountSnapshot(db, hash); len(blob) != 0 {
+		t.Fatalf("address hint leaked into the account snapshot: %x", blob)
+	}
+}
+
+// Tests that the snapshot trie scheme can be stored and retrieved, and that
+// unknown schemes are rejected.
+func TestSnapshotTrieScheme(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	if _, ok := ReadSnapshotTrieScheme(db); ok {
+		t.Fatalf("non-existent trie scheme returned")
+	}
+	for _, scheme := range []string{SnapshotHashScheme, SnapshotPathScheme} {
+		if err := TryWriteSnapshotTrieScheme(db, scheme); err != nil {
+			t.Fatalf("failed to write trie scheme %q: %v", scheme, err)
+		}
+		if have, ok := ReadSnapshotTrieScheme(db); !ok || have != scheme {
+			t.Fatalf("trie scheme mismatch: have %q/%v, want %q/true", have, ok, scheme)
+		}
+	}
+	if err := TryWriteSnapshotTrieScheme(db, "verkle"); err == nil {
+		t.Fatalf("unknown trie scheme accepted")
+	}
+	if have, _ := ReadSnapshotTrieScheme(db); have != SnapshotPathScheme {
+		t.Fatalf("trie scheme overwritten by rejected write: have %q, want %q", have, SnapshotPathScheme)
+	}
+	// Unknown schemes persisted by other means must not be reported
+	db.Put(snapshotTrieSchemeKey, []byte("verkle"))
+	if _, ok := ReadSnapshotTrieScheme(db); ok {
+		t.Fatalf("unknown persisted trie scheme returned")
+	}
+}
+
+// Tests that the disk layer root is tracked independently of the snapshot root.
+func TestDiskLayerRoot(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	if root := ReadDiskLayerRoot(db); root != (common.Hash{}) {
+		t.Fatalf("non-existent disk layer root returned: %x", root)
+	}
+	WriteDiskLayerRoot(db, common.Hash{0x01})
+	if root := ReadDiskLayerRoot(db); root != (common.Hash{0x01}) {
+		t.Fatalf("disk layer root mismatch: have %x, want %x", root, common.Hash{0x01})
+	}
+	// The head snapshot root may move ahead without touching the disk layer
+	WriteSnapshotRoot(db, common.Hash{0x02})
+	if root := ReadDiskLayerRoot(db); root != (common.Hash{0x01}) {
+		t.Fatalf("disk layer root changed by head root: have %x, want %x", root, common.Hash{0x01})
+	}
+	if root := ReadSnapshotRoot(db); root != (common.Hash{0x02}) {
+		t.Fatalf("head root mismatch: have %x, want %x", root, common.Hash{0x02})
+	}
+	DeleteDiskLayerRoot(db)
+	if root := ReadDiskLayerRoot(db); root != (common.Hash{}) {
+		t.Fatalf("deleted disk layer root returned: %x", root)
+	}
+	if root := ReadSnapshotRoot(db); root != (common.Hash{0x02}) {
+		t.Fatalf("head root deleted with disk layer root")
+	}
+}
+
+// Tests that snapshot generation run identifiers are generated and retrieved.
+func TestSnapshotGenUUID(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	if _, ok := ReadSnapshotGenUUID(db); ok {
+		t.Fatalf("non-existent generator uuid returned")
+	}
+	first := NewSnapshotGenUUID(db)
+	if id, ok := ReadSnapshotGenUUID(db); !ok || id != first {
+		t.Fatalf("generator uuid mismatch: have %s/%v, want %s/true", id, ok, first)
+	}
+	second := NewSnapshotGenUUID(db)
+	if second == first {
+		t.Fatalf("generator uuid reused across runs: %s", first)
+	}
+	if id, _ := ReadSnapshotGenUUID(db); id != second {
+		t.Fatalf("generator uuid not replaced: have %s, want %s", id, second)
+	}
+	// Explicitly set identifiers must round-trip, malformed ones be rejected
+	WriteSnapshotGenUUID(db, "6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	if id, ok := ReadSnapshotGenUUID(db); !ok || id != "6ba7b810-9dad-11d1-80b4-00c04fd430c8" {
+		t.Fatalf("written generator uuid mismatch: have %s/%v", id, ok)
+	}
+	if err := TryWriteSnapshotGenUUID(db, "abc"); err == nil {
+		t.Fatalf("malformed generator uuid accepted")
+	}
+	if id, _ := ReadSnapshotGenUUID(db); id != "6ba7b810-9dad-11d1-80b4-00c04fd430c8" {
+		t.Fatalf("generator uuid overwritten by rejected write: have %s", id)
+	}
+	// Malformed identifiers persisted by other means must not be reported
+	db.Put(snapshotGenUUIDKey, []byte("not-a-uuid"))
+	if _, ok := ReadSnapshotGenUUID(db); ok {
+		t.Fatalf("malformed generator uuid returned")
+	}
+}
+
+// Tests that the snapshot consensus engine can be stored and retrieved, and
+// that unknown engines are rejected.
+func TestSnapshotEngine(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	if _, ok := ReadSnapshotEngine(db); ok {
+		t.Fatalf("non-existent engine returned")
+	}
+	for _, engine := range []string{SnapshotOngashEngine, SnapshotCliqueEngine, SnapshotBeaconEngine} {
+		if err := TryWriteSnapshotEngine(db, engine); err != nil {
+			t.Fatalf("failed to write engine %q: %v", engine, err)
+		}
+		if have, ok := ReadSnapshotEngine(db); !ok || have != engine {
+			t.Fatalf("engine mismatch: have %q/%v, want %q/true", have, ok, engine)
+		}
+	}
+	if err := TryWriteSnapshotEngine(db, "aura"); err == nil {
+		t.Fatalf("unknown engine accepted")
+	}
+	if have, _ := ReadSnapshotEngine(db); have != SnapshotBeaconEngine {
+		t.Fatalf("engine overwritten by rejected write: have %q, want %q", have, SnapshotBeaconEngine)
+	}
+	db.Put(snapshotEngineKey, []byte("aura"))
+	if _, ok := ReadSnapshotEngine(db); ok {
+		t.Fatalf("unknown persisted engine returned")
+	}
+}
+
+// Tests that the existence of snapshot leaves can be checked.
+func TestHasSnapshotLeaves(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	if ok, err := HasAccountSnapshot(db, common.Hash{0x01}); ok || err != nil {
+		t.Fatalf("non-existent account reported: %v/%v", ok, err)
+	}
+	if ok, err := HasStorageSnapshot(db, common.Hash{0x01}, common.Hash{0x02}); ok || err != nil {
+		t.Fatalf("non-existent storage reported: %v/%v", ok, err)
+	}
+	WriteAccountSnapshot(db, common.Hash{0x01}, []byte{0x01})
+	WriteStorageSnapshot(db, common.Hash{0x01}, common.Hash{0x02}, []byte{0x02})
+
+	if ok, err := HasAccountSnapshot(db, common.Hash{0x01}); !ok || err != nil {
+		t.Fatalf("existing account not reported: %v/%v", ok, err)
+	}
+	if ok, err := HasStorageSnapshot(db, common.Hash{0x01}, common.Hash{0x02}); !ok || err != nil {
+		t.Fatalf("existing storage not reported: %v/%v", ok, err)
+	}
+	// The account and storage keyspaces must not be confused
+	if ok, _ := HasStorageSnapshot(db, common.Hash{0x02}, common.Hash{0x01}); ok {
+		t.Fatalf("storage reported for swapped hashes")
+	}
+	db.Close()
+	if _, err := HasAccountSnapshot(db, common.Hash{0x01}); err == nil {
+		t.Fatalf("database error swallowed")
+	}
+}
+
+// failingWriter is a key-value writer that rejects every mutation.
+type failingWriter struct{ err error }
+
+func (w failingWriter) Put(key []byte, value []byte) error { return w.err }
+func (w failingWriter) Delete(key []byte) error            { return w.err }
+
+// Tests that the error-returning snapshot writers surface database failures
+// instead of crashing, and behave like the plain writers on success.
+func TestTrySnapshotWriters(t *testing.T) {
+	fail := failingWriter{err: errors.New("transient")}
+	errs := []error{
+		TryWriteSnapshotRoot(fail, common.Hash{0x01}),
+		TryDeleteSnapshotRoot(fail),
+		TryWriteAccountSnapshot(fail, common.Hash{0x01}, []byte{0x01}),
+		TryDeleteAccountSnapshot(fail, common.Hash{0x01}),
+		TryWriteStorageSnapshot(fail, common.Hash{0x01}, common.Hash{0x02}, []byte{0x01}),
+		TryDeleteStorageSnapshot(fail, common.Hash{0x01}, common.Hash{0x02}),
+		TryWriteSnapshotJournal(fail, []byte{0x01}),
+		TryWriteSnapshotRecoveryNumber(fail, 1),
+		TryWriteSnapshotVersion(fail, 1),
+		TryWriteSnapshotRootTimestamp(fail, 1),
+		TryWriteSnapshotGenWorkers(fail, 1),
+		TryWriteSnapshotNetworkID(fail, 1),
+		TryWriteSnapshotAddressHint(fail, common.Hash{0x01}, common.Address{0x02}),
+		TryWriteSnapshotTrieScheme(fail, SnapshotHashScheme),
+		TryWriteSnapshotEngine(fail, SnapshotBeaconEngine),
+		TryWriteSnapshotGenUUID(fail, "6ba7b810-9dad-11d1-80b4-00c04fd430c8"),
+		TryWriteSnapshotGeneratorProgress(fail, &GeneratorProgress{Done: true}),
+		TryWriteSnapshotExpectedCounts(fail, 1, 2),
+	}
+	for i, err := range errs {
+		if err != fail.err {
+			t.Errorf("writer %d: error mismatch: have %v, want %v", i, err, fail.err)
+		}
+	}
+	db := NewMemoryDatabase()
+	if err := TryWriteSnapshotRoot(db, common.Hash{0x01}); err != nil {
+		t.Fatalf("failed to write snapshot root: %v", err)
+	}
+	if root := ReadSnapshotRoot(db); root != (common.Hash{0x01}) {
+		t.Fatalf("snapshot root mismatch: have %x, want %x", root, common.Hash{0x01})
+	}
+	if err := TryWriteStorageSnapshot(db, common.Hash{0x01}, common.Hash{0x02}, []byte{0x03}); err != nil {
+		t.Fatalf("failed to write storage snapshot: %v", err)
+	}
+	if blob := ReadStorageSnapshot(db, common.Hash{0x01}, common.Hash{0x02}); !reflect.DeepEqual(blob, []byte{0x03}) {
+		t.Fatalf("storage snapshot mismatch: have %x, want %x", blob, []byte{0x03})
+	}
+}
+
+// Tests that the account snapshot iterator walks all account leaves in key order
+// and that the keys can be resolved back into account hashes.
+func TestIterateAccountSnapshots(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	hashes := []common.Hash{{0x01}, {0x02}, {0x03}}
+	for i := len(hashes) - 1; i >= 0; i-- {
+		WriteAccountSnapshot(db, hashes[i], []byte{byte(i)})
+	}
+	WriteStorageSnapshot(db, hashes[0], common.Hash{0x04}, []byte{0x05})
+	db.Put(append(SnapshotAccountPrefix, 0x01), []byte{0x06}) // unrelated key sharing the prefix
+
+	var have []common.Hash
+	it := IterateAccountSnapshots(db)
+	defer it.Release()
+	for it.Next() {
+		hash, ok := AccountSnapshotKeyHash(it.Key())
+		if !ok {
+			continue
+		}
+		have = append(have, hash)
+	}
+	if !reflect.DeepEqual(have, hashes) {
+		t.Fatalf("account hashes mismatch: have %x, want %x", have, hashes)
+	}
+	if _, ok := AccountSnapshotKeyHash(storageSnapshotKey(hashes[0], common.Hash{0x04})); ok {
+		t.Fatalf("storage key resolved as account key")
+	}
+}
+
+// Tests that the persisted snapshot leaves are counted, optionally starting
+// from a checkpointed account hash.
+func TestCountSnapshotLeaves(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	for i := byte(1); i <= 4; i++ {
+		WriteAccountSnapshot(db, common.Hash{i}, []byte{i})
+		for j := byte(1); j <= i; j++ {
+			WriteStorageSnapshot(db, common.Hash{i}, common.Hash{j}, []byte{j})
+		}
+	}
+	WriteSnapshotRoot(db, common.Hash{0xff})
+
+	accounts, storage, err := CountSnapshotLeaves(db)
+	if err != nil {
+		t.Fatalf("failed to count snapshot leaves: %v", err)
+	}
+	if accounts != 4 || storage != 10 {
+		t.Fatalf("leaf count mismatch: have %d/%d, want %d/%d", accounts, storage, 4, 10)
+	}
+	accounts, storage, err = CountSnapshotLeavesFrom(db, common.Hash{0x03})
+	if err != nil {
+		t.Fatalf("failed to count snapshot leaves: %v", err)
+	}
+	if accounts != 2 || storage != 7 {
+		t.Fatalf("resumed leaf count mismatch: have %d/%d, want %d/%d", accounts, storage, 2, 7)
+	}
+}
+
+// Tests that the snapshot root timestamp can be stored and retrieved.
+func TestSnapshotRootTimestamp(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	if _, ok := ReadSnapshotRootTimestamp(db); ok {
+		t.Fatalf("non-existent root timestamp returned")
+	}
+	for _, want := range []uint64{0, 1618000000, ^uint64(0)} {
+		WriteSnapshotRootTimestamp(db, want)
+		if have, ok := ReadSnapshotRootTimestamp(db); !ok || have != want {
+			t.Fatalf("root timestamp mismatch: have %d (%v), want %d", have, ok, want)
+		}
+	}
+	db.Put(snapshotRootTimestampKey, []byte{0x01})
+	if _, ok := ReadSnapshotRootTimestamp(db); ok {
+		t.Fatalf("corrupt root timestamp returned")
+	}
+}
+
+// Tests that ranges of storage snapshot leaves can be retrieved in order, with
+// the remainder correctly reported.
+func TestReadStorageSnapshotRange(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	account := common.Hash{0x01}
+	for i := byte(1); i <= 5; i++ {
+		WriteStorageSnapshot(db, account, common.Hash{i}, []byte{i})
+	}
+	WriteStorageSnapshot(db, common.Hash{0x02}, common.Hash{0x01}, []byte{0xff})
+
+	tests := []struct {
+		start  common.Hash
+		max    int
+		hashes []common.Hash
+		more   bool
+	}{
+		{common.Hash{}, 2, []common.Hash{{0x01}, {0x02}}, true},
+		{common.Hash{0x03}, 2, []common.Hash{{0x03}, {0x04}}, true},
+		{common.Hash{0x04}, 2, []common.Hash{{0x04}, {0x05}}, false},
+		{common.Hash{0x02, 0x01}, 10, []common.Hash{{0x03}, {0x04}, {0x05}}, false},
+		{common.Hash{0x06}, 10, nil, false},
+	}
+	for i, tt := range tests {
+		hashes, values, more, err := ReadStorageSnapshotRange(db, account, tt.start, tt.max)
+		if err != nil {
+			t.Fatalf("test %d: failed to read range: %v", i, err)
+		}
+		if !reflect.DeepEqual(hashes, tt.hashes) || more != tt.more {
+			t.Errorf("test %d: range mismatch: have %x (more %v), want %x (more %v)", i, hashes, more, tt.hashes, tt.more)
+		}
+		for j, hash := range hashes {
+			if !reflect.DeepEqual(values[j], []byte{hash[0]}) {
+				t.Errorf("test %d: value %d mismatch: have %x, want %x", i, j, values[j], []byte{hash[0]})
+			}
+		}
+	}
+	// Non-positive range sizes must be rejected
+	for _, max := range []int{0, -1} {
+		if _, _, _, err := ReadStorageSnapshotRange(db, account, common.Hash{}, max); err == nil {
+			t.Errorf("range size %d accepted", max)
+		}
+	}
+}
+
+// Tests that the snapshot journal is integrity checked on retrieval, while the
+// legacy journals without a header are still accepted.
+func TestSnapshotJournalIntegrity(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	if journal, err := ReadSnapshotJournal(db); journal != nil || err != nil {
+		t.Fatalf("missing journal mismatch: have %x/%v, want nil/nil", journal, err)
+	}
+	payload := []byte{0x80, 0xa0, 0x01, 0x02, 0x03}
+	WriteSnapshotJournal(db, payload)
+	if journal, err := ReadSnapshotJournal(db); err != nil || !reflect.DeepEqual(journal, payload) {
+		t.Fatalf("journal mismatch: have %x/%v, want %x/nil", journal, err, payload)
+	}
+	// Corrupt the payload and truncate the blob, both must be rejected
+	blob, _ := db.Get(snapshotJournalKey)
+
+	corrupt := common.CopyBytes(blob)
+	corrupt[len(corrupt)-1] ^= 0xff
+	db.Put(snapshotJournalKey, corrupt)
+	if journal, err := ReadSnapshotJournal(db); err == nil {
+		t.Fatalf("corrupt journal accepted: %x", journal)
+	}
+	db.Put(snapshotJournalKey, blob[:len(blob)-2])
+	if journal, err := ReadSnapshotJournal(db); err == nil {
+		t.Fatalf("truncated journal accepted: %x", journal)
+	}
+	db.Put(snapshotJournalKey, blob[:3])
+	if journal, err := ReadSnapshotJournal(db); err == nil {
+		t.Fatalf("truncated journal header accepted: %x", journal)
+	}
+	// Legacy journals start with an RLP prefix and must be returned verbatim
+	db.Put(snapshotJournalKey, payload)
+	if journal, err := ReadSnapshotJournal(db); err != nil || !reflect.DeepEqual(journal, payload) {
+		t.Fatalf("legacy journal mismatch: have %x/%v, want %x/nil", journal, err, payload)
+	}
+}
+
+// Tests that snappy compressed journals are decompressed transparently, that
+// uncompressed journals are still read as is and that compression pays off on
+// a realistic journal.
+func TestSnapshotJournalCompression(t *testing.T) {
+	journal := makeTestJournal(16, 256, 16)
+
+	plain := NewMemoryDatabase()
+	WriteSnapshotJournal(plain, journal)
+
+	compressed := NewMemoryDatabase()
+	WriteSnapshotJournalCompressed(compressed, journal)
+
+	for name, db := range map[string]ongdb.KeyValueStore{"plain": plain, "compressed": compressed} {
+		if have, err := ReadSnapshotJournal(db); err != nil || !bytes.Equal(have, journal) {
+			t.Fatalf("%s: journal mismatch: have %d bytes/%v, want %d bytes/nil", name, len(have), err, len(journal))
+		}
+		if layers, err := ValidateSnapshotJournal(db); err != nil || layers != 16 {
+			t.Fatalf("%s: validation mismatch: have %d/%v, want 16/nil", name, layers, err)
+		}
+	}
+	plainBlob, _ := plain.Get(snapshotJournalKey)
+	compressedBlob, _ := compressed.Get(snapshotJournalKey)
+	if len(compressedBlob) >= len(plainBlob) {
+		t.Fatalf("compressed journal not smaller: have %d bytes, uncompressed %d", len(compressedBlob), len(plainBlob))
+	}
+	t.Logf("journal compression ratio: %d / %d bytes = %.2f", len(compressedBlob), len(plainBlob), float64(len(compressedBlob))/float64(len(plainBlob)))
+
+	// Corrupt compressed payloads must be rejected even with a valid header
+	payload := append(common.CopyBytes(snapshotJournalSnappyMagic), 0xff, 0xff, 0xff)
+	writeSnapshotJournalPayload(compressed, payload)
+	if have, err := ReadSnapshotJournal(compressed); err == nil {
+		t.Fatalf("corrupt compressed journal accepted: %x", have)
+	}
+}
+
+// Tests that the snapshot journal stream yields the same content as the journal
+// read in one go, whether compressed or not.
+func TestSnapshotJournalReader(t *testing.T) {
+	db := NewMemoryDatabase()
+	if r, err := ReadSnapshotJournalReader(db); r != nil || err != nil {
+		t.Fatalf("missing journal mismatch: have %v/%v, want nil/nil", r, err)
+	}
+	journal := makeTestJournal(4, 16, 4)
+	for _, write := range []func(ongdb.KeyValueWriter, []byte){WriteSnapshotJournal, WriteSnapshotJournalCompressed} {
+		write(db, journal)
+
+		r, err := ReadSnapshotJournalReader(db)
+		if err != nil {
+			t.Fatalf("failed to open journal stream: %v", err)
+		}
+		if sized, ok := r.(interface{ Size() int64 }); !ok || sized.Size() != int64(len(journal)) {
+			t.Fatalf("journal stream size mismatch: want %d", len(journal))
+		}
+		have, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("failed to read journal stream: %v", err)
+		}
+		if err := r.Close(); err != nil {
+			t.Fatalf("failed to close journal stream: %v", err)
+		}
+		if !bytes.Equal(have, journal) {
+			t.Fatalf("journal stream mismatch: have %d bytes, want %d", len(have), len(journal))
+		}
+	}
+	// Corrupt journals must be rejected before streaming
+	blob, _ := db.Get(snapshotJournalKey)
+	db.Put(snapshotJournalKey, blob[:len(blob)-1])
+	if r, err := ReadSnapshotJournalReader(db); err == nil {
+		t.Fatalf("truncated journal accepted: %v", r)
+	}
+}
+
+// BenchmarkSnapshotJournalCompression measures the cost of storing and loading
+// a realistic snappy compressed journal, reporting the compression ratio.
+func BenchmarkSnapshotJournalCompression(b *testing.B) {
+	var (
+		journal = makeTestJournal(128, 1024, 16)
+		db      = NewMemoryDatabase()
+	)
+	b.SetBytes(int64(len(journal)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		WriteSnapshotJournalCompressed(db, journal)
+		if _, err := ReadSnapshotJournal(db); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+
+	blob, _ := db.Get(snapshotJournalKey)
+	b.ReportMetric(float64(len(blob))/float64(len(journal)), "ratio")
+}
+
+// makeTestJournal assembles a snapshot journal resembling a mainnet one, with
+// the given number of diff layers, each modifying random accounts, a fraction
+// of which with storage changes. Half of the modifications hit a small pool of
+// hot contracts and slots, as popular contracts are touched in most blocks.
+func makeTestJournal(layers, accounts, slots int) []byte {
+	type storage struct {
+		Hash common.Hash
+		Keys []common.Hash
+		Vals [][]byte
+	}
+	var (
+		rng   = rand.New(rand.NewSource(1))
+		blobs = make([][]byte, 0, layers)
+		hash  = func() (h common.Hash) { rng.Read(h[:]); return h }
+
+		hotAccounts = make([]common.Hash, 64)
+		hotSlots    = make([]common.Hash, 256)
+	)
+	for i := range hotAccounts {
+		hotAccounts[i] = hash()
+	}
+	for i := range hotSlots {
+		hotSlots[i] = hash()
+	}
+	for i := 0; i < layers; i++ {
+		var (
+			accs []struct {
+				Hash common.Hash
+				Blob []byte
+			}
+			stors []storage
+		)
+		for j := 0; j < accounts; j++ {
+			var (
+				hot      = j%2 == 0
+				contract = hot || j%8 == 1
+				account  = hash()
+				codeHash = emptyCodeHash
+				root     = types.EmptyRootHash
+			)
+			if hot {
+				account = hotAccounts[rng.Intn(len(hotAccounts))]
+			}
+			if contract {
+				codeHash, root = crypto.Keccak256Hash(account[:]), hash()
+			}
+			balance := new(big.Int).Mul(big.NewInt(rng.Int63n(1000000)), big.NewInt(1e12))
+			accs = append(accs, struct {
+				Hash common.Hash
+				Blob []byte
+			}{account, EncodeAccountSnapshot(uint64(rng.Intn(1000)), balance, codeHash, root)})
+
+			if contract {
+				entry := storage{Hash: account}
+				offset := rng.Intn(len(hotSlots))
+				for k := 0; k < slots; k++ {
+					slot := hash()
+					if hot {
+						slot = hotSlots[(offset+k)%len(hotSlots)]
+					}
+					val, _ := rlp.EncodeToBytes(new(big.Int).SetUint64(uint64(rng.Int63n(1 << 40))).Bytes())
+					entry.Keys, entry.Vals = append(entry.Keys, slot), append(entry.Vals, val)
+				}
+				stors = append(stors, entry)
+			}
+		}
+		buf := new(bytes.Buffer)
+		rlp.Encode(buf, hash())
+		rlp.Encode(buf, []struct{ Hash common.Hash }{})
+		rlp.Encode(buf, accs)
+		rlp.Encode(buf, stors)
+		blobs = append(blobs, buf.Bytes())
+	}
+	journal, err := BuildSnapshotJournal(common.Hash{}, blobs)
+	if err != nil {
+		panic(err)
+	}
+	return journal
+}
+
+// Tests that the snapshot generator progress can be stored and retrieved, and
+// that it's compatible with the raw generator blob layout.
+func TestSnapshotGeneratorProgress(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	if progress, err := ReadSnapshotGeneratorProgress(db); progress != nil || err != nil {
+		t.Fatalf("missing progress mismatch: have %v/%v, want nil/nil", progress, err)
+	}
+	want := &GeneratorProgress{Marker: []byte{0x01, 0x02}, Accounts: 1, Slots: 2, Storage: 3}
+	WriteSnapshotGeneratorProgress(db, want)
+
+	have, err := ReadSnapshotGeneratorProgress(db)
+	if err != nil {
+		t.Fatalf("failed to read progress: %v", err)
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("progress mismatch: have %+v, want %+v", have, want)
+	}
+	// Raw blobs in the generator layout must be decodable
+	blob, _ := rlp.EncodeToBytes([]interface{}{false, true, []byte{}, uint64(4), uint64(5), uint64(6)})
+	WriteSnapshotGenerator(db, blob)
+	if have, err = ReadSnapshotGeneratorProgress(db); err != nil {
+		t.Fatalf("failed to read raw progress: %v", err)
+	}
+	if !have.Done || have.Accounts != 4 || have.Slots != 5 || have.Storage != 6 {
+		t.Fatalf("raw progress mismatch: have %+v", have)
+	}
+	WriteSnapshotGenerator(db, []byte{0x01})
+	if _, err := ReadSnapshotGeneratorProgress(db); err == nil {
+		t.Fatalf("corrupt progress accepted")
+	}
+}
+
+// Tests that the snapshot accessors meter their database accesses when metrics
+// are enabled.
+func TestSnapshotMeters(t *testing.T) {
+	enabled, meters := metrics.Enabled, snapshotMeters
+	defer func() { metrics.Enabled, snapshotMeters = enabled, meters }()
+
+	metrics.Enabled = true
+	registry := metrics.NewRegistry()
+	snapshotMeters = newSnapshotMeterSet(registry)
+
+	db := NewMemoryDatabase()
+	hash := common.HexToHash("0x01")
+	WriteAccountSnapshot(db, hash, []byte{0x01, 0x02, 0x03})
+	WriteAccountSnapshot(db, hash, []byte{0x04})
+	ReadAccountSnapshot(db, hash)
+	ReadAccountSnapshot(db, common.HexToHash("0x02"))
+	DeleteAccountSnapshot(db, hash)
+
+	WriteStorageSnapshot(db, hash, hash, []byte{0x05, 0x06})
+	ReadStorageSnapshot(db, hash, hash)
+
+	WriteSnapshotRoot(db, hash)
+	WriteDiskLayerRoot(db, hash)
+	DeleteSnapshotRoot(db)
+
+	WriteSnapshotVersion(db, 1)
+	ReadSnapshotVersion(db)
+
+	WriteSnapshotRootTimestamp(db, 1)
+	ReadSnapshotRootTimestamp(db)
+	WriteSnapshotGenWorkers(db, 4)
+	ReadSnapshotGenWorkers(db)
+	WriteSnapshotNetworkID(db, 1)
+	WriteSnapshotAddressHint(db, hash, common.Address{})
+	BumpSnapshotFlushGen(db)
+
+	HasStorageSnapshot(db, hash, hash)
+	WriteSnapshotDisabled(db)
+	ReadSnapshotDisabled(db)
+	DeleteSnapshotDisabled(db)
+	NextSnapshotSeq(db)
+	WriteSnapshotExpectedCounts(db, 1, 2)
+	ReadSnapshotExpectedCounts(db)
+	AppendSnapshotWipedAccount(db, hash)
+	WriteSnapshotGenUUID(db, "6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+	ReadSnapshotGenUUID(db)
+
+	tests := []struct {
+		name string
+		want int64
+	}{
+		{"db/snapshot/account/reads", 2},
+		{"db/snapshot/account/reads/bytes", 1},
+		{"db/snapshot/account/writes", 2},
+		{"db/snapshot/account/writes/bytes", 4},
+		{"db/snapshot/account/deletes", 1},
+		{"db/snapshot/storage/reads", 2},
+		{"db/snapshot/storage/reads/bytes", 2},
+		{"db/snapshot/storage/writes", 1},
+		{"db/snapshot/storage/deletes", 0},
+		{"db/snapshot/root/reads", 1},
+		{"db/snapshot/root/writes", 3},
+		{"db/snapshot/root/writes/bytes", 2*common.HashLength + 8},
+		{"db/snapshot/root/deletes", 1},
+		{"db/snapshot/journal/reads", 0},
+		{"db/snapshot/generator/reads", 3},
+		{"db/snapshot/generator/writes", 3},
+		{"db/snapshot/metadata/reads", 5},
+		{"db/snapshot/metadata/writes", 7},
+		{"db/snapshot/metadata/writes/bytes", 4*8 + 16 + 1 + common.AddressLength},
+		{"db/snapshot/metadata/deletes", 1},
+	}
+	for _, tt := range tests {
+		counter, ok := registry.Get(tt.name).(metrics.Counter)
+		if !ok {
+			t.Fatalf("%s: counter not registered", tt.name)
+		}
+		if have := counter.Count(); have != tt.want {
+			t.Errorf("%s: count mismatch: have %d, want %d", tt.name, have, tt.want)
+		}
+	}
+}
+
+// Tests that the exported snapshot key builders address the leaves written by
+// the snapshot accessors.
+func TestSnapshotKeyBuilders(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	account, slot := common.HexToHash("0x01"), common.HexToHash("0x02")
+	WriteAccountSnapshot(db, account, []byte{0x01})
+	WriteStorageSnapshot(db, account, slot, []byte{0x02})
+
+	if data, _ := db.Get(AccountSnapshotKey(account)); !bytes.Equal(data, []byte{0x01}) {
+		t.Errorf("account leaf mismatch: have %x, want %x", data, []byte{0x01})
+	}
+	if data, _ := db.Get(StorageSnapshotKey(account, slot)); !bytes.Equal(data, []byte{0x02}) {
+		t.Errorf("storage leaf mismatch: have %x, want %x", data, []byte{0x02})
+	}
+	if key := StorageSnapshotKey(account, slot); !bytes.HasPrefix(key, StorageSnapshotsKey(account)) {
+		t.Errorf("storage key %x outside of account prefix %x", key, StorageSnapshotsKey(account))
+	}
+}
+
+// Tests that storage snapshots are paged correctly, including at exact page
+// boundaries and when resuming from a returned cursor.
+func TestPageStorageSnapshots(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	account, other := common.HexToHash("0x01"), common.HexToHash("0x02")
+	slots, values, next, err := PageStorageSnapshots(db, account, common.Hash{}, 3)
+	if err != nil || len(slots) != 0 || len(values) != 0 || next != (common.Hash{}) {
+		t.Fatalf("empty account mismatch: have %d slots, next %x, err %v", len(slots), next, err)
+	}
+	var want []common.Hash
+	for i := byte(1); i <= 6; i++ {
+		WriteStorageSnapshot(db, account, common.Hash{i}, []byte{i})
+		WriteStorageSnapshot(db, other, common.Hash{i}, []byte{i})
+		want = append(want, common.Hash{i})
+	}
+	// Page through in various sizes, some of which divide the slot count exactly
+	for _, size := range []int{1, 2, 3, 4, 6, 7} {
+		var (
+			have  []common.Hash
+			start common.Hash
+			pages int
+		)
+		for {
+			slots, values, next, err := PageStorageSnapshots(db, account, start, size)
+			if err != nil {
+				t.Fatalf("page size %d: failed to page storage: %v", size, err)
+			}
+			if len(slots) > size || len(slots) != len(values) {
+				t.Fatalf("page size %d: page length mismatch: %d slots, %d values", size, len(slots), len(values))
+			}
+			for i, slot := range slots {
+				if !bytes.Equal(values[i], []byte{slot[0]}) {
+					t.Errorf("page size %d: slot %x value mismatch: have %x", size, slot, values[i])
+				}
+			}
+			have = append(have, slots...)
+			if pages++; next == (common.Hash{}) {
+				break
+			}
+			start = next
+		}
+		if !reflect.DeepEqual(have, want) {
+			t.Errorf("page size %d: slots mismatch: have %x, want %x", size, have, want)
+		}
+		if wantPages := (len(want) + size - 1) / size; pages != wantPages {
+			t.Errorf("page size %d: page count mismatch: have %d, want %d", size, pages, wantPages)
+		}
+	}
+	if _, _, _, err := PageStorageSnapshots(db, account, common.Hash{}, 0); err == nil {
+		t.Errorf("zero page size accepted")
+	}
+}
+
+// Tests that the snapshot disabled flag defaults to enabled and can be set and
+// cleared.
+func TestSnapshotDisabled(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	if ReadSnapshotDisabled(db) {
+		t.Fatalf("snapshot disabled by default")
+	}
+	WriteSnapshotDisabled(db)
+	if !ReadSnapshotDisabled(db) {
+		t.Fatalf("snapshot not disabled after setting the flag")
+	}
+	if data, _ := db.Get(snapshotDisabledKey); len(data) != 1 {
+		t.Fatalf("disabled flag size mismatch: have %d bytes, want 1", len(data))
+	}
+	DeleteSnapshotDisabled(db)
+	if ReadSnapshotDisabled(db) {
+		t.Fatalf("snapshot disabled after clearing the flag")
+	}
+}
@@ -48,6 +48,15 @@ var (
 	// snapshotRootKey tracks the hash of the last snapshot.
 	snapshotRootKey = []byte("SnapshotRoot")
 
+	// snapshotVersionKey tracks the version of the snapshot on-disk layout.
+	snapshotVersionKey = []byte("SnapshotVersion")
+
+	// snapshotRootTimestampKey tracks the timestamp of the block of the last snapshot.
+	snapshotRootTimestampKey = []byte("SnapshotRootTimestamp")
+
+	// snapshotDiskLayerRootKey tracks the root of the persisted snapshot disk layer.
+	snapshotDiskLayerRootKey = []byte("SnapshotDiskLayerRoot")
+
 	// snapshotJournalKey tracks the in-memory diff layers across restarts.
 	snapshotJournalKey = []byte("SnapshotJournal")
 
@@ -60,6 +69,36 @@ var (
 	// snapshotSyncStatusKey tracks the snapshot sync status across restarts.
 	snapshotSyncStatusKey = []byte("SnapshotSyncStatus")
 
+	// snapshotFlushGenKey tracks the number of disk layer flushes across restarts.
+	snapshotFlushGenKey = []byte("SnapshotFlushGeneration")
+
+	// snapshotWipedAccountsKey tracks the accounts wiped during snapshot generation.
+	snapshotWipedAccountsKey = []byte("SnapshotWipedAccounts")
+
+	// snapshotGenWorkersKey tracks the number of workers generating the snapshot.
+	snapshotGenWorkersKey = []byte("SnapshotGeneratorWorkers")
+
+	// snapshotNetworkIDKey tracks the network id the snapshot belongs to.
+	snapshotNetworkIDKey = []byte("SnapshotNetworkID")
+
+	// snapshotTrieSchemeKey tracks the state trie scheme the snapshot targets.
+	snapshotTrieSchemeKey = []byte("SnapshotTrieScheme")
+
+	// snapshotGenUUIDKey tracks the identifier of the current snapshot generation run.
+	snapshotGenUUIDKey = []byte("SnapshotGeneratorUUID")
+
+	// snapshotEngineKey tracks the consensus engine of the chain the snapshot belongs to.
+	snapshotEngineKey = []byte("SnapshotEngine")
+
+	// snapshotExpectedCountsKey tracks the expected number of account and storage snapshot leaves.
+	snapshotExpectedCountsKey = []byte("SnapshotExpectedCounts")
+
+	// snapshotSeqKey tracks the sequence number of the last snapshot event.
+	snapshotSeqKey = []byte("SnapshotSequence")
+
+	// snapshotDisabledKey flags that the snapshot is disabled by the operator.
+	snapshotDisabledKey = []byte("SnapshotDisabled")
+
 	// txIndexTailKey tracks the oldest block whose transactions have been indexed.
 	txIndexTailKey = []byte("TransactionIndexTail")
 
@@ -87,6 +126,8 @@ var (
 	SnapshotStoragePrefix = []byte("o") // SnapshotStoragePrefix + account hash + storage hash -> storage trie value
 	CodePrefix            = []byte("c") // CodePrefix + code hash -> account code
 
+	snapshotAddressHintPrefix = []byte("snapshot-address-") // snapshotAddressHintPrefix + account hash -> account address
+
 	preimagePrefix = []byte("secure-key-")    // preimagePrefix + hash -> preimage
 	configPrefix   = []byte("orange-config-") // config prefix for the db
 
@@ -194,6 +235,29 @@ func storageSnapshotsKey(accountHash common.Hash) []byte {
 	return append(SnapshotStoragePrefix, accountHash.Bytes()...)
 }
 
+// AccountSnapshotKey returns the database key of an account snapshot leaf, for
+// tools reading the snapshot directly from the database.
+func AccountSnapshotKey(hash common.Hash) []byte {
+	return accountSnapshotKey(hash)
+}
+
+// StorageSnapshotKey returns the database key of a storage snapshot leaf, for
+// tools reading the snapshot directly from the database.
+func StorageSnapshotKey(accountHash, storageHash common.Hash) []byte {
+	return storageSnapshotKey(accountHash, storageHash)
+}
+
+// StorageSnapshotsKey returns the database key prefix shared by all the storage
+// snapshot leaves of an account.
+func StorageSnapshotsKey(accountHash common.Hash) []byte {
+	return storageSnapshotsKey(accountHash)
+}
+
+// snapshotAddressHintKey = snapshotAddressHintPrefix + account hash
+func snapshotAddressHintKey(hash common.Hash) []byte {
+	return append(snapshotAddressHintPrefix, hash.Bytes()...)
+}
+
 // bloomBitsKey = bloomBitsPrefix + bit (uint16 big endian) + section (uint64 big endian) + hash
 func bloomBitsKey(bit uint, section uint64, hash common.Hash) []byte {
 	key := append(append(bloomBitsPrefix, make([]byte, 10)...), hash.Bytes()...)
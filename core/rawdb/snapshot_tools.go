@@ -0,0 +1,1159 @@
+// Copyright 2021 The go-orange Authors
+// This file is part of the go-orange library.
+//
+// The go-orange library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-orange library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-orange library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/ong2020/go-orange/common"
+	"github.com/ong2020/go-orange/common/hexutil"
+	"github.com/ong2020/go-orange/core/types"
+	"github.com/ong2020/go-orange/crypto"
+	"github.com/ong2020/go-orange/ongdb"
+	"github.com/ong2020/go-orange/rlp"
+)
+
+// emptyCodeHash is the known hash of the empty EVM bytecode.
+var emptyCodeHash = crypto.Keccak256Hash(nil)
+
+// snapshotMetadataKeys is the list of all the standalone keys holding snapshot
+// metadata. Any new snapshot metadata key must be added here so that tooling
+// operating on the entire snapshot (clone, diff, etc) picks it up.
+var snapshotMetadataKeys = [][]byte{
+	snapshotRootKey,
+	snapshotVersionKey,
+	snapshotRootTimestampKey,
+	snapshotDiskLayerRootKey,
+	snapshotJournalKey,
+	snapshotGeneratorKey,
+	snapshotRecoveryKey,
+	snapshotSyncStatusKey,
+	snapshotFlushGenKey,
+	snapshotWipedAccountsKey,
+	snapshotGenWorkersKey,
+	snapshotNetworkIDKey,
+	snapshotTrieSchemeKey,
+	snapshotGenUUIDKey,
+	snapshotEngineKey,
+	snapshotExpectedCountsKey,
+	snapshotSeqKey,
+	snapshotDisabledKey,
+}
+
+// readIteratee retrieves a single key from a database which can only be
+// iterated, by iterating over the prefix equal to the key itself.
+func readIteratee(db ongdb.Iteratee, key []byte) ([]byte, bool, error) {
+	it := db.NewIterator(key, nil)
+	defer it.Release()
+
+	if it.Next() && bytes.Equal(it.Key(), key) {
+		return common.CopyBytes(it.Value()), true, it.Error()
+	}
+	return nil, false, it.Error()
+}
+
+// CloneSnapshot copies the entire persisted snapshot, metadata as well as the
+// account and storage leaves, from one database into another, returning the
+// number of account and storage leaves copied.
+func CloneSnapshot(src ongdb.Iteratee, dst ongdb.KeyValueStore) (accounts, storage int, err error) {
+	batch := dst.NewBatch()
+	for _, key := range snapshotMetadataKeys {
+		value, ok, err := readIteratee(src, key)
+		if err != nil {
+			return 0, 0, err
+		}
+		if ok {
+			if err := batch.Put(key, value); err != nil {
+				return 0, 0, err
+			}
+		}
+	}
+	copyLeaves := func(prefix []byte, keylen int) (int, error) {
+		it := src.NewIterator(prefix, nil)
+		defer it.Release()
+
+		var count int
+		for it.Next() {
+			if len(it.Key()) != keylen {
+				continue
+			}
+			if err := batch.Put(it.Key(), it.Value()); err != nil {
+				return count, err
+			}
+			count++
+
+			if batch.ValueSize() > ongdb.IdealBatchSize {
+				if err := batch.Write(); err != nil {
+					return count, err
+				}
+				batch.Reset()
+			}
+		}
+		return count, it.Error()
+	}
+	if accounts, err = copyLeaves(SnapshotAccountPrefix, len(SnapshotAccountPrefix)+common.HashLength); err != nil {
+		return accounts, 0, err
+	}
+	if storage, err = copyLeaves(SnapshotStoragePrefix, len(SnapshotStoragePrefix)+2*common.HashLength); err != nil {
+		return accounts, storage, err
+	}
+	return accounts, storage, batch.Write()
+}
+
+// DiffSnapshots compares the persisted snapshots, metadata as well as account
+// and storage leaves, of two databases and returns the keys whose values differ
+// or which are only present in one of them.
+func DiffSnapshots(a, b ongdb.Iteratee) ([][]byte, error) {
+	var diff [][]byte
+	for _, key := range snapshotMetadataKeys {
+		va, oka, err := readIteratee(a, key)
+		if err != nil {
+			return nil, err
+		}
+		vb, okb, err := readIteratee(b, key)
+		if err != nil {
+			return nil, err
+		}
+		if oka != okb || !bytes.Equal(va, vb) {
+			diff = append(diff, common.CopyBytes(key))
+		}
+	}
+	diffLeaves := func(prefix []byte, keylen int) error {
+		ita, itb := a.NewIterator(prefix, nil), b.NewIterator(prefix, nil)
+		defer ita.Release()
+		defer itb.Release()
+
+		// next advances an iterator to the next leaf, skipping unrelated keys
+		next := func(it ongdb.Iterator) bool {
+			for it.Next() {
+				if len(it.Key()) == keylen {
+					return true
+				}
+			}
+			return false
+		}
+		oka, okb := next(ita), next(itb)
+		for oka || okb {
+			switch {
+			case !okb || (oka && bytes.Compare(ita.Key(), itb.Key()) < 0):
+				diff = append(diff, common.CopyBytes(ita.Key()))
+				oka = next(ita)
+			case !oka || bytes.Compare(ita.Key(), itb.Key()) > 0:
+				diff = append(diff, common.CopyBytes(itb.Key()))
+				okb = next(itb)
+			default:
+				if !bytes.Equal(ita.Value(), itb.Value()) {
+					diff = append(diff, common.CopyBytes(ita.Key()))
+				}
+				oka, okb = next(ita), next(itb)
+			}
+		}
+		if err := ita.Error(); err != nil {
+			return err
+		}
+		return itb.Error()
+	}
+	if err := diffLeaves(SnapshotAccountPrefix, len(SnapshotAccountPrefix)+common.HashLength); err != nil {
+		return nil, err
+	}
+	if err := diffLeaves(SnapshotStoragePrefix, len(SnapshotStoragePrefix)+2*common.HashLength); err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
+
+// snapshotAccount is the RLP layout of an account snapshot leaf. In the slim
+// format the empty storage root and code hash are stored as empty slices, in
+// the legacy (full) format they are stored verbatim.
+type snapshotAccount struct {
+	Nonce    uint64
+	Balance  *big.Int
+	Root     []byte
+	CodeHash []byte
+}
+
+// EncodeAccountSnapshot assembles the slim snapshot leaf of an account from its
+// individual components.
+func EncodeAccountSnapshot(nonce uint64, balance *big.Int, codeHash, storageRoot common.Hash) []byte {
+	account := snapshotAccount{
+		Nonce:   nonce,
+		Balance: balance,
+	}
+	if account.Balance == nil {
+		account.Balance = new(big.Int)
+	}
+	if storageRoot != types.EmptyRootHash {
+		account.Root = storageRoot.Bytes()
+	}
+	if codeHash != emptyCodeHash {
+		account.CodeHash = codeHash.Bytes()
+	}
+	data, err := rlp.EncodeToBytes(account)
+	if err != nil {
+		panic(err) // Can only fail on a negative balance
+	}
+	return data
+}
+
+// DecodeAccountSnapshot splits an account snapshot leaf, either in the slim or
+// in the legacy full format, into its individual components.
+func DecodeAccountSnapshot(data []byte) (nonce uint64, balance *big.Int, codeHash, storageRoot common.Hash, err error) {
+	var account snapshotAccount
+	if err := rlp.DecodeBytes(data, &account); err != nil {
+		return 0, nil, common.Hash{}, common.Hash{}, err
+	}
+	codeHash, storageRoot = emptyCodeHash, types.EmptyRootHash
+	if len(account.CodeHash) > 0 {
+		codeHash = common.BytesToHash(account.CodeHash)
+	}
+	if len(account.Root) > 0 {
+		storageRoot = common.BytesToHash(account.Root)
+	}
+	return account.Nonce, account.Balance, codeHash, storageRoot, nil
+}
+
+// StorageSlot identifies a single storage snapshot leaf by the hash of its
+// owning account and the hash of its slot.
+type StorageSlot struct {
+	Account common.Hash
+	Slot    common.Hash
+}
+
+// ValidateStorageSnapshots iterates over all the storage snapshot leaves and
+// returns the slots whose value is not a valid RLP encoded storage trie value.
+func ValidateStorageSnapshots(db ongdb.Iteratee) ([]StorageSlot, error) {
+	it := db.NewIterator(SnapshotStoragePrefix, nil)
+	defer it.Release()
+
+	var invalid []StorageSlot
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(SnapshotStoragePrefix)+2*common.HashLength {
+			continue
+		}
+		if !validStorageValue(it.Value()) {
+			invalid = append(invalid, StorageSlot{
+				Account: common.BytesToHash(key[len(SnapshotStoragePrefix) : len(SnapshotStoragePrefix)+common.HashLength]),
+				Slot:    common.BytesToHash(key[len(SnapshotStoragePrefix)+common.HashLength:]),
+			})
+		}
+	}
+	return invalid, it.Error()
+}
+
+// validStorageValue reports whether the blob is a storage trie value, i.e. a
+// single RLP string of at most 32 bytes with no trailing data.
+func validStorageValue(blob []byte) bool {
+	var content []byte
+	if err := rlp.DecodeBytes(blob, &content); err != nil {
+		return false
+	}
+	return len(content) <= common.HashLength
+}
+
+// GroupAccountSnapshotsByValue iterates over all the account snapshot leaves and
+// groups the account hashes sharing an identical leaf value. The groups are keyed
+// by the hex encoded keccak256 hash of the shared value and only values shared
+// by at least two accounts are returned.
+func GroupAccountSnapshotsByValue(db ongdb.Iteratee) (map[string][]common.Hash, error) {
+	it := db.NewIterator(SnapshotAccountPrefix, nil)
+	defer it.Release()
+
+	groups := make(map[string][]common.Hash)
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(SnapshotAccountPrefix)+common.HashLength {
+			continue
+		}
+		id := crypto.Keccak256Hash(it.Value()).Hex()
+		groups[id] = append(groups[id], common.BytesToHash(key[len(SnapshotAccountPrefix):]))
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	for id, hashes := range groups {
+		if len(hashes) < 2 {
+			delete(groups, id)
+		}
+	}
+	return groups, nil
+}
+
+// StorageSnapshotHistogram iterates over all the storage snapshot leaves and
+// returns the distribution of storage slot counts, mapping a slot count to the
+// number of accounts having exactly that many slots. Accounts are streamed one
+// by one, so memory use is independent of the state size. Accounts without any
+// storage are not tracked by the storage snapshot and thus not counted.
+func StorageSnapshotHistogram(db ongdb.Iteratee) (map[int]int, error) {
+	it := db.NewIterator(SnapshotStoragePrefix, nil)
+	defer it.Release()
+
+	var (
+		histogram = make(map[int]int)
+		account   []byte
+		slots     int
+	)
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(SnapshotStoragePrefix)+2*common.HashLength {
+			continue
+		}
+		owner := key[len(SnapshotStoragePrefix) : len(SnapshotStoragePrefix)+common.HashLength]
+		if !bytes.Equal(owner, account) {
+			if slots > 0 {
+				histogram[slots]++
+			}
+			account, slots = common.CopyBytes(owner), 0
+		}
+		slots++
+	}
+	if slots > 0 {
+		histogram[slots]++
+	}
+	return histogram, it.Error()
+}
+
+// ForEachStorageSnapshotGlobal iterates over the storage snapshot leaves of all
+// the accounts, invoking the callback with the owning account hash, the slot
+// hash and the leaf value of each. Iteration is aborted on the first error the
+// callback returns. The value is only valid for the duration of the callback.
+func ForEachStorageSnapshotGlobal(db ongdb.Iteratee, fn func(accountHash, storageHash common.Hash, value []byte) error) error {
+	it := db.NewIterator(SnapshotStoragePrefix, nil)
+	defer it.Release()
+
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(SnapshotStoragePrefix)+2*common.HashLength {
+			continue
+		}
+		accountHash := common.BytesToHash(key[len(SnapshotStoragePrefix) : len(SnapshotStoragePrefix)+common.HashLength])
+		storageHash := common.BytesToHash(key[len(SnapshotStoragePrefix)+common.HashLength:])
+		if err := fn(accountHash, storageHash, it.Value()); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+// snapshotJournalVersion is the version of the snapshot journal format which
+// ValidateSnapshotJournal is able to verify.
+const snapshotJournalVersion uint64 = 0
+
+// ValidateSnapshotJournal checks that the persisted snapshot journal decodes
+// correctly, returning the number of diff layers it contains. The layers are
+// decoded one by one and discarded, they are not reconstructed in memory. A
+// missing journal is reported as having no layers.
+func ValidateSnapshotJournal(db ongdb.KeyValueReader) (layers int, err error) {
+	journal, err := ReadSnapshotJournal(db)
+	if err != nil {
+		return 0, err
+	}
+	if len(journal) == 0 {
+		return 0, nil
+	}
+	r := rlp.NewStream(bytes.NewReader(journal), uint64(len(journal)))
+
+	version, err := r.Uint()
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode journal version: %v", err)
+	}
+	if version != snapshotJournalVersion {
+		return 0, fmt.Errorf("unsupported journal version: have %d, want %d", version, snapshotJournalVersion)
+	}
+	var diskRoot common.Hash
+	if err := r.Decode(&diskRoot); err != nil {
+		return 0, fmt.Errorf("failed to decode disk layer root: %v", err)
+	}
+	for {
+		var root common.Hash
+		if err := r.Decode(&root); err != nil {
+			// The root read may fail with EOF, marking the end of the journal
+			if err == io.EOF {
+				return layers, nil
+			}
+			return layers, fmt.Errorf("layer %d: failed to decode root: %v", layers, err)
+		}
+		var destructs []struct {
+			Hash common.Hash
+		}
+		if err := r.Decode(&destructs); err != nil {
+			return layers, fmt.Errorf("layer %d: failed to decode destructs: %v", layers, err)
+		}
+		var accounts []struct {
+			Hash common.Hash
+			Blob []byte
+		}
+		if err := r.Decode(&accounts); err != nil {
+			return layers, fmt.Errorf("layer %d: failed to decode accounts: %v", layers, err)
+		}
+		var storage []struct {
+			Hash common.Hash
+			Keys []common.Hash
+			Vals [][]byte
+		}
+		if err := r.Decode(&storage); err != nil {
+			return layers, fmt.Errorf("layer %d: failed to decode storage: %v", layers, err)
+		}
+		for _, entry := range storage {
+			if len(entry.Keys) != len(entry.Vals) {
+				return layers, fmt.Errorf("layer %d: storage of %x has %d keys but %d values", layers, entry.Hash, len(entry.Keys), len(entry.Vals))
+			}
+		}
+		layers++
+	}
+}
+
+// BuildSnapshotJournal assembles a snapshot journal from the disk layer root and
+// the RLP encoded diff layers, ordered bottom to top. Each layer blob must hold
+// the layer's root, destructs, accounts and storage, in this order, as written
+// by the in-memory diff layers. The result is the journal payload as expected
+// by WriteSnapshotJournal, which adds the integrity framing when storing it.
+func BuildSnapshotJournal(diskRoot common.Hash, layers [][]byte) ([]byte, error) {
+	size := 0
+	for i, layer := range layers {
+		if err := checkJournalLayer(layer); err != nil {
+			return nil, fmt.Errorf("layer %d: %v", i, err)
+		}
+		size += len(layer)
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, size+common.HashLength+2))
+	if err := rlp.Encode(buf, snapshotJournalVersion); err != nil {
+		return nil, err
+	}
+	if err := rlp.Encode(buf, diskRoot); err != nil {
+		return nil, err
+	}
+	for _, layer := range layers {
+		buf.Write(layer)
+	}
+	return buf.Bytes(), nil
+}
+
+// checkJournalLayer checks that a diff layer blob consists of exactly a root hash
+// followed by the destruct, account and storage lists.
+func checkJournalLayer(layer []byte) error {
+	kind, root, rest, err := rlp.Split(layer)
+	if err != nil {
+		return fmt.Errorf("failed to split root: %v", err)
+	}
+	if kind != rlp.String || len(root) != common.HashLength {
+		return errors.New("invalid layer root")
+	}
+	for _, field := range []string{"destructs", "accounts", "storage"} {
+		if kind, _, rest, err = rlp.Split(rest); err != nil {
+			return fmt.Errorf("failed to split %s: %v", field, err)
+		}
+		if kind != rlp.List {
+			return fmt.Errorf("invalid %s list", field)
+		}
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("%d trailing bytes", len(rest))
+	}
+	return nil
+}
+
+// VerifySnapshotRecoveryConsistency checks that the snapshot recovery number is
+// plausible given the number of diff layers in the journal. The recovery number
+// is the disk layer persisted before the head was rewound below it, so it must
+// be above the head block (otherwise the loader ignores it as stale), but still
+// reachable from the head through the journalled layers. If no recovery number
+// is stored there's nothing to check.
+func VerifySnapshotRecoveryConsistency(db ongdb.KeyValueReader) (ok bool, err error) {
+	recovery := ReadSnapshotRecoveryNumber(db)
+	if recovery == nil {
+		return true, nil
+	}
+	layers, err := ValidateSnapshotJournal(db)
+	if err != nil {
+		return false, err
+	}
+	head := ReadHeaderNumber(db, ReadHeadBlockHash(db))
+	if head == nil {
+		return false, errors.New("missing head block")
+	}
+	if *recovery <= *head {
+		return false, nil
+	}
+	return *recovery-*head <= uint64(layers), nil
+}
+
+// EstimateSnapshotPruneSavings iterates over the account and storage snapshot
+// leaves and sums up the size, keys included, of the leaves belonging to the
+// accounts not in the keep set, i.e. the space reclaimable by pruning them.
+func EstimateSnapshotPruneSavings(db ongdb.Iteratee, keep map[common.Hash]struct{}) (bytes uint64, err error) {
+	estimate := func(prefix []byte, keylen int) error {
+		it := db.NewIterator(prefix, nil)
+		defer it.Release()
+
+		for it.Next() {
+			key := it.Key()
+			if len(key) != keylen {
+				continue
+			}
+			account := common.BytesToHash(key[len(prefix) : len(prefix)+common.HashLength])
+			if _, ok := keep[account]; ok {
+				continue
+			}
+			bytes += uint64(len(key) + len(it.Value()))
+		}
+		return it.Error()
+	}
+	if err := estimate(SnapshotAccountPrefix, len(SnapshotAccountPrefix)+common.HashLength); err != nil {
+		return 0, err
+	}
+	if err := estimate(SnapshotStoragePrefix, len(SnapshotStoragePrefix)+2*common.HashLength); err != nil {
+		return 0, err
+	}
+	return bytes, nil
+}
+
+// snapshotExportEntry is a single leaf in a snapshot export stream.
+type snapshotExportEntry struct {
+	Key []byte
+	Val []byte
+}
+
+// ExportSnapshot writes all the account and storage snapshot leaves into the
+// writer as a stream of RLP encoded key-value entries, returning the number of
+// leaves exported.
+func ExportSnapshot(db ongdb.Iteratee, w io.Writer) (int, error) {
+	var exported int
+	export := func(prefix []byte, keylen int) error {
+		it := db.NewIterator(prefix, nil)
+		defer it.Release()
+
+		for it.Next() {
+			if len(it.Key()) != keylen {
+				continue
+			}
+			if err := rlp.Encode(w, snapshotExportEntry{Key: it.Key(), Val: it.Value()}); err != nil {
+				return err
+			}
+			exported++
+		}
+		return it.Error()
+	}
+	if err := export(SnapshotAccountPrefix, len(SnapshotAccountPrefix)+common.HashLength); err != nil {
+		return exported, err
+	}
+	if err := export(SnapshotStoragePrefix, len(SnapshotStoragePrefix)+2*common.HashLength); err != nil {
+		return exported, err
+	}
+	return exported, nil
+}
+
+// VerifiedImportSnapshot replays the snapshot leaves of an export stream into
+// the database, reading each leaf back after writing it to confirm it has been
+// persisted correctly. The import is aborted on the first malformed entry or
+// mismatching leaf, returning the number of leaves imported until then.
+func VerifiedImportSnapshot(db ongdb.KeyValueStore, r io.Reader) (int, error) {
+	stream := rlp.NewStream(r, 0)
+
+	var imported int
+	for {
+		var entry snapshotExportEntry
+		if err := stream.Decode(&entry); err != nil {
+			if err == io.EOF {
+				return imported, nil
+			}
+			return imported, fmt.Errorf("entry %d: failed to decode: %v", imported, err)
+		}
+		switch {
+		case len(entry.Key) == len(SnapshotAccountPrefix)+common.HashLength && bytes.HasPrefix(entry.Key, SnapshotAccountPrefix):
+		case len(entry.Key) == len(SnapshotStoragePrefix)+2*common.HashLength && bytes.HasPrefix(entry.Key, SnapshotStoragePrefix):
+		default:
+			return imported, fmt.Errorf("entry %d: not a snapshot leaf: %x", imported, entry.Key)
+		}
+		if err := db.Put(entry.Key, entry.Val); err != nil {
+			return imported, fmt.Errorf("entry %d: failed to write %x: %v", imported, entry.Key, err)
+		}
+		stored, err := db.Get(entry.Key)
+		if err != nil {
+			return imported, fmt.Errorf("entry %d: failed to read back %x: %v", imported, entry.Key, err)
+		}
+		if !bytes.Equal(stored, entry.Val) {
+			return imported, fmt.Errorf("entry %d: leaf %x mismatch: have %x, want %x", imported, entry.Key, stored, entry.Val)
+		}
+		imported++
+	}
+}
+
+// AccountSnapshotRange is a contiguous range of the account hash keyspace, with
+// both boundaries inclusive.
+type AccountSnapshotRange struct {
+	Start common.Hash
+	End   common.Hash
+}
+
+// ShardAccountSnapshots splits the account snapshot keyspace into the requested
+// number of evenly sized, contiguous ranges which can be iterated independently
+// via ForEachAccountSnapshotInRange. The ranges only depend on the shard count.
+func ShardAccountSnapshots(shards int) []AccountSnapshotRange {
+	if shards <= 0 {
+		return nil
+	}
+	var (
+		space  = new(big.Int).Lsh(common.Big1, 256)
+		ranges = make([]AccountSnapshotRange, shards)
+	)
+	for i := 0; i < shards; i++ {
+		start := new(big.Int).Div(new(big.Int).Mul(space, big.NewInt(int64(i))), big.NewInt(int64(shards)))
+		end := new(big.Int).Div(new(big.Int).Mul(space, big.NewInt(int64(i+1))), big.NewInt(int64(shards)))
+		end.Sub(end, common.Big1)
+
+		ranges[i] = AccountSnapshotRange{
+			Start: common.BigToHash(start),
+			End:   common.BigToHash(end),
+		}
+	}
+	return ranges
+}
+
+// ForEachAccountSnapshotInRange iterates over the account snapshot leaves within
+// the given range, invoking the callback with the account hash and leaf value of
+// each. Iteration is aborted on the first error the callback returns. The value
+// is only valid for the duration of the callback.
+func ForEachAccountSnapshotInRange(db ongdb.Iteratee, r AccountSnapshotRange, fn func(hash common.Hash, value []byte) error) error {
+	it := db.NewIterator(SnapshotAccountPrefix, r.Start.Bytes())
+	defer it.Release()
+
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(SnapshotAccountPrefix)+common.HashLength {
+			continue
+		}
+		hash := common.BytesToHash(key[len(SnapshotAccountPrefix):])
+		if bytes.Compare(hash[:], r.End[:]) > 0 {
+			break
+		}
+		if err := fn(hash, it.Value()); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
+
+// FindMissingStorageLeaves iterates over the storage snapshot leaves of a single
+// account and returns the expected storage hashes, e.g. the ones present in the
+// storage trie, which have no snapshot leaf, retaining their original order.
+func FindMissingStorageLeaves(db ongdb.Iteratee, accountHash common.Hash, expected []common.Hash) ([]common.Hash, error) {
+	it := IterateStorageSnapshots(db, accountHash)
+	defer it.Release()
+
+	present := make(map[common.Hash]struct{})
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(SnapshotStoragePrefix)+2*common.HashLength {
+			continue
+		}
+		present[common.BytesToHash(key[len(SnapshotStoragePrefix)+common.HashLength:])] = struct{}{}
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	var missing []common.Hash
+	for _, hash := range expected {
+		if _, ok := present[hash]; !ok {
+			missing = append(missing, hash)
+		}
+	}
+	return missing, nil
+}
+
+// FindStorageSnapshot iterates over the storage snapshot leaves of a single
+// account in key order and returns the first one accepted by the matcher. The
+// iteration stops at the first match.
+func FindStorageSnapshot(db ongdb.Iteratee, accountHash common.Hash, match func(storageHash common.Hash, value []byte) bool) (common.Hash, []byte, bool, error) {
+	it := IterateStorageSnapshots(db, accountHash)
+	defer it.Release()
+
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(SnapshotStoragePrefix)+2*common.HashLength {
+			continue
+		}
+		storageHash := common.BytesToHash(key[len(SnapshotStoragePrefix)+common.HashLength:])
+		if match(storageHash, it.Value()) {
+			return storageHash, common.CopyBytes(it.Value()), true, nil
+		}
+	}
+	return common.Hash{}, nil, false, it.Error()
+}
+
+// CompactSnapshotKeyspace compacts the key ranges holding the snapshot: the
+// account and storage leaves, the per-account address hints as well as the
+// standalone metadata keys, leaving the rest of the database untouched.
+func CompactSnapshotKeyspace(db ongdb.Compacter) error {
+	// Find the narrowest range covering all the metadata keys
+	start, end := snapshotMetadataKeys[0], snapshotMetadataKeys[0]
+	for _, key := range snapshotMetadataKeys[1:] {
+		if bytes.Compare(key, start) < 0 {
+			start = key
+		}
+		if bytes.Compare(key, end) > 0 {
+			end = key
+		}
+	}
+	ranges := [][2][]byte{
+		{SnapshotAccountPrefix, prefixLimit(SnapshotAccountPrefix)},
+		{SnapshotStoragePrefix, prefixLimit(SnapshotStoragePrefix)},
+		{start, append(common.CopyBytes(end), 0x00)},
+		{snapshotAddressHintPrefix, prefixLimit(snapshotAddressHintPrefix)},
+	}
+	for _, r := range ranges {
+		if err := db.Compact(r[0], r[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// prefixLimit returns the first key not matching the prefix, or nil if there is
+// no such key (i.e. the prefix consists of 0xff bytes only).
+func prefixLimit(prefix []byte) []byte {
+	limit := common.CopyBytes(prefix)
+	for i := len(limit) - 1; i >= 0; i-- {
+		// Bump the current character, stopping if it doesn't overflow
+		limit[i]++
+		if limit[i] > 0 {
+			return limit[:i+1]
+		}
+	}
+	return nil
+}
+
+// AccountBalance is the balance of a single account in the snapshot.
+type AccountBalance struct {
+	Hash    common.Hash
+	Balance *big.Int
+}
+
+// accountBalanceHeap is a min-heap of account balances, the smallest balance
+// (and on ties, the largest hash) being on top.
+type accountBalanceHeap []AccountBalance
+
+func (h accountBalanceHeap) Len() int { return len(h) }
+func (h accountBalanceHeap) Less(i, j int) bool {
+	if cmp := h[i].Balance.Cmp(h[j].Balance); cmp != 0 {
+		return cmp < 0
+	}
+	return bytes.Compare(h[i].Hash[:], h[j].Hash[:]) > 0
+}
+func (h accountBalanceHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *accountBalanceHeap) Push(x interface{}) { *h = append(*h, x.(AccountBalance)) }
+func (h *accountBalanceHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// TopAccountsByBalance streams over all the account snapshot leaves and returns
+// the n accounts with the highest balance, in descending balance order. Accounts
+// with equal balances are ordered by hash. Only n accounts are kept in memory.
+func TopAccountsByBalance(db ongdb.Iteratee, n int) ([]AccountBalance, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	it := db.NewIterator(SnapshotAccountPrefix, nil)
+	defer it.Release()
+
+	top := make(accountBalanceHeap, 0, n)
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(SnapshotAccountPrefix)+common.HashLength {
+			continue
+		}
+		_, balance, _, _, err := DecodeAccountSnapshot(it.Value())
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode account %x: %v", key[len(SnapshotAccountPrefix):], err)
+		}
+		account := AccountBalance{Hash: common.BytesToHash(key[len(SnapshotAccountPrefix):]), Balance: balance}
+		if top.Len() < n {
+			heap.Push(&top, account)
+			continue
+		}
+		// Heap full, replace the smallest balance if the new one is larger. As
+		// accounts are iterated in hash order, equal balances never replace.
+		if account.Balance.Cmp(top[0].Balance) > 0 {
+			top[0] = account
+			heap.Fix(&top, 0)
+		}
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	result := make([]AccountBalance, top.Len())
+	for i := len(result) - 1; i >= 0; i-- {
+		result[i] = heap.Pop(&top).(AccountBalance)
+	}
+	return result, nil
+}
+
+// VerifySnapshotCounts counts the account and storage snapshot leaves and checks
+// them against the expected counts persisted by WriteSnapshotExpectedCounts. The
+// actual counts are returned irrespective of whether they match.
+func VerifySnapshotCounts(db ongdb.Iteratee) (ok bool, gotA, gotS uint64, err error) {
+	blob, found, err := readIteratee(db, snapshotExpectedCountsKey)
+	if err != nil {
+		return false, 0, 0, err
+	}
+	if !found || len(blob) != 16 {
+		return false, 0, 0, errors.New("missing or corrupted expected snapshot counts")
+	}
+	count := func(prefix []byte, keylen int) (uint64, error) {
+		it := db.NewIterator(prefix, nil)
+		defer it.Release()
+
+		var n uint64
+		for it.Next() {
+			if len(it.Key()) == keylen {
+				n++
+			}
+		}
+		return n, it.Error()
+	}
+	if gotA, err = count(SnapshotAccountPrefix, len(SnapshotAccountPrefix)+common.HashLength); err != nil {
+		return false, 0, 0, err
+	}
+	if gotS, err = count(SnapshotStoragePrefix, len(SnapshotStoragePrefix)+2*common.HashLength); err != nil {
+		return false, gotA, 0, err
+	}
+	wantA, wantS := binary.BigEndian.Uint64(blob[:8]), binary.BigEndian.Uint64(blob[8:])
+	return gotA == wantA && gotS == wantS, gotA, gotS, nil
+}
+
+// BuildAccountSnapshotIndex writes the hashes of all the accounts in the snapshot
+// into the writer, in ascending order, as a flat sequence of fixed width 32 byte
+// entries, returning the number of entries written. The index can be binary
+// searched by external tools without any further decoding.
+func BuildAccountSnapshotIndex(db ongdb.Iteratee, w io.Writer) (int, error) {
+	it := db.NewIterator(SnapshotAccountPrefix, nil)
+	defer it.Release()
+
+	var entries int
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(SnapshotAccountPrefix)+common.HashLength {
+			continue
+		}
+		if _, err := w.Write(key[len(SnapshotAccountPrefix):]); err != nil {
+			return entries, err
+		}
+		entries++
+	}
+	return entries, it.Error()
+}
+
+// VerifyMetadataKeyIsolation checks that none of the snapshot metadata keys, nor
+// the auxiliary snapshot prefixes, fall into the account or storage leaf key
+// ranges, which would make them indistinguishable from leaves during iteration.
+func VerifyMetadataKeyIsolation() error {
+	keys := append([][]byte{snapshotAddressHintPrefix}, snapshotMetadataKeys...)
+	return verifyKeyIsolation(keys, [][]byte{SnapshotAccountPrefix, SnapshotStoragePrefix})
+}
+
+// verifyKeyIsolation checks that none of the keys share a prefix with any of the
+// leaf prefixes.
+func verifyKeyIsolation(keys [][]byte, prefixes [][]byte) error {
+	for _, key := range keys {
+		for _, prefix := range prefixes {
+			if bytes.HasPrefix(key, prefix) || bytes.HasPrefix(prefix, key) {
+				return fmt.Errorf("snapshot key %q collides with leaf prefix %q", key, prefix)
+			}
+		}
+	}
+	return nil
+}
+
+// VerifySnapshotConsistency checks that every storage snapshot leaf belongs to
+// an account with a snapshot leaf of its own, returning the hashes of the
+// accounts which have storage leaves but no account leaf, in key order.
+func VerifySnapshotConsistency(db ongdb.Iteratee) ([]common.Hash, error) {
+	it := db.NewIterator(SnapshotStoragePrefix, nil)
+	defer it.Release()
+
+	var (
+		orphans []common.Hash
+		last    common.Hash
+		seen    bool
+	)
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(SnapshotStoragePrefix)+2*common.HashLength {
+			continue
+		}
+		accountHash := common.BytesToHash(key[len(SnapshotStoragePrefix) : len(SnapshotStoragePrefix)+common.HashLength])
+		if seen && accountHash == last {
+			continue
+		}
+		last, seen = accountHash, true
+
+		_, ok, err := readIteratee(db, accountSnapshotKey(accountHash))
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			orphans = append(orphans, accountHash)
+		}
+	}
+	return orphans, it.Error()
+}
+
+// PruneOrphanedStorage deletes all the storage snapshot leaves belonging to
+// accounts without an account snapshot leaf, returning the number of storage
+// leaves deleted.
+func PruneOrphanedStorage(db ongdb.KeyValueStore) (int, error) {
+	orphans, err := VerifySnapshotConsistency(db)
+	if err != nil {
+		return 0, err
+	}
+	var (
+		batch   = db.NewBatch()
+		deleted int
+	)
+	for _, accountHash := range orphans {
+		it := IterateStorageSnapshots(db, accountHash)
+		for it.Next() {
+			key := it.Key()
+			if len(key) != len(SnapshotStoragePrefix)+2*common.HashLength {
+				continue
+			}
+			if err := batch.Delete(common.CopyBytes(key)); err != nil {
+				it.Release()
+				return deleted, err
+			}
+			deleted++
+
+			if batch.ValueSize() >= ongdb.IdealBatchSize {
+				if err := batch.Write(); err != nil {
+					it.Release()
+					return deleted, err
+				}
+				batch.Reset()
+			}
+		}
+		err := it.Error()
+		it.Release()
+		if err != nil {
+			return deleted, err
+		}
+	}
+	if err := batch.Write(); err != nil {
+		return deleted, err
+	}
+	return deleted, nil
+}
+
+// snapshotDeleteBatchKeys is the number of snapshot leaves deleted in a single
+// batch by the bulk deletion helpers.
+const snapshotDeleteBatchKeys = 4096
+
+// DeleteAllSnapshotAccounts deletes all the account snapshot leaves in batches,
+// returning the number of leaves removed. If the context is cancelled, the
+// leaves deleted so far are flushed and the context error returned.
+func DeleteAllSnapshotAccounts(ctx context.Context, db ongdb.KeyValueStore) (int, error) {
+	return deleteSnapshotLeaves(ctx, db, SnapshotAccountPrefix, len(SnapshotAccountPrefix)+common.HashLength)
+}
+
+// DeleteAllStorageSnapshots deletes all the storage snapshot leaves in batches,
+// returning the number of leaves removed. If the context is cancelled, the
+// leaves deleted so far are flushed and the context error returned.
+func DeleteAllStorageSnapshots(ctx context.Context, db ongdb.KeyValueStore) (int, error) {
+	return deleteSnapshotLeaves(ctx, db, SnapshotStoragePrefix, len(SnapshotStoragePrefix)+2*common.HashLength)
+}
+
+// DeleteStorageSnapshotsForAccount deletes all the storage snapshot leaves of a
+// single account in batches, returning the number of leaves removed. It's meant
+// for pruning the storage of self-destructed contracts.
+func DeleteStorageSnapshotsForAccount(db ongdb.KeyValueStore, accountHash common.Hash) (removed int, err error) {
+	return deleteSnapshotLeaves(context.Background(), db, storageSnapshotsKey(accountHash), len(SnapshotStoragePrefix)+2*common.HashLength)
+}
+
+// deleteSnapshotLeaves deletes all the keys of the given length starting with
+// the prefix, flushing the deletions every snapshotDeleteBatchKeys keys.
+func deleteSnapshotLeaves(ctx context.Context, db ongdb.KeyValueStore, prefix []byte, keylen int) (int, error) {
+	it := db.NewIterator(prefix, nil)
+	defer it.Release()
+
+	var (
+		batch   = db.NewBatch()
+		pending int
+		deleted int
+	)
+	flush := func() error {
+		if err := batch.Write(); err != nil {
+			return err
+		}
+		batch.Reset()
+		deleted, pending = deleted+pending, 0
+		return nil
+	}
+	for it.Next() {
+		key := it.Key()
+		if len(key) != keylen {
+			continue
+		}
+		if err := batch.Delete(common.CopyBytes(key)); err != nil {
+			return deleted, err
+		}
+		if pending++; pending >= snapshotDeleteBatchKeys {
+			if err := flush(); err != nil {
+				return deleted, err
+			}
+			select {
+			case <-ctx.Done():
+				return deleted, ctx.Err()
+			default:
+			}
+		}
+	}
+	if err := it.Error(); err != nil {
+		return deleted, err
+	}
+	if err := flush(); err != nil {
+		return deleted, err
+	}
+	return deleted, ctx.Err()
+}
+
+// snapshotStatus is the JSON summary of the persisted snapshot.
+type snapshotStatus struct {
+	Root           common.Hash              `json:"root"`
+	RecoveryNumber *hexutil.Uint64          `json:"recoveryNumber"`
+	JournalSize    int                      `json:"journalSize"`
+	Generator      *snapshotGeneratorStatus `json:"generator"`
+	Accounts       uint64                   `json:"accounts"`
+	Storage        uint64                   `json:"storage"`
+}
+
+// snapshotGeneratorStatus is the JSON summary of the snapshot generator progress.
+type snapshotGeneratorStatus struct {
+	Done     bool          `json:"done"`
+	Marker   hexutil.Bytes `json:"marker"`
+	Accounts uint64        `json:"accounts"`
+	Slots    uint64        `json:"slots"`
+	Storage  uint64        `json:"storage"`
+}
+
+// SnapshotStatusJSON writes a JSON object summarizing the persisted snapshot:
+// its root, recovery number, journal size, generator progress and the number
+// of account and storage leaves. Missing metadata is reported as null.
+func SnapshotStatusJSON(db ongdb.Iteratee, w io.Writer) error {
+	var status snapshotStatus
+
+	blob, ok, err := readIteratee(db, snapshotRootKey)
+	if err != nil {
+		return err
+	}
+	if ok && len(blob) == common.HashLength {
+		status.Root = common.BytesToHash(blob)
+	}
+	if blob, ok, err = readIteratee(db, snapshotRecoveryKey); err != nil {
+		return err
+	}
+	if number := decodeSnapshotRecoveryNumber(blob); ok && number != nil {
+		status.RecoveryNumber = (*hexutil.Uint64)(number)
+	}
+	if blob, _, err = readIteratee(db, snapshotJournalKey); err != nil {
+		return err
+	}
+	status.JournalSize = len(blob)
+
+	if blob, ok, err = readIteratee(db, snapshotGeneratorKey); err != nil {
+		return err
+	}
+	if ok && len(blob) > 0 {
+		var progress GeneratorProgress
+		if err := rlp.DecodeBytes(blob, &progress); err != nil {
+			return fmt.Errorf("failed to decode snapshot generator: %v", err)
+		}
+		status.Generator = &snapshotGeneratorStatus{
+			Done:     progress.Done,
+			Marker:   progress.Marker,
+			Accounts: progress.Accounts,
+			Slots:    progress.Slots,
+			Storage:  progress.Storage,
+		}
+	}
+	if status.Accounts, status.Storage, err = CountSnapshotLeaves(db); err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(status)
+}
+
+// VerifyContractCodePresence iterates over all the account snapshot leaves and
+// returns the hashes of the contract accounts, i.e. those with a non-empty code
+// hash, whose code is not available according to hasCode.
+func VerifyContractCodePresence(db ongdb.Iteratee, hasCode func(codeHash common.Hash) bool) ([]common.Hash, error) {
+	it := db.NewIterator(SnapshotAccountPrefix, nil)
+	defer it.Release()
+
+	var missing []common.Hash
+	for it.Next() {
+		key := it.Key()
+		if len(key) != len(SnapshotAccountPrefix)+common.HashLength {
+			continue
+		}
+		_, _, codeHash, _, err := DecodeAccountSnapshot(it.Value())
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode account %x: %v", key[len(SnapshotAccountPrefix):], err)
+		}
+		if codeHash != emptyCodeHash && !hasCode(codeHash) {
+			missing = append(missing, common.BytesToHash(key[len(SnapshotAccountPrefix):]))
+		}
+	}
+	if err := it.Error(); err != nil {
+		return nil, err
+	}
+	return missing, nil
+}
+
+// SnapshotRootError is returned by VerifySnapshotRoot if the persisted snapshot
+// root is missing or doesn't belong to any known header.
+type SnapshotRootError struct {
+	Root common.Hash // Persisted snapshot root, zero if none was stored
+}
+
+func (e *SnapshotRootError) Error() string {
+	if e.Root == (common.Hash{}) {
+		return "missing snapshot root"
+	}
+	return fmt.Sprintf("snapshot root %x not found in the chain", e.Root)
+}
+
+// VerifySnapshotRoot checks that the persisted snapshot root is set and belongs
+// to a header known to headerLookup. It is meant as a cheap pre-flight check
+// before loading the snapshot, returning a *SnapshotRootError on failure.
+func VerifySnapshotRoot(db ongdb.KeyValueReader, headerLookup func(root common.Hash) bool) error {
+	root := ReadSnapshotRoot(db)
+	if root == (common.Hash{}) || !headerLookup(root) {
+		return &SnapshotRootError{Root: root}
+	}
+	return nil
+}
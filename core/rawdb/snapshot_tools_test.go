@@ -0,0 +1,944 @@
+// Copyright 2021 The go-orange Authors
+// This file is part of the go-orange library.
+//
+// The go-orange library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-orange library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-orange library. If not, see <http://www.gnu.org/licenses/>.
+
+package rawdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ong2020/go-orange/common"
+	"github.com/ong2020/go-orange/core/types"
+	"github.com/ong2020/go-orange/crypto"
+	"github.com/ong2020/go-orange/ongdb"
+	"github.com/ong2020/go-orange/rlp"
+)
+
+// Tests that corrupt storage snapshot values are detected and reported.
+func TestValidateStorageSnapshots(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	valid, _ := rlp.EncodeToBytes(common.Hex2Bytes("deadbeef"))
+	WriteStorageSnapshot(db, common.Hash{0x01}, common.Hash{0x01}, valid)
+	WriteStorageSnapshot(db, common.Hash{0x01}, common.Hash{0x02}, valid)
+	WriteStorageSnapshot(db, common.Hash{0x02}, common.Hash{0x01}, valid)
+
+	// Corrupt one slot with a truncated RLP string header
+	WriteStorageSnapshot(db, common.Hash{0x02}, common.Hash{0x02}, []byte{0x84, 0xde, 0xad})
+
+	invalid, err := ValidateStorageSnapshots(db)
+	if err != nil {
+		t.Fatalf("failed to validate storage snapshots: %v", err)
+	}
+	want := []StorageSlot{{Account: common.Hash{0x02}, Slot: common.Hash{0x02}}}
+	if !reflect.DeepEqual(invalid, want) {
+		t.Fatalf("invalid slots mismatch: have %v, want %v", invalid, want)
+	}
+}
+
+// Tests that account snapshot leaves can be assembled from and split into their
+// individual components.
+func TestAccountSnapshotEncoding(t *testing.T) {
+	tests := []struct {
+		nonce       uint64
+		balance     *big.Int
+		codeHash    common.Hash
+		storageRoot common.Hash
+	}{
+		{0, big.NewInt(0), emptyCodeHash, types.EmptyRootHash},
+		{1, big.NewInt(1000), emptyCodeHash, types.EmptyRootHash},
+		{2, big.NewInt(1000), common.Hash{0xc0, 0xde}, common.Hash{0x5e, 0x70}},
+	}
+	for i, tt := range tests {
+		blob := EncodeAccountSnapshot(tt.nonce, tt.balance, tt.codeHash, tt.storageRoot)
+
+		nonce, balance, codeHash, storageRoot, err := DecodeAccountSnapshot(blob)
+		if err != nil {
+			t.Fatalf("test %d: failed to decode account: %v", i, err)
+		}
+		if nonce != tt.nonce || balance.Cmp(tt.balance) != 0 || codeHash != tt.codeHash || storageRoot != tt.storageRoot {
+			t.Errorf("test %d: account mismatch: have (%d, %v, %x, %x), want (%d, %v, %x, %x)",
+				i, nonce, balance, codeHash, storageRoot, tt.nonce, tt.balance, tt.codeHash, tt.storageRoot)
+		}
+	}
+	// Empty root and code hash must be stripped in the slim format
+	slim, _ := rlp.EncodeToBytes(snapshotAccount{Nonce: 1, Balance: big.NewInt(1)})
+	if blob := EncodeAccountSnapshot(1, big.NewInt(1), emptyCodeHash, types.EmptyRootHash); !reflect.DeepEqual(blob, slim) {
+		t.Errorf("slim encoding mismatch: have %x, want %x", blob, slim)
+	}
+}
+
+// Tests that account snapshot leaves in the legacy full format are decoded.
+func TestAccountSnapshotDecodeLegacy(t *testing.T) {
+	legacy, _ := rlp.EncodeToBytes(snapshotAccount{
+		Nonce:    3,
+		Balance:  big.NewInt(42),
+		Root:     types.EmptyRootHash.Bytes(),
+		CodeHash: emptyCodeHash.Bytes(),
+	})
+	nonce, balance, codeHash, storageRoot, err := DecodeAccountSnapshot(legacy)
+	if err != nil {
+		t.Fatalf("failed to decode legacy account: %v", err)
+	}
+	if nonce != 3 || balance.Cmp(big.NewInt(42)) != 0 || codeHash != emptyCodeHash || storageRoot != types.EmptyRootHash {
+		t.Errorf("legacy account mismatch: have (%d, %v, %x, %x)", nonce, balance, codeHash, storageRoot)
+	}
+}
+
+// Tests that cloning a snapshot copies both metadata and leaves, resulting in
+// an identical snapshot in the destination database.
+func TestCloneSnapshot(t *testing.T) {
+	src := NewMemoryDatabase()
+
+	WriteSnapshotRoot(src, common.Hash{0xaa})
+	WriteSnapshotRecoveryNumber(src, 42)
+	WriteSnapshotGenerator(src, []byte{0x01, 0x02})
+	for i := byte(1); i <= 3; i++ {
+		WriteAccountSnapshot(src, common.Hash{i}, []byte{i})
+		WriteStorageSnapshot(src, common.Hash{i}, common.Hash{i}, []byte{i})
+		WriteStorageSnapshot(src, common.Hash{i}, common.Hash{i + 1}, []byte{i})
+	}
+	// Unrelated data must not be copied
+	src.Put([]byte("unrelated"), []byte{0xff})
+
+	dst := NewMemoryDatabase()
+	accounts, storage, err := CloneSnapshot(src, dst)
+	if err != nil {
+		t.Fatalf("failed to clone snapshot: %v", err)
+	}
+	if accounts != 3 || storage != 6 {
+		t.Fatalf("clone counts mismatch: have %d/%d, want %d/%d", accounts, storage, 3, 6)
+	}
+	diff, err := DiffSnapshots(src, dst)
+	if err != nil {
+		t.Fatalf("failed to diff snapshots: %v", err)
+	}
+	if len(diff) != 0 {
+		t.Fatalf("cloned snapshot differs: %x", diff)
+	}
+	if ok, _ := dst.Has([]byte("unrelated")); ok {
+		t.Fatalf("unrelated data cloned")
+	}
+	// Modify the clone and ensure the diff picks it up
+	WriteAccountSnapshot(dst, common.Hash{0x02}, []byte{0xff})
+	DeleteStorageSnapshot(dst, common.Hash{0x03}, common.Hash{0x04})
+	WriteSnapshotRoot(dst, common.Hash{0xbb})
+
+	diff, err = DiffSnapshots(src, dst)
+	if err != nil {
+		t.Fatalf("failed to diff snapshots: %v", err)
+	}
+	want := [][]byte{
+		snapshotRootKey,
+		accountSnapshotKey(common.Hash{0x02}),
+		storageSnapshotKey(common.Hash{0x03}, common.Hash{0x04}),
+	}
+	if !reflect.DeepEqual(diff, want) {
+		t.Fatalf("snapshot diff mismatch: have %x, want %x", diff, want)
+	}
+}
+
+// Tests that account snapshot leaves with identical values are grouped.
+func TestGroupAccountSnapshotsByValue(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	shared := EncodeAccountSnapshot(0, big.NewInt(100), emptyCodeHash, types.EmptyRootHash)
+	WriteAccountSnapshot(db, common.Hash{0x01}, shared)
+	WriteAccountSnapshot(db, common.Hash{0x02}, EncodeAccountSnapshot(1, big.NewInt(100), emptyCodeHash, types.EmptyRootHash))
+	WriteAccountSnapshot(db, common.Hash{0x03}, shared)
+
+	groups, err := GroupAccountSnapshotsByValue(db)
+	if err != nil {
+		t.Fatalf("failed to group accounts: %v", err)
+	}
+	want := map[string][]common.Hash{
+		crypto.Keccak256Hash(shared).Hex(): {{0x01}, {0x03}},
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Fatalf("account groups mismatch: have %v, want %v", groups, want)
+	}
+}
+
+// Tests that the storage slot count distribution is computed correctly.
+func TestStorageSnapshotHistogram(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	// Two accounts with one slot, one with two and one with five
+	layout := map[byte]int{0x01: 1, 0x02: 2, 0x03: 1, 0x04: 5}
+	for account, slots := range layout {
+		WriteAccountSnapshot(db, common.Hash{account}, []byte{account})
+		for i := 0; i < slots; i++ {
+			WriteStorageSnapshot(db, common.Hash{account}, common.Hash{byte(i)}, []byte{0x01})
+		}
+	}
+	// Accounts without storage must not show up
+	WriteAccountSnapshot(db, common.Hash{0x05}, []byte{0x05})
+
+	histogram, err := StorageSnapshotHistogram(db)
+	if err != nil {
+		t.Fatalf("failed to compute histogram: %v", err)
+	}
+	if want := map[int]int{1: 2, 2: 1, 5: 1}; !reflect.DeepEqual(histogram, want) {
+		t.Fatalf("histogram mismatch: have %v, want %v", histogram, want)
+	}
+}
+
+// Tests that iterating all storage leaves attributes each to its account.
+func TestForEachStorageSnapshotGlobal(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	WriteStorageSnapshot(db, common.Hash{0x01}, common.Hash{0x0a}, []byte{0x01})
+	WriteStorageSnapshot(db, common.Hash{0x01}, common.Hash{0x0b}, []byte{0x02})
+	WriteStorageSnapshot(db, common.Hash{0x02}, common.Hash{0x0a}, []byte{0x03})
+
+	type leaf struct {
+		account, slot common.Hash
+		value         byte
+	}
+	var leaves []leaf
+	err := ForEachStorageSnapshotGlobal(db, func(accountHash, storageHash common.Hash, value []byte) error {
+		leaves = append(leaves, leaf{accountHash, storageHash, value[0]})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to iterate storage: %v", err)
+	}
+	want := []leaf{
+		{common.Hash{0x01}, common.Hash{0x0a}, 0x01},
+		{common.Hash{0x01}, common.Hash{0x0b}, 0x02},
+		{common.Hash{0x02}, common.Hash{0x0a}, 0x03},
+	}
+	if !reflect.DeepEqual(leaves, want) {
+		t.Fatalf("storage leaves mismatch: have %v, want %v", leaves, want)
+	}
+	// Errors returned from the callback must abort the iteration
+	var calls int
+	failure := errors.New("abort")
+	err = ForEachStorageSnapshotGlobal(db, func(accountHash, storageHash common.Hash, value []byte) error {
+		calls++
+		return failure
+	})
+	if err != failure || calls != 1 {
+		t.Fatalf("abort mismatch: have %v after %d calls, want %v after 1", err, calls, failure)
+	}
+}
+
+// Tests that the snapshot journal can be validated without loading it, and that
+// truncated journals are rejected.
+func TestValidateSnapshotJournal(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	// A missing journal has no layers
+	if layers, err := ValidateSnapshotJournal(db); err != nil || layers != 0 {
+		t.Fatalf("missing journal mismatch: have %d/%v, want 0/nil", layers, err)
+	}
+	// Assemble a journal with two diff layers
+	type storage struct {
+		Hash common.Hash
+		Keys []common.Hash
+		Vals [][]byte
+	}
+	buf := new(bytes.Buffer)
+	rlp.Encode(buf, uint64(0))
+	rlp.Encode(buf, common.Hash{0xaa})
+	for i := byte(1); i <= 2; i++ {
+		rlp.Encode(buf, common.Hash{i})
+		rlp.Encode(buf, []struct{ Hash common.Hash }{{common.Hash{0xde, i}}})
+		rlp.Encode(buf, []struct {
+			Hash common.Hash
+			Blob []byte
+		}{{common.Hash{0xac, i}, []byte{i}}})
+		rlp.Encode(buf, []storage{{common.Hash{0xac, i}, []common.Hash{{0x01}}, [][]byte{{i}}}})
+	}
+	journal := buf.Bytes()
+
+	WriteSnapshotJournal(db, journal)
+	if layers, err := ValidateSnapshotJournal(db); err != nil || layers != 2 {
+		t.Fatalf("valid journal mismatch: have %d/%v, want 2/nil", layers, err)
+	}
+	// Truncate the last layer and ensure it's rejected
+	WriteSnapshotJournal(db, journal[:len(journal)-3])
+	if layers, err := ValidateSnapshotJournal(db); err == nil {
+		t.Fatalf("truncated journal accepted with %d layers", layers)
+	} else if layers != 1 {
+		t.Fatalf("truncated journal layer count mismatch: have %d, want 1", layers)
+	}
+}
+
+// Tests that journals assembled from diff layer blobs are accepted by the journal
+// validation, and that malformed layer blobs are rejected.
+func TestBuildSnapshotJournal(t *testing.T) {
+	type storage struct {
+		Hash common.Hash
+		Keys []common.Hash
+		Vals [][]byte
+	}
+	var layers [][]byte
+	for i := byte(1); i <= 3; i++ {
+		buf := new(bytes.Buffer)
+		rlp.Encode(buf, common.Hash{i})
+		rlp.Encode(buf, []struct{ Hash common.Hash }{{common.Hash{0xde, i}}})
+		rlp.Encode(buf, []struct {
+			Hash common.Hash
+			Blob []byte
+		}{{common.Hash{0xac, i}, []byte{i}}})
+		rlp.Encode(buf, []storage{{common.Hash{0xac, i}, []common.Hash{{0x01}}, [][]byte{{i}}}})
+		layers = append(layers, buf.Bytes())
+	}
+	for n := 0; n <= len(layers); n++ {
+		journal, err := BuildSnapshotJournal(common.Hash{0xaa}, layers[:n])
+		if err != nil {
+			t.Fatalf("%d layers: failed to build journal: %v", n, err)
+		}
+		db := NewMemoryDatabase()
+		WriteSnapshotJournal(db, journal)
+		if have, err := ValidateSnapshotJournal(db); err != nil || have != n {
+			t.Fatalf("%d layers: validation mismatch: have %d/%v, want %d/nil", n, have, err, n)
+		}
+	}
+	// Truncated, extended and rootless layers must be rejected
+	for i, layer := range [][]byte{
+		layers[0][:len(layers[0])-1],
+		append(append([]byte{}, layers[0]...), 0x80),
+		layers[0][common.HashLength+1:],
+	} {
+		if _, err := BuildSnapshotJournal(common.Hash{0xaa}, [][]byte{layers[1], layer}); err == nil {
+			t.Errorf("malformed layer %d accepted", i)
+		}
+	}
+}
+
+// Tests that the pruning savings estimate covers the dropped accounts and their
+// storage, but nothing belonging to the retained ones.
+func TestEstimateSnapshotPruneSavings(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	// Kept account with storage, must not be counted
+	WriteAccountSnapshot(db, common.Hash{0x01}, make([]byte, 100))
+	WriteStorageSnapshot(db, common.Hash{0x01}, common.Hash{0x01}, make([]byte, 10))
+
+	// Dropped account with two slots: (33 + 50) + 2 * (65 + 5) = 223
+	WriteAccountSnapshot(db, common.Hash{0x02}, make([]byte, 50))
+	WriteStorageSnapshot(db, common.Hash{0x02}, common.Hash{0x01}, make([]byte, 5))
+	WriteStorageSnapshot(db, common.Hash{0x02}, common.Hash{0x02}, make([]byte, 5))
+
+	// Dropped account without storage: 33 + 20 = 53
+	WriteAccountSnapshot(db, common.Hash{0x03}, make([]byte, 20))
+
+	// Unrelated data must not be counted
+	db.Put([]byte("unrelated"), make([]byte, 1000))
+
+	keep := map[common.Hash]struct{}{{0x01}: {}}
+	savings, err := EstimateSnapshotPruneSavings(db, keep)
+	if err != nil {
+		t.Fatalf("failed to estimate savings: %v", err)
+	}
+	if savings != 276 {
+		t.Fatalf("savings mismatch: have %d, want %d", savings, 276)
+	}
+}
+
+// corruptingStore is a key-value store which corrupts the value of one specific
+// key when writing it.
+type corruptingStore struct {
+	ongdb.KeyValueStore
+	target []byte
+}
+
+func (s *corruptingStore) Put(key []byte, value []byte) error {
+	if bytes.Equal(key, s.target) {
+		value = append(common.CopyBytes(value), 0xff)
+	}
+	return s.KeyValueStore.Put(key, value)
+}
+
+// Tests that snapshot exports can be imported with verification and that any
+// corrupted write aborts the import.
+func TestVerifiedImportSnapshot(t *testing.T) {
+	src := NewMemoryDatabase()
+	for i := byte(1); i <= 3; i++ {
+		WriteAccountSnapshot(src, common.Hash{i}, []byte{i})
+		WriteStorageSnapshot(src, common.Hash{i}, common.Hash{i}, []byte{i})
+	}
+	backup := new(bytes.Buffer)
+	if n, err := ExportSnapshot(src, backup); err != nil || n != 6 {
+		t.Fatalf("export mismatch: have %d/%v, want 6/nil", n, err)
+	}
+	// Import into a healthy database and ensure everything is transferred
+	dst := NewMemoryDatabase()
+	if n, err := VerifiedImportSnapshot(dst, bytes.NewReader(backup.Bytes())); err != nil || n != 6 {
+		t.Fatalf("import mismatch: have %d/%v, want 6/nil", n, err)
+	}
+	if diff, err := DiffSnapshots(src, dst); err != nil || len(diff) != 0 {
+		t.Fatalf("imported snapshot differs: %x (%v)", diff, err)
+	}
+	// Import into a database corrupting the second account and ensure it's caught
+	bad := &corruptingStore{KeyValueStore: NewMemoryDatabase(), target: accountSnapshotKey(common.Hash{0x02})}
+	if n, err := VerifiedImportSnapshot(bad, bytes.NewReader(backup.Bytes())); err == nil {
+		t.Fatalf("corrupted import succeeded")
+	} else if n != 1 {
+		t.Fatalf("corrupted import count mismatch: have %d, want 1", n)
+	}
+	// Truncated streams must be rejected
+	if _, err := VerifiedImportSnapshot(NewMemoryDatabase(), bytes.NewReader(backup.Bytes()[:backup.Len()-1])); err == nil {
+		t.Fatalf("truncated import succeeded")
+	}
+}
+
+// Tests that the account keyspace shards cover it fully without gaps or overlap
+// and that iterating each shard visits every account exactly once.
+func TestShardAccountSnapshots(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	var accounts []common.Hash
+	for i := 0; i < 64; i++ {
+		hash := crypto.Keccak256Hash([]byte{byte(i)})
+		WriteAccountSnapshot(db, hash, []byte{byte(i)})
+		accounts = append(accounts, hash)
+	}
+	// Add accounts right at the shard boundaries
+	for _, hash := range []common.Hash{{}, {0x3f, 0xff}, {0x40}, common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")} {
+		WriteAccountSnapshot(db, hash, []byte{0x01})
+		accounts = append(accounts, hash)
+	}
+	ranges := ShardAccountSnapshots(4)
+	if len(ranges) != 4 {
+		t.Fatalf("shard count mismatch: have %d, want %d", len(ranges), 4)
+	}
+	if ranges[0].Start != (common.Hash{}) {
+		t.Errorf("first shard start mismatch: have %x", ranges[0].Start)
+	}
+	if want := common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"); ranges[3].End != want {
+		t.Errorf("last shard end mismatch: have %x, want %x", ranges[3].End, want)
+	}
+	for i := 1; i < len(ranges); i++ {
+		next := new(big.Int).Add(ranges[i-1].End.Big(), common.Big1)
+		if ranges[i].Start != common.BigToHash(next) {
+			t.Errorf("shard %d: start %x not continuous with previous end %x", i, ranges[i].Start, ranges[i-1].End)
+		}
+	}
+	if want := common.HexToHash("0x4000000000000000000000000000000000000000000000000000000000000000"); ranges[1].Start != want {
+		t.Errorf("second shard start mismatch: have %x, want %x", ranges[1].Start, want)
+	}
+	seen := make(map[common.Hash]int)
+	for _, r := range ranges {
+		err := ForEachAccountSnapshotInRange(db, r, func(hash common.Hash, value []byte) error {
+			seen[hash]++
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("failed to iterate shard: %v", err)
+		}
+	}
+	if len(seen) != len(accounts) {
+		t.Fatalf("visited account count mismatch: have %d, want %d", len(seen), len(accounts))
+	}
+	for _, hash := range accounts {
+		if seen[hash] != 1 {
+			t.Errorf("account %x visited %d times", hash, seen[hash])
+		}
+	}
+}
+
+// Tests that storage slots without a snapshot leaf are detected.
+func TestFindMissingStorageLeaves(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	account := common.Hash{0xaa}
+	WriteStorageSnapshot(db, account, common.Hash{0x01}, []byte{0x01})
+	WriteStorageSnapshot(db, account, common.Hash{0x03}, []byte{0x03})
+
+	// Leaves of other accounts must not mask missing ones
+	WriteStorageSnapshot(db, common.Hash{0xbb}, common.Hash{0x02}, []byte{0x02})
+
+	expected := []common.Hash{{0x04}, {0x01}, {0x02}, {0x03}}
+	missing, err := FindMissingStorageLeaves(db, account, expected)
+	if err != nil {
+		t.Fatalf("failed to find missing leaves: %v", err)
+	}
+	if want := []common.Hash{{0x04}, {0x02}}; !reflect.DeepEqual(missing, want) {
+		t.Fatalf("missing leaves mismatch: have %x, want %x", missing, want)
+	}
+	if missing, _ := FindMissingStorageLeaves(db, account, expected[1:2]); len(missing) != 0 {
+		t.Fatalf("present leaves reported missing: %x", missing)
+	}
+}
+
+// recordingCompacter is a compacter which records the ranges it was asked to
+// compact.
+type recordingCompacter struct {
+	ranges [][2][]byte
+}
+
+func (c *recordingCompacter) Compact(start []byte, limit []byte) error {
+	c.ranges = append(c.ranges, [2][]byte{start, limit})
+	return nil
+}
+
+// Tests that compacting the snapshot keyspace only covers the snapshot ranges.
+func TestCompactSnapshotKeyspace(t *testing.T) {
+	compacter := new(recordingCompacter)
+	if err := CompactSnapshotKeyspace(compacter); err != nil {
+		t.Fatalf("failed to compact snapshot keyspace: %v", err)
+	}
+	if len(compacter.ranges) != 4 {
+		t.Fatalf("compacted range count mismatch: have %d, want %d", len(compacter.ranges), 4)
+	}
+	if have, want := compacter.ranges[0], [2][]byte{[]byte("a"), []byte("b")}; !reflect.DeepEqual(have, want) {
+		t.Errorf("account range mismatch: have %q, want %q", have, want)
+	}
+	if have, want := compacter.ranges[1], [2][]byte{[]byte("o"), []byte("p")}; !reflect.DeepEqual(have, want) {
+		t.Errorf("storage range mismatch: have %q, want %q", have, want)
+	}
+	meta := compacter.ranges[2]
+	for _, key := range snapshotMetadataKeys {
+		if bytes.Compare(key, meta[0]) < 0 || bytes.Compare(key, meta[1]) >= 0 {
+			t.Errorf("metadata key %q outside of compacted range [%q, %q)", key, meta[0], meta[1])
+		}
+	}
+	// The metadata range must not stray into unrelated data
+	for _, key := range [][]byte{[]byte("SecureKey"), []byte("TransactionIndexTail"), headerKey(0, common.Hash{})} {
+		if bytes.Compare(key, meta[0]) >= 0 && bytes.Compare(key, meta[1]) < 0 {
+			t.Errorf("unrelated key %q inside compacted metadata range", key)
+		}
+	}
+	if have, want := compacter.ranges[3], [2][]byte{[]byte("snapshot-address-"), []byte("snapshot-address.")}; !reflect.DeepEqual(have, want) {
+		t.Errorf("address hint range mismatch: have %q, want %q", have, want)
+	}
+	if key := snapshotAddressHintKey(common.Hash{0xff}); bytes.Compare(key, compacter.ranges[3][1]) >= 0 {
+		t.Errorf("address hint key %q outside of compacted range", key)
+	}
+	if have := prefixLimit([]byte{0x01, 0xff}); !bytes.Equal(have, []byte{0x02}) {
+		t.Errorf("prefix limit mismatch: have %x, want %x", have, []byte{0x02})
+	}
+	if have := prefixLimit([]byte{0xff}); have != nil {
+		t.Errorf("prefix limit mismatch: have %x, want nil", have)
+	}
+}
+
+// Tests that the accounts with the highest balances are returned in descending
+// order.
+func TestTopAccountsByBalance(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	balances := map[byte]int64{0x01: 50, 0x02: 1000, 0x03: 7, 0x04: 300, 0x05: 300, 0x06: 0, 0x07: 999}
+	for hash, balance := range balances {
+		WriteAccountSnapshot(db, common.Hash{hash}, EncodeAccountSnapshot(0, big.NewInt(balance), emptyCodeHash, types.EmptyRootHash))
+	}
+	top, err := TopAccountsByBalance(db, 4)
+	if err != nil {
+		t.Fatalf("failed to retrieve top accounts: %v", err)
+	}
+	want := []AccountBalance{
+		{common.Hash{0x02}, big.NewInt(1000)},
+		{common.Hash{0x07}, big.NewInt(999)},
+		{common.Hash{0x04}, big.NewInt(300)},
+		{common.Hash{0x05}, big.NewInt(300)},
+	}
+	if !reflect.DeepEqual(top, want) {
+		t.Fatalf("top accounts mismatch: have %v, want %v", top, want)
+	}
+	// Requesting more accounts than available must return all of them
+	if all, err := TopAccountsByBalance(db, 100); err != nil || len(all) != len(balances) {
+		t.Fatalf("full rich-list mismatch: have %d (%v), want %d", len(all), err, len(balances))
+	}
+	// Undecodable leaves must be reported
+	WriteAccountSnapshot(db, common.Hash{0x08}, []byte{0xff})
+	if _, err := TopAccountsByBalance(db, 4); err == nil {
+		t.Fatalf("corrupt account leaf accepted")
+	}
+}
+
+// Tests that snapshot leaf counts are verified against the expected counts and
+// that losing a leaf is detected.
+func TestVerifySnapshotCounts(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	if _, _, _, err := VerifySnapshotCounts(db); err == nil {
+		t.Fatalf("verification succeeded without expected counts")
+	}
+	for i := byte(1); i <= 3; i++ {
+		WriteAccountSnapshot(db, common.Hash{i}, []byte{i})
+		WriteStorageSnapshot(db, common.Hash{i}, common.Hash{i}, []byte{i})
+		WriteStorageSnapshot(db, common.Hash{i}, common.Hash{i + 1}, []byte{i})
+	}
+	WriteSnapshotExpectedCounts(db, 3, 6)
+	if accounts, storage, ok := ReadSnapshotExpectedCounts(db); !ok || accounts != 3 || storage != 6 {
+		t.Fatalf("expected counts mismatch: have %d/%d/%v, want 3/6/true", accounts, storage, ok)
+	}
+	ok, accounts, storage, err := VerifySnapshotCounts(db)
+	if err != nil || !ok || accounts != 3 || storage != 6 {
+		t.Fatalf("intact snapshot verification mismatch: have %v/%d/%d/%v, want true/3/6/nil", ok, accounts, storage, err)
+	}
+	DeleteStorageSnapshot(db, common.Hash{0x02}, common.Hash{0x03})
+	ok, accounts, storage, err = VerifySnapshotCounts(db)
+	if err != nil || ok || accounts != 3 || storage != 5 {
+		t.Fatalf("damaged snapshot verification mismatch: have %v/%d/%d/%v, want false/3/5/nil", ok, accounts, storage, err)
+	}
+}
+
+// Tests that the account index contains every account hash exactly once and is
+// sorted.
+func TestBuildAccountSnapshotIndex(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	accounts := make(map[common.Hash]bool)
+	for i := 0; i < 100; i++ {
+		hash := crypto.Keccak256Hash([]byte{byte(i)})
+		WriteAccountSnapshot(db, hash, []byte{byte(i)})
+		accounts[hash] = true
+	}
+	// Storage leaves and unrelated keys must not be indexed
+	WriteStorageSnapshot(db, common.Hash{0x01}, common.Hash{0x01}, []byte{0x01})
+	db.Put(append(common.CopyBytes(SnapshotAccountPrefix), 0x01), []byte{0x01})
+
+	index := new(bytes.Buffer)
+	n, err := BuildAccountSnapshotIndex(db, index)
+	if err != nil {
+		t.Fatalf("failed to build index: %v", err)
+	}
+	if n != len(accounts) || index.Len() != len(accounts)*common.HashLength {
+		t.Fatalf("index size mismatch: have %d entries/%d bytes, want %d entries", n, index.Len(), len(accounts))
+	}
+	blob := index.Bytes()
+	for i := 0; i < n; i++ {
+		entry := blob[i*common.HashLength : (i+1)*common.HashLength]
+		if !accounts[common.BytesToHash(entry)] {
+			t.Fatalf("entry %d: unknown or duplicate account %x", i, entry)
+		}
+		accounts[common.BytesToHash(entry)] = false
+
+		if i > 0 && bytes.Compare(blob[(i-1)*common.HashLength:i*common.HashLength], entry) >= 0 {
+			t.Fatalf("entry %d: index not sorted", i)
+		}
+	}
+}
+
+// Tests that the snapshot metadata keys are isolated from the leaf keyspace and
+// that a colliding key would be detected.
+func TestVerifyMetadataKeyIsolation(t *testing.T) {
+	if err := VerifyMetadataKeyIsolation(); err != nil {
+		t.Fatalf("current key layout collides: %v", err)
+	}
+	prefixes := [][]byte{SnapshotAccountPrefix, SnapshotStoragePrefix}
+	for _, key := range [][]byte{[]byte("accountSnapshotMeta"), []byte("o"), {}} {
+		keys := append([][]byte{snapshotRootKey}, key)
+		if err := verifyKeyIsolation(keys, prefixes); err == nil {
+			t.Errorf("colliding key %q not detected", key)
+		}
+	}
+}
+
+// Tests that storage leaves of accounts without an account leaf are detected
+// and pruned, while the storage of live accounts is retained.
+func TestPruneOrphanedStorage(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	live, orphan := common.Hash{0x01}, common.Hash{0x02}
+	WriteAccountSnapshot(db, live, []byte{0x01})
+	for i := byte(1); i <= 3; i++ {
+		WriteStorageSnapshot(db, live, common.Hash{i}, []byte{i})
+		WriteStorageSnapshot(db, orphan, common.Hash{i}, []byte{i})
+	}
+	orphans, err := VerifySnapshotConsistency(db)
+	if err != nil {
+		t.Fatalf("failed to verify snapshot consistency: %v", err)
+	}
+	if !reflect.DeepEqual(orphans, []common.Hash{orphan}) {
+		t.Fatalf("orphans mismatch: have %x, want %x", orphans, []common.Hash{orphan})
+	}
+	deleted, err := PruneOrphanedStorage(db)
+	if err != nil {
+		t.Fatalf("failed to prune orphaned storage: %v", err)
+	}
+	if deleted != 3 {
+		t.Fatalf("deleted leaves mismatch: have %d, want %d", deleted, 3)
+	}
+	for i := byte(1); i <= 3; i++ {
+		if blob := ReadStorageSnapshot(db, orphan, common.Hash{i}); len(blob) != 0 {
+			t.Errorf("orphaned storage slot %d not pruned", i)
+		}
+		if blob := ReadStorageSnapshot(db, live, common.Hash{i}); !bytes.Equal(blob, []byte{i}) {
+			t.Errorf("live storage slot %d mismatch: have %x, want %x", i, blob, []byte{i})
+		}
+	}
+	if orphans, _ := VerifySnapshotConsistency(db); len(orphans) != 0 {
+		t.Fatalf("orphans left after pruning: %x", orphans)
+	}
+}
+
+// Tests that the account and storage leaves are bulk deleted, leaving unrelated
+// keys alone, and that the deletion can be aborted.
+func TestDeleteAllSnapshotLeaves(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	leaves := snapshotDeleteBatchKeys + 10
+	for i := 0; i < leaves; i++ {
+		hash := common.BigToHash(big.NewInt(int64(i)))
+		WriteAccountSnapshot(db, hash, []byte{0x01})
+		WriteStorageSnapshot(db, hash, hash, []byte{0x02})
+	}
+	WriteSnapshotRoot(db, common.Hash{0x01})
+
+	// Aborted deletions must stop after the first batch
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	deleted, err := DeleteAllSnapshotAccounts(ctx, db)
+	if err != context.Canceled {
+		t.Fatalf("cancelled deletion error mismatch: have %v, want %v", err, context.Canceled)
+	}
+	if deleted != snapshotDeleteBatchKeys {
+		t.Fatalf("cancelled deletion count mismatch: have %d, want %d", deleted, snapshotDeleteBatchKeys)
+	}
+	// Full deletions must remove all the remaining leaves
+	if deleted, err = DeleteAllSnapshotAccounts(context.Background(), db); err != nil {
+		t.Fatalf("failed to delete accounts: %v", err)
+	}
+	if deleted != 10 {
+		t.Fatalf("account deletion count mismatch: have %d, want %d", deleted, 10)
+	}
+	if deleted, err = DeleteAllStorageSnapshots(context.Background(), db); err != nil {
+		t.Fatalf("failed to delete storage: %v", err)
+	}
+	if deleted != leaves {
+		t.Fatalf("storage deletion count mismatch: have %d, want %d", deleted, leaves)
+	}
+	if accounts, storage, _ := CountSnapshotLeaves(db); accounts != 0 || storage != 0 {
+		t.Fatalf("leaves left after deletion: %d/%d", accounts, storage)
+	}
+	if root := ReadSnapshotRoot(db); root != (common.Hash{0x01}) {
+		t.Fatalf("snapshot root deleted")
+	}
+}
+
+// Tests that the first storage leaf accepted by the matcher is found and that
+// the iteration stops there.
+func TestFindStorageSnapshot(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	account := common.Hash{0x01}
+	for i := byte(1); i <= 5; i++ {
+		WriteStorageSnapshot(db, account, common.Hash{i}, []byte{i % 2})
+	}
+	WriteStorageSnapshot(db, common.Hash{0x00}, common.Hash{0x01}, []byte{0x00})
+
+	var visited int
+	hash, value, ok, err := FindStorageSnapshot(db, account, func(storageHash common.Hash, value []byte) bool {
+		visited++
+		return storageHash[0] > 1 && value[0] == 1
+	})
+	if err != nil || !ok {
+		t.Fatalf("failed to find storage slot: %v/%v", ok, err)
+	}
+	if hash != (common.Hash{0x03}) || !bytes.Equal(value, []byte{0x01}) {
+		t.Fatalf("found slot mismatch: have %x=%x, want %x=%x", hash, value, common.Hash{0x03}, []byte{0x01})
+	}
+	if visited != 3 {
+		t.Fatalf("visited slots mismatch: have %d, want %d", visited, 3)
+	}
+	if _, _, ok, err := FindStorageSnapshot(db, account, func(common.Hash, []byte) bool { return false }); ok || err != nil {
+		t.Fatalf("unmatched search mismatch: have %v/%v, want false/nil", ok, err)
+	}
+}
+
+// Tests that the snapshot status is summarized into the expected JSON object.
+func TestSnapshotStatusJSON(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	// An empty database must report an empty status
+	buf := new(bytes.Buffer)
+	if err := SnapshotStatusJSON(db, buf); err != nil {
+		t.Fatalf("failed to dump empty status: %v", err)
+	}
+	var status map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &status); err != nil {
+		t.Fatalf("failed to parse empty status: %v", err)
+	}
+	if status["recoveryNumber"] != nil || status["generator"] != nil || status["accounts"] != 0.0 {
+		t.Fatalf("empty status mismatch: %v", status)
+	}
+	// Populate a synthetic snapshot and check all the fields
+	WriteSnapshotRoot(db, common.Hash{0x01})
+	WriteSnapshotRecoveryNumber(db, 16)
+	WriteSnapshotJournal(db, []byte{0x01, 0x02})
+	WriteSnapshotGeneratorProgress(db, &GeneratorProgress{Marker: []byte{0xaa}, Accounts: 2, Slots: 3, Storage: 4})
+	WriteAccountSnapshot(db, common.Hash{0x01}, []byte{0x01})
+	WriteAccountSnapshot(db, common.Hash{0x02}, []byte{0x02})
+	WriteStorageSnapshot(db, common.Hash{0x01}, common.Hash{0x01}, []byte{0x01})
+
+	buf.Reset()
+	if err := SnapshotStatusJSON(db, buf); err != nil {
+		t.Fatalf("failed to dump status: %v", err)
+	}
+	status = nil
+	if err := json.Unmarshal(buf.Bytes(), &status); err != nil {
+		t.Fatalf("failed to parse status: %v", err)
+	}
+	want := map[string]interface{}{
+		"root":           common.Hash{0x01}.Hex(),
+		"recoveryNumber": "0x10",
+		"journalSize":    10.0,
+		"generator": map[string]interface{}{
+			"done":     false,
+			"marker":   "0xaa",
+			"accounts": 2.0,
+			"slots":    3.0,
+			"storage":  4.0,
+		},
+		"accounts": 2.0,
+		"storage":  1.0,
+	}
+	if !reflect.DeepEqual(status, want) {
+		t.Fatalf("status mismatch:\nhave %v\nwant %v", status, want)
+	}
+}
+
+// Tests that the snapshot recovery number is checked against the head block and
+// the number of journalled diff layers, accepting only disk layers above the head
+// which are reachable through the journal.
+func TestVerifySnapshotRecoveryConsistency(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	// Without a recovery number there's nothing to verify
+	if ok, err := VerifySnapshotRecoveryConsistency(db); !ok || err != nil {
+		t.Fatalf("missing recovery number mismatch: have %v/%v, want true/nil", ok, err)
+	}
+	// Journal two diff layers on top of the disk layer, with the head rewound to 100
+	buf := new(bytes.Buffer)
+	rlp.Encode(buf, uint64(0))
+	rlp.Encode(buf, common.Hash{0xaa})
+	for i := byte(1); i <= 2; i++ {
+		rlp.Encode(buf, common.Hash{i})
+		rlp.Encode(buf, []struct{ Hash common.Hash }{})
+		rlp.Encode(buf, []struct {
+			Hash common.Hash
+			Blob []byte
+		}{})
+		rlp.Encode(buf, []struct {
+			Hash common.Hash
+			Keys []common.Hash
+			Vals [][]byte
+		}{})
+	}
+	WriteSnapshotJournal(db, buf.Bytes())
+
+	head := common.Hash{0xff}
+	WriteHeaderNumber(db, head, 100)
+	WriteHeadBlockHash(db, head)
+
+	for _, tt := range []struct {
+		recovery uint64
+		ok       bool
+	}{
+		{101, true},
+		{102, true},
+		{103, false},
+		{100, false},
+		{98, false},
+	} {
+		WriteSnapshotRecoveryNumber(db, tt.recovery)
+		if ok, err := VerifySnapshotRecoveryConsistency(db); err != nil || ok != tt.ok {
+			t.Errorf("recovery %d: consistency mismatch: have %v/%v, want %v/nil", tt.recovery, ok, err, tt.ok)
+		}
+	}
+}
+
+// Tests that contract accounts whose code is missing from the code store are
+// detected, while plain accounts and contracts with code are not reported.
+func TestVerifyContractCodePresence(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	var (
+		code    = []byte{0x60, 0x00}
+		present = crypto.Keccak256Hash(code)
+		absent  = crypto.Keccak256Hash([]byte{0x60, 0x01})
+	)
+	WriteCode(db, present, code)
+
+	WriteAccountSnapshot(db, common.Hash{0x01}, EncodeAccountSnapshot(0, big.NewInt(1), emptyCodeHash, types.EmptyRootHash))
+	WriteAccountSnapshot(db, common.Hash{0x02}, EncodeAccountSnapshot(1, big.NewInt(0), present, types.EmptyRootHash))
+	WriteAccountSnapshot(db, common.Hash{0x03}, EncodeAccountSnapshot(1, big.NewInt(0), absent, types.EmptyRootHash))
+
+	// Storage leaves sharing the account prefix length must be skipped
+	WriteStorageSnapshot(db, common.Hash{0x03}, common.Hash{0x01}, []byte{0x01})
+
+	hasCode := func(hash common.Hash) bool { return len(ReadCode(db, hash)) > 0 }
+	missing, err := VerifyContractCodePresence(db, hasCode)
+	if err != nil {
+		t.Fatalf("failed to verify code presence: %v", err)
+	}
+	if want := []common.Hash{{0x03}}; !reflect.DeepEqual(missing, want) {
+		t.Fatalf("missing code mismatch: have %x, want %x", missing, want)
+	}
+	// Undecodable leaves must be reported
+	WriteAccountSnapshot(db, common.Hash{0x04}, []byte{0xff})
+	if _, err := VerifyContractCodePresence(db, hasCode); err == nil {
+		t.Fatalf("corrupt account leaf accepted")
+	}
+}
+
+// Tests that the snapshot root pre-flight check rejects missing and unknown roots.
+func TestVerifySnapshotRoot(t *testing.T) {
+	known := common.HexToHash("0x01")
+	lookup := func(root common.Hash) bool { return root == known }
+
+	db := NewMemoryDatabase()
+	err := VerifySnapshotRoot(db, lookup)
+	if rerr, ok := err.(*SnapshotRootError); !ok || rerr.Root != (common.Hash{}) {
+		t.Fatalf("missing root error mismatch: have %v", err)
+	}
+	WriteSnapshotRoot(db, common.HexToHash("0x02"))
+	err = VerifySnapshotRoot(db, lookup)
+	if rerr, ok := err.(*SnapshotRootError); !ok || rerr.Root != common.HexToHash("0x02") {
+		t.Fatalf("unknown root error mismatch: have %v", err)
+	}
+	WriteSnapshotRoot(db, known)
+	if err := VerifySnapshotRoot(db, lookup); err != nil {
+		t.Fatalf("known root rejected: %v", err)
+	}
+}
+
+// Tests that deleting the storage snapshot of an account leaves the storage of
+// other accounts untouched.
+func TestDeleteStorageSnapshotsForAccount(t *testing.T) {
+	db := NewMemoryDatabase()
+
+	target, other := common.HexToHash("0x01"), common.HexToHash("0x02")
+	for i := byte(0); i < 10; i++ {
+		WriteStorageSnapshot(db, target, common.Hash{i}, []byte{i + 1})
+		WriteStorageSnapshot(db, other, common.Hash{i}, []byte{i + 1})
+	}
+	removed, err := DeleteStorageSnapshotsForAccount(db, target)
+	if err != nil {
+		t.Fatalf("failed to delete storage snapshot: %v", err)
+	}
+	if removed != 10 {
+		t.Fatalf("removed slot count mismatch: have %d, want %d", removed, 10)
+	}
+	for i := byte(0); i < 10; i++ {
+		if data := ReadStorageSnapshot(db, target, common.Hash{i}); len(data) != 0 {
+			t.Errorf("target slot %d not deleted", i)
+		}
+		if data := ReadStorageSnapshot(db, other, common.Hash{i}); !bytes.Equal(data, []byte{i + 1}) {
+			t.Errorf("other slot %d mismatch: have %x, want %x", i, data, []byte{i + 1})
+		}
+	}
+}
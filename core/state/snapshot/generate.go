@@ -107,6 +107,7 @@ func generateSnapshot(diskdb ongdb.KeyValueStore, triedb *trie.Database, cache i
 		genMarker = []byte{} // Initialized but empty!
 	)
 	rawdb.WriteSnapshotRoot(batch, root)
+	rawdb.WriteSnapshotVersion(batch, snapshotVersion)
 	journalProgress(batch, genMarker, stats)
 	if err := batch.Write(); err != nil {
 		log.Crit("Failed to write initialized state marker", "error", err)
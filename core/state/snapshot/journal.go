@@ -35,6 +35,22 @@ import (
 
 const journalVersion uint64 = 0
 
+// snapshotVersion is the version of the on-disk snapshot layout. It must be
+// bumped whenever the persisted account or storage leaves change format, so
+// that older binaries refuse to load the snapshot instead of misreading it.
+const snapshotVersion uint64 = 1
+
+// VersionMismatchError is returned when loading a persisted snapshot whose
+// on-disk layout version differs from the one supported by this binary.
+type VersionMismatchError struct {
+	Stored   uint64 // Layout version of the persisted snapshot
+	Expected uint64 // Layout version supported by this binary
+}
+
+func (e *VersionMismatchError) Error() string {
+	return fmt.Sprintf("snapshot version mismatch: have %d, want %d", e.Stored, e.Expected)
+}
+
 // journalGenerator is a disk layer entry containing the generator progress marker.
 type journalGenerator struct {
 	Wiping   bool // Whonger the database was in progress of being wiped
@@ -63,16 +79,31 @@ type journalStorage struct {
 	Vals [][]byte
 }
 
+// newJournalStream wraps a snapshot journal into an RLP stream. If the journal
+// knows its size, the stream is bounded by it, so that a corrupt length prefix
+// can't trigger an oversized allocation.
+func newJournalStream(journal io.Reader) *rlp.Stream {
+	var limit uint64
+	if sized, ok := journal.(interface{ Size() int64 }); ok {
+		limit = uint64(sized.Size())
+	}
+	return rlp.NewStream(journal, limit)
+}
+
 // loadAndParseLegacyJournal tries to parse the snapshot journal in legacy format.
 func loadAndParseLegacyJournal(db ongdb.KeyValueStore, base *diskLayer) (snapshot, journalGenerator, error) {
 	// Retrieve the journal, for legacy journal it must exist since even for
 	// 0 layer it stores whonger we've already generated the snapshot or are
 	// in progress only.
-	journal := rawdb.ReadSnapshotJournal(db)
-	if len(journal) == 0 {
+	journal, err := rawdb.ReadSnapshotJournalReader(db)
+	if err != nil {
+		return nil, journalGenerator{}, err
+	}
+	if journal == nil {
 		return nil, journalGenerator{}, errors.New("missing or corrupted snapshot journal")
 	}
-	r := rlp.NewStream(bytes.NewReader(journal), 0)
+	defer journal.Close()
+	r := newJournalStream(journal)
 
 	// Read the snapshot generation progress for the disk layer
 	var generator journalGenerator
@@ -106,12 +137,17 @@ func loadAndParseJournal(db ongdb.KeyValueStore, base *diskLayer) (snapshot, jou
 	// So if there is no journal, or the journal is invalid(e.g. the journal
 	// is not matched with disk layer; or the it's the legacy-format journal,
 	// etc.), we just discard all diffs and try to recover them later.
-	journal := rawdb.ReadSnapshotJournal(db)
-	if len(journal) == 0 {
+	journal, err := rawdb.ReadSnapshotJournalReader(db)
+	if err != nil {
+		log.Warn("Failed to read the snapshot journal", "error", err)
+		return base, generator, nil
+	}
+	if journal == nil {
 		log.Warn("Loaded snapshot journal", "diskroot", base.root, "diffs", "missing")
 		return base, generator, nil
 	}
-	r := rlp.NewStream(bytes.NewReader(journal), 0)
+	defer journal.Close()
+	r := newJournalStream(journal)
 
 	// Firstly, resolve the first element as the journal version
 	version, err := r.Uint()
@@ -154,6 +190,11 @@ func loadSnapshot(diskdb ongdb.KeyValueStore, triedb *trie.Database, cache int,
 	if baseRoot == (common.Hash{}) {
 		return nil, errors.New("missing or corrupted snapshot")
 	}
+	// Snapshots persisted before the layout was versioned share the layout of
+	// the first version, only reject explicitly mismatching ones.
+	if version, ok := rawdb.ReadSnapshotVersion(diskdb); ok && version != snapshotVersion {
+		return nil, &VersionMismatchError{Stored: version, Expected: snapshotVersion}
+	}
 	base := &diskLayer{
 		diskdb: diskdb,
 		triedb: triedb,
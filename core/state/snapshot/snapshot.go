@@ -532,6 +532,7 @@ func diffToDisk(bottom *diffLayer) *diskLayer {
 	}
 	// Update the snapshot block marker and write any remainder data
 	rawdb.WriteSnapshotRoot(batch, bottom.root)
+	rawdb.WriteSnapshotVersion(batch, snapshotVersion)
 
 	// Write out the generator progress marker and report
 	journalProgress(batch, base.genMarker, stats)
@@ -18,6 +18,7 @@ package snapshot
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math/big"
 	"math/rand"
@@ -27,6 +28,7 @@ import (
 	"github.com/ong2020/go-orange/common"
 	"github.com/ong2020/go-orange/core/rawdb"
 	"github.com/ong2020/go-orange/rlp"
+	"github.com/ong2020/go-orange/trie"
 )
 
 // randomHash generates a random blob of data and returns it as a hash.
@@ -423,3 +425,32 @@ func TestSnaphots(t *testing.T) {
 		}
 	}
 }
+
+// Tests that the snapshot layout version is persisted along with the root and
+// that snapshots with a mismatching version are refused.
+func TestSnapshotVersion(t *testing.T) {
+	diskdb := rawdb.NewMemoryDatabase()
+	triedb := trie.NewDatabase(diskdb)
+
+	snap := generateSnapshot(diskdb, triedb, 16, emptyRoot, nil)
+	<-snap.genPending
+
+	stop := make(chan *generatorStats)
+	snap.genAbort <- stop
+	<-stop
+
+	if version, ok := rawdb.ReadSnapshotVersion(diskdb); !ok || version != snapshotVersion {
+		t.Fatalf("snapshot version mismatch: have %d (%v), want %d", version, ok, snapshotVersion)
+	}
+	// Bump the persisted version and ensure the snapshot is refused
+	rawdb.WriteSnapshotVersion(diskdb, snapshotVersion+1)
+
+	_, err := loadSnapshot(diskdb, triedb, 16, emptyRoot, false)
+	var mismatch *VersionMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("mismatching snapshot version not refused: %v", err)
+	}
+	if mismatch.Stored != snapshotVersion+1 || mismatch.Expected != snapshotVersion {
+		t.Fatalf("version mismatch error invalid: have %d/%d, want %d/%d", mismatch.Stored, mismatch.Expected, snapshotVersion+1, snapshotVersion)
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2018 The go-orange Authors
+// This file is part of the go-orange library.
+//
+// The go-orange library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-orange library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-orange library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package testutil implements key-value stores for testing, able to simulate the
+// latency and the failures of real databases.
+package testutil
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ong2020/go-orange/ongdb"
+	"github.com/ong2020/go-orange/ongdb/memorydb"
+)
+
+// ErrInjected is the default error returned by the operations failed on demand.
+var ErrInjected = errors.New("injected failure")
+
+// Op is the type of a database operation, as seen by the failure hook.
+type Op int
+
+const (
+	OpHas        Op = iota // Presence check of a single key
+	OpGet                  // Retrieval of a single key
+	OpPut                  // Insertion of a single key
+	OpDelete               // Removal of a single key
+	OpBatchWrite           // Flush of a batch, applied atomically
+)
+
+// FailHook is invoked before every database operation with the operation type,
+// the 1-based sequence number of the operation among those of the same type and
+// the key involved (nil for batch writes). A non-nil return value fails the
+// operation without touching the database.
+type FailHook func(op Op, n uint64, key []byte) error
+
+// Database is a memory backed ongdb.KeyValueStore which delays every operation
+// by a configurable latency and consults a hook whether to fail it. Batches are
+// buffered in memory and only delayed and checked when written, a failed batch
+// write leaves the database untouched.
+type Database struct {
+	*memorydb.Database
+
+	latency time.Duration // Delay to inject into every operation
+	hook    FailHook      // Hook deciding which operations to fail (nil = never)
+	counts  map[Op]uint64 // Number of operations issued, per type
+	lock    sync.Mutex    // Mutex protecting the fields above
+}
+
+// New creates a memory backed database delaying every operation by latency.
+func New(latency time.Duration) *Database {
+	return &Database{
+		Database: memorydb.New(),
+		latency:  latency,
+		counts:   make(map[Op]uint64),
+	}
+}
+
+// SetLatency changes the delay injected into every operation.
+func (db *Database) SetLatency(latency time.Duration) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.latency = latency
+}
+
+// SetFailHook installs the hook deciding which operations to fail, replacing any
+// previous one. A nil hook disables failure injection.
+func (db *Database) SetFailHook(hook FailHook) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.hook = hook
+}
+
+// FailNth fails the nth (1-based, counted from the creation of the database)
+// operation of the given type with ErrInjected. Other operations succeed.
+func (db *Database) FailNth(op Op, n uint64) {
+	db.SetFailHook(func(o Op, i uint64, key []byte) error {
+		if o == op && i == n {
+			return ErrInjected
+		}
+		return nil
+	})
+}
+
+// Count returns the number of operations of the given type issued so far.
+func (db *Database) Count(op Op) uint64 {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	return db.counts[op]
+}
+
+// enter accounts for a new operation, delaying it by the configured latency and
+// returning the injected failure, if any.
+func (db *Database) enter(op Op, key []byte) error {
+	db.lock.Lock()
+	db.counts[op]++
+	n, latency, hook := db.counts[op], db.latency, db.hook
+	db.lock.Unlock()
+
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	if hook != nil {
+		return hook(op, n, key)
+	}
+	return nil
+}
+
+// Has retrieves if a key is present in the key-value store.
+func (db *Database) Has(key []byte) (bool, error) {
+	if err := db.enter(OpHas, key); err != nil {
+		return false, err
+	}
+	return db.Database.Has(key)
+}
+
+// Get retrieves the given key if it's present in the key-value store.
+func (db *Database) Get(key []byte) ([]byte, error) {
+	if err := db.enter(OpGet, key); err != nil {
+		return nil, err
+	}
+	return db.Database.Get(key)
+}
+
+// Put inserts the given value into the key-value store.
+func (db *Database) Put(key []byte, value []byte) error {
+	if err := db.enter(OpPut, key); err != nil {
+		return err
+	}
+	return db.Database.Put(key, value)
+}
+
+// Delete removes the key from the key-value store.
+func (db *Database) Delete(key []byte) error {
+	if err := db.enter(OpDelete, key); err != nil {
+		return err
+	}
+	return db.Database.Delete(key)
+}
+
+// NewIterator creates a binary-alphabetical iterator over a subset of database
+// content with a particular key prefix, starting at a particular initial key.
+// Only the creation of the iterator is delayed, it can't be failed on demand.
+func (db *Database) NewIterator(prefix []byte, start []byte) ongdb.Iterator {
+	db.lock.Lock()
+	latency := db.latency
+	db.lock.Unlock()
+
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	return db.Database.NewIterator(prefix, start)
+}
+
+// NewBatch creates a write-only key-value store that buffers changes to its host
+// database until a final write is called.
+func (db *Database) NewBatch() ongdb.Batch {
+	return &batch{db: db, Batch: db.Database.NewBatch()}
+}
+
+// batch is a write-only batch which is delayed and checked for injected failures
+// as a whole when written.
+type batch struct {
+	ongdb.Batch
+	db *Database
+}
+
+// Write flushes any accumulated data to the host database, unless the write is
+// failed on demand.
+func (b *batch) Write() error {
+	if err := b.db.enter(OpBatchWrite, nil); err != nil {
+		return err
+	}
+	return b.Batch.Write()
+}
@@ -0,0 +1,108 @@
+// Copyright 2018 The go-orange Authors
+// This file is part of the go-orange library.
+//
+// The go-orange library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-orange library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-orange library. If not, see <http://www.gnu.org/licenses/>.
+
+package testutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ong2020/go-orange/ongdb"
+	"github.com/ong2020/go-orange/ongdb/dbtest"
+)
+
+func TestDatabase(t *testing.T) {
+	t.Run("DatabaseSuite", func(t *testing.T) {
+		dbtest.TestDatabaseSuite(t, func() ongdb.KeyValueStore {
+			return New(0)
+		})
+	})
+}
+
+// Tests that the nth put is failed on demand, without storing its value, while
+// all other operations go through.
+func TestFailNthPut(t *testing.T) {
+	db := New(0)
+	db.FailNth(OpPut, 2)
+
+	if err := db.Put([]byte("a"), []byte{1}); err != nil {
+		t.Fatalf("first put failed: %v", err)
+	}
+	if err := db.Put([]byte("b"), []byte{2}); err != ErrInjected {
+		t.Fatalf("second put error mismatch: have %v, want %v", err, ErrInjected)
+	}
+	if err := db.Put([]byte("c"), []byte{3}); err != nil {
+		t.Fatalf("third put failed: %v", err)
+	}
+	if ok, _ := db.Has([]byte("b")); ok {
+		t.Fatalf("failed put stored its value")
+	}
+	for _, key := range []string{"a", "c"} {
+		if ok, _ := db.Has([]byte(key)); !ok {
+			t.Fatalf("successful put of %q not stored", key)
+		}
+	}
+	if n := db.Count(OpPut); n != 3 {
+		t.Fatalf("put count mismatch: have %d, want %d", n, 3)
+	}
+}
+
+// Tests that a failed batch write leaves the database untouched and that the
+// batch can be retried afterwards.
+func TestFailBatchWrite(t *testing.T) {
+	db := New(0)
+	db.FailNth(OpBatchWrite, 1)
+
+	batch := db.NewBatch()
+	batch.Put([]byte("a"), []byte{1})
+	batch.Put([]byte("b"), []byte{2})
+
+	if err := batch.Write(); err != ErrInjected {
+		t.Fatalf("batch write error mismatch: have %v, want %v", err, ErrInjected)
+	}
+	if ok, _ := db.Has([]byte("a")); ok {
+		t.Fatalf("failed batch write applied")
+	}
+	if err := batch.Write(); err != nil {
+		t.Fatalf("batch write retry failed: %v", err)
+	}
+	for _, key := range []string{"a", "b"} {
+		if ok, _ := db.Has([]byte(key)); !ok {
+			t.Fatalf("retried batch write of %q not applied", key)
+		}
+	}
+}
+
+// Tests that every operation is delayed by the configured latency.
+func TestLatency(t *testing.T) {
+	db := New(10 * time.Millisecond)
+
+	start := time.Now()
+	db.Put([]byte("a"), []byte{1})
+	db.Get([]byte("a"))
+	db.Has([]byte("a"))
+	db.Delete([]byte("a"))
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Fatalf("operations not delayed: took %v, want at least %v", elapsed, 40*time.Millisecond)
+	}
+	db.SetLatency(0)
+	for i := 0; i < 4; i++ {
+		db.Put([]byte("a"), []byte{1})
+	}
+	if db.Count(OpPut) != 5 || db.Count(OpDelete) != 1 {
+		t.Fatalf("operation counts mismatch: puts %d, deletes %d", db.Count(OpPut), db.Count(OpDelete))
+	}
+}